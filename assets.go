@@ -6,16 +6,23 @@ import (
 	"errors"
 	"fmt"
 	"io/fs"
+	"log/slog"
 	"os"
 	"path"
 	"path/filepath"
 	"regexp"
+	"slices"
 	"sort"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/tdewolff/minify/v2"
 	"github.com/tdewolff/minify/v2/css"
+	minifyJSON "github.com/tdewolff/minify/v2/json"
+	"github.com/tdewolff/minify/v2/svg"
+	"github.com/tdewolff/minify/v2/xml"
 )
 
 // assetsTreeNodeType is the type of a node in a tree of assets.
@@ -29,6 +36,46 @@ const (
 )
 
 var imgNodeNameRegExp = regexp.MustCompile(`.+\.(jpg|jpeg|png)`)
+
+// mediaMIMETypes maps the extensions of media (i.e. video and audio) assets to their MIME types.
+var mediaMIMETypes = map[string]string{
+	".mp4":  "video/mp4",
+	".webm": "video/webm",
+	".mp3":  "audio/mpeg",
+}
+
+// mediaMIMEType returns the MIME type of the media asset at assetPath, or an empty
+// string if it isn't a media asset.
+func mediaMIMEType(assetPath string) string {
+	return mediaMIMETypes[strings.ToLower(filepath.Ext(assetPath))]
+}
+
+// inlineAssetExts are the extensions of the text-like assets that can be inlined in pages
+// by the inlineAsset template func. css and js assets aren't among them, since their
+// content would be escaped as html; css ones are inlined by inlineCSS instead.
+var inlineAssetExts = map[string]struct{}{
+	".svg":  {},
+	".txt":  {},
+	".json": {},
+	".xml":  {},
+	".md":   {},
+}
+
+// assetMinifier is a minifier that can be used for assets in the minifyAssets field of
+// the config file.
+type assetMinifier struct {
+	mediaType string
+	fn        minify.MinifierFunc
+}
+
+// assetMinifiers are the minifiers that can be used for assets keyed by their names.
+var assetMinifiers = map[string]assetMinifier{
+	"css":  {"text/css", css.Minify},
+	"json": {"application/json", minifyJSON.Minify},
+	"svg":  {"image/svg+xml", svg.Minify},
+	"xml":  {"text/xml", xml.Minify},
+}
+
 var cssFilenameRegExp = regexp.MustCompile(`^.*\.css$`)
 
 // AssetRelPath is the path of an asset relative to the global assets
@@ -47,10 +94,124 @@ const (
 	terminate                          // Terminate the traversal
 )
 
+// assetsProcessingConfig is the config used when processing a tree of assets.
+type assetsProcessingConfig struct {
+	// largeImgsFactor is the factor by which the width of the original size of
+	// an img node has to exceed its largest non-original size in order for a
+	// warning to be emitted. If it's 0, no warning is emitted.
+	largeImgsFactor float64
+	// logger is where the warnings about large imgs are reported to. It must be set if
+	// largeImgsFactor isn't 0.
+	logger *slog.Logger
+	// flatImgs is whether the sizes of an img node are placed in the same directory
+	// as the node instead of in a directory named after the node's md5 hash.
+	flatImgs bool
+	// namedImgSizes is whether the names of the files of the sizes of an img node start
+	// with the node's name without its extension, e.g. photo-800.jpg instead of 800.jpg.
+	// It has no effect if flatImgs is true, since they already start with it.
+	namedImgSizes bool
+	// imgFormats are the formats the sizes of an img node are encoded to. The first
+	// one is used in links. If it's empty, only the original format is used.
+	imgFormats []string
+	// computeImgColors is whether the average color of img nodes is computed.
+	computeImgColors bool
+	// highDPI is whether the double of each responsive width is also added to the sizes
+	// of img nodes, so that there are sizes for 2x displays.
+	highDPI bool
+	// originalImgs is whether the file of an img node is also placed, as is and with its
+	// name, among the files of its sizes. It's then used as the file of the original size
+	// in the original format, so that the same content isn't written twice.
+	originalImgs bool
+	// minifiedExts maps the extensions of the file nodes that are minified before being
+	// written, and whose md5 hash is computed from the minified content, to the names of
+	// their minifiers in assetMinifiers.
+	minifiedExts map[string]string
+	// assetsDir is the name of the directory in which the assets are placed, relative to
+	// the site's root, which is the prefix of their links. If it's empty, defaultAssetsDir is used.
+	assetsDir string
+	// imgQuality is how the sizes of img nodes are resized and encoded. If it's nil,
+	// defaultImgQuality is used.
+	imgQuality *imgQuality
+	// perms are the permissions of the directories and of the files created while
+	// processing nodes. If it's the zero value, defaultOutputPerms is used.
+	perms outputPerms
+}
+
+var defaultAssetsDir = "assets"
+
+// outputPerms returns the permissions of the directories and of the files created while
+// processing nodes. pc can be nil.
+func (pc *assetsProcessingConfig) outputPerms() outputPerms {
+	if pc == nil || pc.perms == (outputPerms{}) {
+		return defaultOutputPerms
+	}
+
+	return pc.perms
+}
+
+// resizeQuality returns the quality with which the sizes of img nodes are resized and
+// encoded. pc can be nil.
+func (pc *assetsProcessingConfig) resizeQuality() imgQuality {
+	if pc == nil || pc.imgQuality == nil {
+		return defaultImgQuality
+	}
+
+	return *pc.imgQuality
+}
+
+// minify returns content, the content of a file node whose name has the extension ext,
+// minified if ext is in minifiedExts. pc can be nil.
+func (pc *assetsProcessingConfig) minify(ext string, content []byte) ([]byte, error) {
+	if pc == nil {
+		return content, nil
+	}
+
+	name, ok := pc.minifiedExts[strings.ToLower(ext)]
+	if !ok {
+		return content, nil
+	}
+
+	return minifyAsset(name, content)
+}
+
+// minifyAsset minifies content with the minifier in assetMinifiers whose name is name.
+func minifyAsset(name string, content []byte) ([]byte, error) {
+	// every minifier is added, since some of them use others, e.g. the svg one uses the
+	// css one for style elements.
+	m := minify.New()
+	for _, am := range assetMinifiers {
+		m.AddFunc(am.mediaType, am.fn)
+	}
+
+	return m.Bytes(assetMinifiers[name].mediaType, content)
+}
+
+// responsiveWidths returns the widths of the sizes added to img nodes given the responsive
+// widths, which are the widths themselves with their doubles if highDPI is true, sorted in
+// ascending order. pc can be nil.
+func (pc *assetsProcessingConfig) responsiveWidths(widths []int) []int {
+	if pc == nil || !pc.highDPI || len(widths) == 0 {
+		return widths
+	}
+
+	res := make([]int, 0, len(widths)*2)
+	for _, width := range widths {
+		res = append(res, width, width*2)
+	}
+
+	sort.Ints(res)
+
+	return slices.Compact(res)
+}
+
 type assetsTreeNodeImgSize struct {
 	original  bool
 	width     int
 	processed bool
+	// once ensures that the size is processed only once, even if processSizes is called
+	// concurrently for its node. err is the error returned when processing it.
+	once sync.Once
+	err  error
 }
 
 // assetsTreeNodeTraverseFn is the function executed for each one in a tree traversal.
@@ -79,6 +240,35 @@ type assetsTreeNode struct {
 	// processedRelPath is the node's relative path after processing. It's processedPath without the
 	// outDirPath value at the beginning.
 	processedRelPath string
+	// flat is whether the node's sizes are placed in the node's parent directory. In this
+	// case, processedRelPath and processedPath are prefixes of the sizes' paths rather
+	// than the paths of a directory.
+	flat bool
+	// namedSizes is whether the names of the files of the node's sizes start with the
+	// node's name, as set by assetsProcessingConfig.namedImgSizes.
+	namedSizes bool
+	// originalFile is whether the node's file is placed among the files of its sizes, as
+	// set by assetsProcessingConfig.originalImgs.
+	originalFile bool
+	// largeImgWarned is whether a warning about the node's original size being too
+	// large has already been emitted.
+	largeImgWarned bool
+	// imgFormats are the formats the node's sizes are encoded to, as set by
+	// assetsProcessingConfig.imgFormats.
+	imgFormats []string
+	// avgColor is the average color of the node as a hex string. It's only set if
+	// assetsProcessingConfig.computeImgColors is true.
+	avgColor string
+	// assetsDir is the prefix of the links of the tree's nodes, as set by
+	// assetsProcessingConfig.assetsDir. It's only set in the root node.
+	assetsDir string
+	// modTime and fileSize are the modification time and the size of the node's file when
+	// the tree was generated. They're only set in img nodes.
+	modTime  time.Time
+	fileSize int64
+	// mu guards sizes, avgColor and largeImgWarned, which are read and changed by template
+	// funcs while the pages of each lang are executed in parallel.
+	mu sync.Mutex
 }
 
 var defaultIgnoreRegexps = []*regexp.Regexp{
@@ -91,13 +281,28 @@ var defaultIgnoreRegexps = []*regexp.Regexp{
 // all of its descendants are automatically ignored, regardless of whether their names match
 // one of the regexps. The returned tree is sorted alphabetically by node name in ascending order.
 func generateAssetsTree(assetsPath string, ignoreRegexps []*regexp.Regexp) (*assetsTreeNode, error) {
+	return generateAssetsTreeFromPrevious(assetsPath, ignoreRegexps, nil, false)
+}
+
+// generateAssetsTreeFromPrevious is the same as generateAssetsTree, but the width and the
+// average color of each img node whose file has the same modification time and size as
+// the one of the node at the same path in prev are taken from the latter instead of
+// decoding the img again. prev is a tree generated by a previous call, which is ignored
+// if it's nil or if it's not rooted at assetsPath. If undecodableImgsAsFiles is true, the
+// imgs whose dimensions can't be read, e.g. empty or corrupt ones, become file nodes, which
+// are copied as they are, instead of being an error.
+func generateAssetsTreeFromPrevious(assetsPath string, ignoreRegexps []*regexp.Regexp, prev *assetsTreeNode, undecodableImgsAsFiles bool) (*assetsTreeNode, error) {
 	rootNode := &assetsTreeNode{
 		t:    DIRNODE,
 		name: "assets",
 		path: path.Clean(assetsPath),
 	}
 
-	err := generateAssetsTreeRec(rootNode, ignoreRegexps)
+	if prev != nil && prev.path != rootNode.path {
+		prev = nil
+	}
+
+	err := generateAssetsTreeRec(rootNode, ignoreRegexps, prev, undecodableImgsAsFiles)
 	if err != nil && !errors.Is(err, fs.ErrNotExist) {
 		return nil, err
 	}
@@ -105,7 +310,9 @@ func generateAssetsTree(assetsPath string, ignoreRegexps []*regexp.Regexp) (*ass
 	return rootNode, nil
 }
 
-func generateAssetsTreeRec(rootNode *assetsTreeNode, ignoreRegexps []*regexp.Regexp) error {
+// generateAssetsTreeRec adds the descendants of rootNode to it. prev is the node in the
+// previous tree whose path is the same as the one of rootNode, which can be nil.
+func generateAssetsTreeRec(rootNode *assetsTreeNode, ignoreRegexps []*regexp.Regexp, prev *assetsTreeNode, undecodableImgsAsFiles bool) error {
 	fileInfos, err := os.ReadDir(rootNode.path)
 	if err != nil {
 		return err
@@ -138,20 +345,49 @@ fileInfosLoop:
 		case imgNodeNameRegExp.MatchString(nodeName):
 			nodePath := path.Join(rootNode.path, nodeName)
 
-			width, _, err := imgDimensions(nodePath)
+			info, err := fileInfo.Info()
 			if err != nil {
 				return err
 			}
 
 			node = &assetsTreeNode{
-				t:    IMGNODE,
-				name: nodeName,
-				path: nodePath,
-				sizes: []*assetsTreeNodeImgSize{
-					{
-						original: true,
-						width:    width,
-					},
+				t:        IMGNODE,
+				name:     nodeName,
+				path:     nodePath,
+				modTime:  info.ModTime(),
+				fileSize: info.Size(),
+			}
+
+			var width int
+
+			prevNode := prev.childByName(nodeName)
+			if prevNode != nil &&
+				prevNode.t == IMGNODE &&
+				prevNode.modTime.Equal(node.modTime) &&
+				prevNode.fileSize == node.fileSize {
+				width = prevNode.findOriginalSize().width
+				node.avgColor = prevNode.avgColor
+			} else {
+				width, _, err = imgDimensions(nodePath)
+				if err != nil {
+					if !undecodableImgsAsFiles {
+						return fmt.Errorf("reading dimensions of %v img: %w", nodePath, err)
+					}
+
+					node = &assetsTreeNode{
+						t:    FILENODE,
+						name: nodeName,
+						path: nodePath,
+					}
+
+					break
+				}
+			}
+
+			node.sizes = []*assetsTreeNodeImgSize{
+				{
+					original: true,
+					width:    width,
 				},
 			}
 		case fileInfo.IsDir():
@@ -161,7 +397,12 @@ fileInfosLoop:
 				path: path.Join(rootNode.path, nodeName),
 			}
 
-			err := generateAssetsTreeRec(node, ignoreRegexps)
+			prevNode := prev.childByName(nodeName)
+			if prevNode != nil && prevNode.t != DIRNODE {
+				prevNode = nil
+			}
+
+			err := generateAssetsTreeRec(node, ignoreRegexps, prevNode, undecodableImgsAsFiles)
 			if err != nil {
 				return err
 			}
@@ -297,6 +538,15 @@ func (n *assetsTreeNode) addChild(t assetsTreeNodeType, name string) *assetsTree
 	return c
 }
 
+// root returns the root of the tree n is in.
+func (n *assetsTreeNode) root() *assetsTreeNode {
+	for n.parent != nil {
+		n = n.parent
+	}
+
+	return n
+}
+
 func (n *assetsTreeNode) lastChild() *assetsTreeNode {
 	if n.firstChild == nil {
 		return nil
@@ -313,24 +563,25 @@ func (n *assetsTreeNode) lastChild() *assetsTreeNode {
 
 /* sizes */
 
+// addSizes adds a size to n for each width that isn't greater than the width of its
+// original size, unless n already has one with that width. The sizes are kept sorted by
+// width, so that they don't depend on the order of the calls, which can be concurrent.
 func (n *assetsTreeNode) addSizes(widths ...int) {
 	originalSize := n.findOriginalSize()
 
 	for _, width := range widths {
-		if originalSize.width < width {
-			return
-		}
-
-		for _, size := range n.sizes {
-			if size.width == width {
-				return
-			}
+		if originalSize.width < width || n.findSize(width) != nil {
+			continue
 		}
 
 		n.sizes = append(n.sizes, &assetsTreeNodeImgSize{
 			width: width,
 		})
 	}
+
+	sort.SliceStable(n.sizes, func(i, j int) bool {
+		return n.sizes[i].width < n.sizes[j].width
+	})
 }
 
 func (n *assetsTreeNode) findSize(width int) *assetsTreeNodeImgSize {
@@ -358,17 +609,70 @@ func (n *assetsTreeNode) findOriginalSize() *assetsTreeNodeImgSize {
 }
 
 func (n *assetsTreeNode) generateSizeProcessedPath(rel bool, size *assetsTreeNodeImgSize) string {
+	return n.generateSizeFormatProcessedPath(rel, size, n.formats()[0])
+}
+
+// generateSizeFormatProcessedPath is like generateSizeProcessedPath, but for the file of
+// size encoded to format.
+func (n *assetsTreeNode) generateSizeFormatProcessedPath(rel bool, size *assetsTreeNodeImgSize, format string) string {
 	if n.t != IMGNODE {
 		panic("not an img node")
 	}
 
 	ext := filepath.Ext(n.name)
+	if format != originalImgFormat {
+		ext = imgFormatExts[format]
+	}
+
+	if n.originalFile && size.original && ext == filepath.Ext(n.name) {
+		return n.generateOriginalProcessedPath(rel)
+	}
+
+	sizeName := strconv.Itoa(size.width) + ext
+
+	processedPath := n.processedPath
+	if rel {
+		processedPath = n.processedRelPath
+	}
+
+	if n.flat {
+		return processedPath + "-" + sizeName
+	}
+
+	if n.namedSizes {
+		sizeName = strings.TrimSuffix(n.name, filepath.Ext(n.name)) + "-" + sizeName
+	}
 
+	return path.Join(processedPath, sizeName)
+}
+
+// generateOriginalProcessedPath returns the path of the node's original file, which is
+// named after the node in its directory or, if the node is flat, the prefix of its sizes
+// with the node's extension. See assetsProcessingConfig.originalImgs.
+func (n *assetsTreeNode) generateOriginalProcessedPath(rel bool) string {
+	if n.t != IMGNODE {
+		panic("not an img node")
+	}
+
+	processedPath := n.processedPath
 	if rel {
-		return path.Join(n.processedRelPath, strconv.Itoa(size.width)+ext)
+		processedPath = n.processedRelPath
+	}
+
+	if n.flat {
+		return processedPath + filepath.Ext(n.name)
 	}
 
-	return path.Join(n.processedPath, strconv.Itoa(size.width)+ext)
+	return path.Join(processedPath, n.name)
+}
+
+// formats returns the formats the node's sizes are encoded to.
+func (n *assetsTreeNode) formats() []string {
+	if len(n.imgFormats) == 0 {
+		return []string{originalImgFormat}
+	}
+
+	return n.imgFormats
 }
 
 func (n *assetsTreeNode) generateSrcSetValue(postSlug string) string {
@@ -426,6 +730,7 @@ func traverseRec(n *assetsTreeNode, fn assetsTreeNodeTraverseFn) (traverseStatus
 	c := n.firstChild
 
 	for c != nil {
+		// c.next is stored before calling fn so that fn is able to remove c from the tree.
 		cNext := c.next
 
 		switch c.t {
@@ -461,7 +766,11 @@ func traverseRec(n *assetsTreeNode, fn assetsTreeNodeTraverseFn) (traverseStatus
 // process processes each node of a tree of assets rooted at n and places the output
 // in outDirPath. Each processed node has its processedRelPath and processedPath properties
 // set.
-func (n *assetsTreeNode) process(outDirPath string, processRoot bool) error {
+func (n *assetsTreeNode) process(outDirPath string, processRoot bool, pc *assetsProcessingConfig) error {
+	if pc != nil {
+		n.root().assetsDir = pc.assetsDir
+	}
+
 	err := n.traverse(func(n2 *assetsTreeNode) (traverseStatus, error) {
 		if n2 == n && !processRoot {
 			return next, nil
@@ -478,53 +787,45 @@ func (n *assetsTreeNode) process(outDirPath string, processRoot bool) error {
 
 			md5HashBs := md5.Sum(nodeContent)
 			md5Hash := hex.EncodeToString(md5HashBs[:])
-			pathWithoutRootProcessed := path.Join(pathWithoutRoot, "..", md5Hash)
-			processedPath := path.Join(outDirPath, pathWithoutRootProcessed)
 
-			if err := os.Mkdir(processedPath, os.ModePerm|os.ModeDir); err != nil {
-				return terminate, fmt.Errorf("while creating %v directory: %v", processedPath, err)
+			var pathWithoutRootProcessed string
+
+			if pc != nil && pc.flatImgs {
+				// the md5 hash is part of the name of the sizes' files, which avoids
+				// collisions between imgs with the same name but different extensions.
+				nameWithoutExt := strings.TrimSuffix(n2.name, filepath.Ext(n2.name))
+				pathWithoutRootProcessed = path.Join(pathWithoutRoot, "..", nameWithoutExt+"-"+md5Hash)
+				n2.flat = true
+			} else {
+				pathWithoutRootProcessed = path.Join(pathWithoutRoot, "..", md5Hash)
+				processedPath := path.Join(outDirPath, pathWithoutRootProcessed)
+
+				// MkdirAll is used because the node could've been added to the tree programmatically
+				// in a directory that doesn't exist in outDirPath.
+				if err := os.MkdirAll(processedPath, pc.outputPerms().dir); err != nil {
+					return terminate, fmt.Errorf("while creating %v directory: %v", processedPath, err)
+				}
 			}
 
 			n2.processedRelPath = pathWithoutRootProcessed
 			n2.processedPath = path.Join(outDirPath, pathWithoutRootProcessed)
 
-			if err := n2.processSizes(); err != nil {
-				return terminate, err
+			if pc != nil {
+				n2.imgFormats = pc.imgFormats
+				n2.namedSizes = pc.namedImgSizes
+				n2.originalFile = pc.originalImgs
 			}
-		case FILENODE:
-			ext := filepath.Ext(pathWithoutRoot)
-			pathWithoutRootWithoutExt := strings.TrimSuffix(pathWithoutRoot, ext)
 
-			// md5 hash
-			nodeContent, err := n2.getContent()
-			if err != nil {
+			if err := n2.processSizes(pc); err != nil {
 				return terminate, err
 			}
-
-			md5HashBs := md5.Sum(nodeContent)
-			md5Hash := hex.EncodeToString(md5HashBs[:])
-			pathWithoutRootProcessed := pathWithoutRootWithoutExt + "-" + string(md5Hash[:]) + ext
-
-			fileOutPath := path.Join(outDirPath, pathWithoutRootProcessed)
-			fileOut, err := os.Create(fileOutPath)
-			if err != nil {
-				return terminate, err
-			}
-
-			// writing to new file
-			_, err = fileOut.Write(nodeContent)
-			if err != nil {
-				fileOut.Close()
+		case FILENODE:
+			if err := n2.processFile(outDirPath, pathWithoutRoot, pc); err != nil {
 				return terminate, err
 			}
-
-			fileOut.Close()
-
-			n2.processedRelPath = pathWithoutRootProcessed
-			n2.processedPath = fileOutPath
 		case DIRNODE:
 			processedPath := path.Join(outDirPath, pathWithoutRoot)
-			err := os.Mkdir(processedPath, os.ModeDir|os.ModePerm)
+			err := os.MkdirAll(processedPath, pc.outputPerms().dir)
 			if err != nil {
 				return terminate, err
 			}
@@ -542,8 +843,50 @@ func (n *assetsTreeNode) process(outDirPath string, processRoot bool) error {
 	return nil
 }
 
-// processSizes processes the sizes of an img node.
-func (n *assetsTreeNode) processSizes() error {
+// processFile writes the content of the file node n to outDirPath, at pathWithoutRoot
+// with the md5 hash of the content appended to its name, and sets its processedRelPath
+// and processedPath properties. The content is minified first if its extension is in the
+// minifiedExts of pc, which can be nil.
+func (n *assetsTreeNode) processFile(outDirPath, pathWithoutRoot string, pc *assetsProcessingConfig) error {
+	ext := filepath.Ext(pathWithoutRoot)
+	pathWithoutRootWithoutExt := strings.TrimSuffix(pathWithoutRoot, ext)
+
+	nodeContent, err := n.getContent()
+	if err != nil {
+		return err
+	}
+
+	nodeContent, err = pc.minify(ext, nodeContent)
+	if err != nil {
+		return fmt.Errorf("minifying %v: %v", n.path, err)
+	}
+
+	// md5 hash
+
+	md5HashBs := md5.Sum(nodeContent)
+	md5Hash := hex.EncodeToString(md5HashBs[:])
+	pathWithoutRootProcessed := pathWithoutRootWithoutExt + "-" + string(md5Hash[:]) + ext
+
+	fileOutPath := path.Join(outDirPath, pathWithoutRootProcessed)
+	if err := os.MkdirAll(path.Dir(fileOutPath), pc.outputPerms().dir); err != nil {
+		return err
+	}
+
+	// writing to new file
+	if err := writeFileAtomicBytes(fileOutPath, pc.outputPerms().file, nodeContent); err != nil {
+		return err
+	}
+
+	n.processedRelPath = pathWithoutRootProcessed
+	n.processedPath = fileOutPath
+
+	return nil
+}
+
+// processSizes processes the sizes of an img node. It can be called concurrently for the
+// same node: n.mu is only held while the sizes are read and updated, so that the imgs are
+// decoded and encoded outside of it, and each size is processed only once.
+func (n *assetsTreeNode) processSizes(pc *assetsProcessingConfig) error {
 	if n.t != IMGNODE {
 		panic("not an img node")
 	}
@@ -552,41 +895,186 @@ func (n *assetsTreeNode) processSizes() error {
 		panic("node hasn't been processed")
 	}
 
+	n.mu.Lock()
+
+	if pc != nil && pc.largeImgsFactor > 0 {
+		n.warnIfLargeImg(pc.logger, pc.largeImgsFactor)
+	}
+
+	// avgColor can've been taken from a previous tree, which might've been processed with
+	// computeImgColors set.
+	if pc == nil || !pc.computeImgColors {
+		n.avgColor = ""
+	}
+
+	computeAvgColor := pc != nil && pc.computeImgColors && n.avgColor == ""
+	sizes := slices.Clone(n.sizes)
+
+	n.mu.Unlock()
+
+	if computeAvgColor {
+		avgColor, err := averageImgColor(n.path)
+		if err != nil {
+			return fmt.Errorf("while computing %v average color: %v", n.path, err)
+		}
+
+		n.mu.Lock()
+		n.avgColor = avgColor
+		n.mu.Unlock()
+	}
+
+	for _, size := range sizes {
+		size.once.Do(func() {
+			size.err = n.processSize(size, pc)
+		})
+
+		if size.err != nil {
+			return size.err
+		}
+	}
+
+	return nil
+}
+
+// processSize writes the files of size, one for each format of n, unless it has already
+// been processed. The original file of n is written along with its original size.
+func (n *assetsTreeNode) processSize(size *assetsTreeNodeImgSize, pc *assetsProcessingConfig) error {
+	n.mu.Lock()
+	processed := size.processed
+	n.mu.Unlock()
+
+	if processed {
+		return nil
+	}
+
 	nodeContent, err := n.getContent()
 	if err != nil {
 		return fmt.Errorf("while retrieving %v content: %v", n.path, err)
 	}
 
-	for _, size := range n.sizes {
-		if size.processed {
+	// formats that end up in the same file, e.g. original and jpeg for a .jpg img, are
+	// only written once, as is the original file.
+	writtenPaths := make(map[string]struct{}, len(n.formats())+1)
+
+	if n.originalFile {
+		originalFilePath := n.generateOriginalProcessedPath(false)
+
+		if size.original {
+			if err := writeFileAtomicBytes(originalFilePath, pc.outputPerms().file, nodeContent); err != nil {
+				return fmt.Errorf("while writing to %v file: %v", originalFilePath, err)
+			}
+		}
+
+		writtenPaths[originalFilePath] = struct{}{}
+	}
+
+	for _, format := range n.formats() {
+		sizeFilePath := n.generateSizeFormatProcessedPath(false, size, format)
+		if mapContains(writtenPaths, sizeFilePath) {
 			continue
 		}
 
-		sizeFilePath := n.generateSizeProcessedPath(false, size)
 		sizeFileContent := nodeContent
-		sizeFile, err := os.Create(sizeFilePath)
-		if err != nil {
-			return fmt.Errorf("while creating %v file", sizeFilePath)
-		}
 
-		if !size.original {
-			sizeFileContent, err = resizeImg(size.width, n.path)
+		sameFormat := format == originalImgFormat || format == imgFormatFromExt(filepath.Ext(n.name))
+		if !size.original || !sameFormat {
+			sizeFileContent, err = resizeImg(size.width, n.path, format, pc.resizeQuality())
 			if err != nil {
-				return fmt.Errorf("while resizing %v image", n.path)
+				return fmt.Errorf("while resizing %v image: %v", n.path, err)
 			}
 		}
 
-		if _, err := sizeFile.Write(sizeFileContent); err != nil {
-			return fmt.Errorf("while writing to %v file", sizeFilePath)
+		if err := writeFileAtomicBytes(sizeFilePath, pc.outputPerms().file, sizeFileContent); err != nil {
+			return fmt.Errorf("while writing to %v file: %v", sizeFilePath, err)
 		}
 
-		size.processed = true
+		writtenPaths[sizeFilePath] = struct{}{}
 	}
 
+	n.mu.Lock()
+	size.processed = true
+	n.mu.Unlock()
+
 	return nil
 }
 
-// processCSSFileNodes processed CSS file nodes with depth = 1.
+// warnIfLargeImg emits a warning to logger if the width of the original size of n is greater
+// than its largest non-original size multiplied by factor.
+func (n *assetsTreeNode) warnIfLargeImg(logger *slog.Logger, factor float64) {
+	if n.largeImgWarned {
+		return
+	}
+
+	var largestWidth int
+	for _, size := range n.sizes {
+		if !size.original && size.width > largestWidth {
+			largestWidth = size.width
+		}
+	}
+
+	if largestWidth == 0 {
+		return
+	}
+
+	originalWidth := n.findOriginalSize().width
+	if float64(originalWidth) > float64(largestWidth)*factor {
+		logger.Warn(
+			"img is wider than its largest responsive size by more than the large imgs factor; consider downscaling it",
+			"path", n.path,
+			"width", originalWidth,
+			"largestWidth", largestWidth,
+			"factor", factor,
+		)
+
+		n.largeImgWarned = true
+	}
+}
+
+// verifyProcessedFiles returns an error for each file referenced by the links of the
+// processed nodes in the tree rooted at n, i.e. the ones returned by assetLink and
+// generateSrcSetValue, that doesn't exist.
+func (n *assetsTreeNode) verifyProcessedFiles() []error {
+	var errs []error
+
+	check := func(n *assetsTreeNode, filePath string) {
+		if _, err := os.Stat(filePath); err != nil {
+			errs = append(errs, fmt.Errorf("%v, processed from %v, doesn't exist", filePath, n.path))
+		}
+	}
+
+	n.traverse(func(n *assetsTreeNode) (traverseStatus, error) {
+		if n.processedPath == "" {
+			return next, nil
+		}
+
+		switch n.t {
+		case FILENODE:
+			check(n, n.processedPath)
+		case IMGNODE:
+			for _, size := range n.sizes {
+				// the original size is always linked, even if it hasn't been processed.
+				if !size.processed && !size.original {
+					continue
+				}
+
+				for _, format := range n.formats() {
+					check(n, n.generateSizeFormatProcessedPath(false, size, format))
+				}
+			}
+
+			if n.originalFile {
+				check(n, n.generateOriginalProcessedPath(false))
+			}
+		}
+
+		return next, nil
+	})
+
+	return errs
+}
+
+// processCSSFileNodes bundles the CSS file nodes with depth = 1 into a single style.css
+// file node, which is only created if at least one of them isn't empty.
 func (n *assetsTreeNode) processCSSFileNodes() error {
 	cssContent := make([]byte, 0)
 
@@ -617,11 +1105,12 @@ func (n *assetsTreeNode) processCSSFileNodes() error {
 		return err
 	}
 
-	// minifying
-	m := minify.New()
-	m.AddFunc("text/css", css.Minify)
+	// no CSS file contributed any content, so there's no style.css to be created.
+	if len(cssContent) == 0 {
+		return nil
+	}
 
-	cssContentMinified, err := m.Bytes("text/css", cssContent)
+	cssContentMinified, err := minifyAsset("css", cssContent)
 	if err != nil {
 		return err
 	}
@@ -635,26 +1124,56 @@ func (n *assetsTreeNode) processCSSFileNodes() error {
 /* asset link */
 
 func (n *assetsTreeNode) assetLink(postSlug string, size *assetsTreeNodeImgSize) string {
-	pathSegments := []string{"/assets"}
-
-	if postSlug != "" {
-		pathSegments = append(pathSegments, postSlug)
-	}
-
 	switch {
 	case size != nil:
-		pathSegments = append(pathSegments, n.generateSizeProcessedPath(true, size))
+		return n.assetLinkFromRelPath(postSlug, n.generateSizeProcessedPath(true, size))
 	case n.t == IMGNODE:
-		pathSegments = append(pathSegments, n.generateSizeProcessedPath(true, n.findOriginalSize()))
+		return n.assetLinkFromRelPath(postSlug, n.generateSizeProcessedPath(true, n.findOriginalSize()))
 	default:
-		pathSegments = append(pathSegments, n.processedRelPath)
+		return n.assetLinkFromRelPath(postSlug, n.processedRelPath)
 	}
+}
 
-	return path.Join(pathSegments...)
+// originalAssetLink returns the link of the original file of the img node n. See
+// assetsProcessingConfig.originalImgs.
+func (n *assetsTreeNode) originalAssetLink(postSlug string) string {
+	return n.assetLinkFromRelPath(postSlug, n.generateOriginalProcessedPath(true))
+}
+
+// assetLinkFromRelPath returns the link of the file at relPath, relative to the directory
+// in which the tree of n was processed.
+func (n *assetsTreeNode) assetLinkFromRelPath(postSlug, relPath string) string {
+	assetsDir := n.root().assetsDir
+	if assetsDir == "" {
+		assetsDir = defaultAssetsDir
+	}
+
+	pathSegments := []string{"/", assetsDir}
+
+	if postSlug != "" {
+		pathSegments = append(pathSegments, postSlug)
+	}
+
+	return path.Join(append(pathSegments, relPath)...)
 }
 
 /* finding a node */
 
+// childByName returns the child of n whose name is name or nil if there's none. n can be nil.
+func (n *assetsTreeNode) childByName(name string) *assetsTreeNode {
+	if n == nil {
+		return nil
+	}
+
+	for c := n.firstChild; c != nil; c = c.next {
+		if c.name == name {
+			return c
+		}
+	}
+
+	return nil
+}
+
 // findNodeByName returns the first node whose name is equal to the given name encountered while traversing n.
 func (n *assetsTreeNode) findNodeByName(name string) *assetsTreeNode {
 	var res *assetsTreeNode
@@ -722,3 +1241,32 @@ func findByRelPathInGATOrPAT(gat, pat *assetsTreeNode, relPath AssetRelPath) (n
 
 	return pat.findByRelPath(string(relPath)), true
 }
+
+// assetNotFoundHint returns what's appended to the error of an asset at relPath that
+// findByRelPathInGATOrPAT didn't find, which, if there's a node at relPath in the tree that
+// wasn't searched, suggests the path that refers to it, e.g. img.png for /img.png if img.png
+// is in the PAT. Otherwise, it returns an empty string.
+func assetNotFoundHint(gat, pat *assetsTreeNode, relPath AssetRelPath) string {
+	if len(relPath) == 0 {
+		return ""
+	}
+
+	var otherRelPath AssetRelPath
+	if relPath[0] == '/' {
+		otherRelPath = AssetRelPath(strings.TrimLeft(string(relPath), "/"))
+	} else {
+		otherRelPath = "/" + relPath
+	}
+
+	n, searchedInPAT := findByRelPathInGATOrPAT(gat, pat, otherRelPath)
+	if n == nil {
+		return ""
+	}
+
+	tree := "GAT"
+	if searchedInPAT {
+		tree = "PAT"
+	}
+
+	return fmt.Sprintf(", did you mean %v, which is in the %v?", otherRelPath, tree)
+}
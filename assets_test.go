@@ -1,14 +1,25 @@
 package egen
 
 import (
+	"bytes"
+	"crypto/md5"
+	"encoding/hex"
 	"errors"
 	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"io/fs"
+	"os"
 	"path"
 	"reflect"
 	"regexp"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 )
 
 func printDebugNode(n *assetsTreeNode) {
@@ -57,6 +68,14 @@ func TestGenerateAssetsTree(t *testing.T) {
 	}
 	imgsDirNode.firstChild = redImgNode
 
+	redImgFileInfo, err := os.Stat(redImgNode.path)
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	redImgNode.modTime = redImgFileInfo.ModTime()
+	redImgNode.fileSize = redImgFileInfo.Size()
+
 	rootNode2 := &assetsTreeNode{
 		t:    DIRNODE,
 		name: "assets",
@@ -106,6 +125,129 @@ func TestGenerateAssetsTree(t *testing.T) {
 	}
 }
 
+func TestGenerateAssetsTree_undecodableImgs(t *testing.T) {
+	red, err := os.ReadFile("testdata/tree/ok/1/imgs/red.png")
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	files := map[string][]byte{
+		// cut in the middle of the IHDR chunk, which has the dimensions.
+		"truncated.png": red[:20],
+		"empty.jpg":     {},
+	}
+
+	for name, content := range files {
+		t.Run(name, func(t *testing.T) {
+			assetsPath := t.TempDir()
+
+			if err := os.WriteFile(path.Join(assetsPath, name), content, 0644); err != nil {
+				t.Fatalf("unexpected err: %v", err)
+			}
+
+			_, err := generateAssetsTree(assetsPath, nil)
+			if err == nil {
+				t.Fatal("expected an error")
+			}
+
+			if !strings.Contains(err.Error(), path.Join(assetsPath, name)) {
+				t.Errorf("got %q, want it to contain the path of the img", err)
+			}
+
+			tree, err := generateAssetsTreeFromPrevious(assetsPath, nil, nil, true)
+			if err != nil {
+				t.Fatalf("unexpected err: %v", err)
+			}
+
+			n := tree.findByRelPath(name)
+			if n == nil || n.t != FILENODE {
+				t.Fatalf("got %+v, want a file node", n)
+			}
+
+			outPath := t.TempDir()
+			if err := tree.process(outPath, false, nil); err != nil {
+				t.Fatalf("unexpected err: %v", err)
+			}
+
+			processed, err := os.ReadFile(n.processedPath)
+			if err != nil {
+				t.Fatalf("unexpected err: %v", err)
+			}
+
+			if !bytes.Equal(processed, content) {
+				t.Errorf("got %v bytes, want the %v bytes of the img as is", len(processed), len(content))
+			}
+		})
+	}
+}
+
+func TestGenerateAssetsTreeFromPrevious(t *testing.T) {
+	assetsPath := path.Join(t.TempDir(), "assets")
+	if err := copyDirRec("testdata/tree/ok/1", assetsPath, defaultOutputPerms); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	prev, err := generateAssetsTree(assetsPath, nil)
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	// the width and the color of the previous node are changed so that it's possible to
+	// tell whether they were taken from it.
+	prevImgNode := prev.findByRelPath("imgs/red.png")
+	prevImgNode.findOriginalSize().width = 1
+	prevImgNode.avgColor = "#000000"
+
+	checkImgNode := func(t *testing.T, tree *assetsTreeNode, width int, avgColor string) {
+		t.Helper()
+
+		imgNode := tree.findByRelPath("imgs/red.png")
+		if imgNode == nil {
+			t.Fatal("imgs/red.png not found")
+		}
+
+		if got := imgNode.findOriginalSize().width; got != width {
+			t.Errorf("got %v width, want %v", got, width)
+		}
+
+		if imgNode.avgColor != avgColor {
+			t.Errorf("got %q avgColor, want %q", imgNode.avgColor, avgColor)
+		}
+	}
+
+	t.Run("unchanged", func(t *testing.T) {
+		tree, err := generateAssetsTreeFromPrevious(assetsPath, nil, prev, false)
+		if err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+
+		checkImgNode(t, tree, 1, "#000000")
+	})
+
+	t.Run("another path", func(t *testing.T) {
+		tree, err := generateAssetsTreeFromPrevious("testdata/tree/ok/1", nil, prev, false)
+		if err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+
+		checkImgNode(t, tree, 1920, "")
+	})
+
+	t.Run("changed", func(t *testing.T) {
+		modTime := prevImgNode.modTime.Add(time.Hour)
+		if err := os.Chtimes(prevImgNode.path, modTime, modTime); err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+
+		tree, err := generateAssetsTreeFromPrevious(assetsPath, nil, prev, false)
+		if err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+
+		checkImgNode(t, tree, 1920, "")
+	})
+}
+
 func TestCompareAssetsTrees(t *testing.T) {
 	/*
 		dir1
@@ -1341,3 +1483,778 @@ func TestFindByRelPathInGATOrPAT(t *testing.T) {
 		})
 	}
 }
+
+func TestAssetNotFoundHint(t *testing.T) {
+	gat := &assetsTreeNode{t: DIRNODE, name: "assets", path: "gat"}
+	gat.addChild(FILENODE, "icon.png")
+
+	pat := &assetsTreeNode{t: DIRNODE, name: "assets", path: "pat"}
+	pat.addChild(DIRNODE, "imgs").addChild(FILENODE, "page.png")
+
+	tests := []struct {
+		relPath  AssetRelPath
+		gat, pat *assetsTreeNode
+		expected string
+	}{
+		{"/imgs/page.png", gat, pat, ", did you mean imgs/page.png, which is in the PAT?"},
+		{"icon.png", gat, pat, ", did you mean /icon.png, which is in the GAT?"},
+		{"/missing.png", gat, pat, ""},
+		{"missing.png", gat, pat, ""},
+		{"/imgs/page.png", gat, nil, ""},
+		{"icon.png", nil, pat, ""},
+		{"", gat, pat, ""},
+	}
+
+	for i, test := range tests {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			if hint := assetNotFoundHint(test.gat, test.pat, test.relPath); hint != test.expected {
+				t.Errorf("got %q, want %q", hint, test.expected)
+			}
+		})
+	}
+}
+
+func TestProcessCSSFileNodes_noCSSFiles(t *testing.T) {
+	/*
+		assets
+			foo.txt
+			imgs
+				bar.css
+	*/
+	rootNode := &assetsTreeNode{
+		t:    DIRNODE,
+		name: "assets",
+		path: "assets",
+	}
+
+	rootNode.addChild(FILENODE, "foo.txt").setContent([]byte("foo"))
+	rootNode.addChild(DIRNODE, "imgs").addChild(FILENODE, "bar.css").setContent([]byte("a{color:red}"))
+
+	if err := rootNode.processCSSFileNodes(); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	if n := rootNode.findByRelPath("style.css"); n != nil {
+		t.Errorf("got %+v, want nil", n)
+	}
+}
+
+func TestProcessCSSFileNodes_interleavedSiblings(t *testing.T) {
+	/*
+		assets
+			a.css
+			b.txt
+			c.css
+			d.txt
+			e
+				g.css
+			f.css
+			z.txt
+	*/
+	rootNode := &assetsTreeNode{
+		t:    DIRNODE,
+		name: "assets",
+		path: "assets",
+	}
+
+	rootNode.addChild(FILENODE, "a.css").setContent([]byte("a{color:red}"))
+	rootNode.addChild(FILENODE, "b.txt").setContent([]byte("b"))
+	rootNode.addChild(FILENODE, "c.css").setContent([]byte("c{color:green}"))
+	rootNode.addChild(FILENODE, "d.txt").setContent([]byte("d"))
+	rootNode.addChild(DIRNODE, "e").addChild(FILENODE, "g.css").setContent([]byte("g{color:#fff}"))
+	rootNode.addChild(FILENODE, "f.css").setContent([]byte("f{color:blue}"))
+	rootNode.addChild(FILENODE, "z.txt").setContent([]byte("z"))
+
+	if err := rootNode.processCSSFileNodes(); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	expectedNames := []string{"b.txt", "d.txt", "e", "style.css", "z.txt"}
+
+	var names []string
+	var lastNode *assetsTreeNode
+
+	for c := rootNode.firstChild; c != nil; c = c.next {
+		if c.previous != lastNode {
+			t.Errorf("%v previous is %p, want %p", c.name, c.previous, lastNode)
+		}
+
+		if c.parent != rootNode {
+			t.Errorf("%v parent is %p, want %p", c.name, c.parent, rootNode)
+		}
+
+		names = append(names, c.name)
+		lastNode = c
+	}
+
+	if !reflect.DeepEqual(names, expectedNames) {
+		t.Errorf("got %v, want %v", names, expectedNames)
+	}
+
+	if n := rootNode.findByRelPath("e/g.css"); n == nil {
+		t.Error("e/g.css should not have been removed")
+	}
+
+	styleNode := rootNode.findByRelPath("style.css")
+	if styleNode == nil {
+		t.Fatal("style.css not found")
+	}
+
+	expectedContent := "a{color:red}c{color:green}f{color:blue}"
+	if string(styleNode.content) != expectedContent {
+		t.Errorf("got %v, want %v", string(styleNode.content), expectedContent)
+	}
+}
+
+func TestProcess_flatImgs(t *testing.T) {
+	tree, err := generateAssetsTree("testdata/tree/ok/1", nil)
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	outDirPath := t.TempDir()
+
+	err = tree.process(outDirPath, false, &assetsProcessingConfig{flatImgs: true})
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	imgNode := tree.findByRelPath("imgs/red.png")
+	if imgNode == nil {
+		t.Fatal("imgs/red.png not found")
+	}
+
+	content, err := imgNode.getContent()
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	md5HashBs := md5.Sum(content)
+	md5Hash := hex.EncodeToString(md5HashBs[:])
+
+	expectedRelPath := "imgs/red-" + md5Hash + "-1920.png"
+	if _, err := os.Stat(path.Join(outDirPath, expectedRelPath)); err != nil {
+		t.Errorf("unexpected err: %v", err)
+	}
+
+	if _, err := os.Stat(path.Join(outDirPath, "imgs", md5Hash)); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("got %v, want %v", err, fs.ErrNotExist)
+	}
+
+	expectedLink := "/assets/" + expectedRelPath
+	if link := imgNode.assetLink("", nil); link != expectedLink {
+		t.Errorf("got %v, want %v", link, expectedLink)
+	}
+}
+
+func TestProcess_nestedAddedImg(t *testing.T) {
+	tree, err := generateAssetsTree("testdata/tree/ok/1", nil)
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	content, err := os.ReadFile("testdata/tree/ok/1/imgs/red.png")
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	imgNode := tree.addChild(DIRNODE, "new").addChild(DIRNODE, "deep").addChild(IMGNODE, "green.png")
+	imgNode.content = content
+	imgNode.sizes = []*assetsTreeNodeImgSize{
+		{
+			original: true,
+			width:    1920,
+		},
+	}
+
+	// outDirPath doesn't exist yet.
+	outDirPath := path.Join(t.TempDir(), "out")
+
+	if err := tree.process(outDirPath, false, nil); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	md5HashBs := md5.Sum(content)
+	md5Hash := hex.EncodeToString(md5HashBs[:])
+
+	if _, err := os.Stat(path.Join(outDirPath, "new", "deep", md5Hash, "1920.png")); err != nil {
+		t.Errorf("unexpected err: %v", err)
+	}
+}
+
+func TestProcess_imgFormats(t *testing.T) {
+	for _, format := range []string{pngImgFormat, webpImgFormat} {
+		t.Run(format, func(t *testing.T) {
+			inDirPath := t.TempDir()
+
+			img := image.NewRGBA(image.Rect(0, 0, 40, 20))
+			for x := 0; x < 40; x++ {
+				for y := 0; y < 20; y++ {
+					img.Set(x, y, color.RGBA{R: 255, A: 255})
+				}
+			}
+
+			f, err := os.Create(path.Join(inDirPath, "red.jpg"))
+			if err != nil {
+				t.Fatalf("unexpected err: %v", err)
+			}
+
+			if err := jpeg.Encode(f, img, nil); err != nil {
+				t.Fatalf("unexpected err: %v", err)
+			}
+			f.Close()
+
+			tree, err := generateAssetsTree(inDirPath, nil)
+			if err != nil {
+				t.Fatalf("unexpected err: %v", err)
+			}
+
+			imgNode := tree.findByRelPath("red.jpg")
+			imgNode.addSizes(20)
+
+			outDirPath := t.TempDir()
+
+			err = tree.process(outDirPath, false, &assetsProcessingConfig{imgFormats: []string{format}})
+			if err != nil {
+				t.Fatalf("unexpected err: %v", err)
+			}
+
+			var files []string
+
+			err = fs.WalkDir(os.DirFS(outDirPath), ".", func(p string, d fs.DirEntry, err error) error {
+				if err != nil {
+					return err
+				}
+
+				if !d.IsDir() {
+					files = append(files, p)
+				}
+
+				return nil
+			})
+			if err != nil {
+				t.Fatalf("unexpected err: %v", err)
+			}
+
+			if len(files) != 2 {
+				t.Errorf("got %v, want 2 files", files)
+			}
+
+			ext := imgFormatExts[format]
+
+			for _, file := range files {
+				if path.Ext(file) != ext {
+					t.Errorf("got %v, want only %v files", file, ext)
+				}
+
+				width, _, err := imgDimensions(path.Join(outDirPath, file))
+				if err != nil {
+					t.Errorf("unexpected err for %v: %v", file, err)
+				}
+
+				if expected := strings.TrimSuffix(path.Base(file), ext); strconv.Itoa(width) != expected {
+					t.Errorf("got %v width for %v, want %v", width, file, expected)
+				}
+			}
+
+			if link := imgNode.assetLink("", nil); path.Ext(link) != ext {
+				t.Errorf("got %v, want a %v link", link, ext)
+			}
+
+			if srcset := imgNode.generateSrcSetValue(""); strings.Contains(srcset, ".jpg") {
+				t.Errorf("got %v, want no .jpg in srcset", srcset)
+			}
+		})
+	}
+}
+
+func TestProcessSizes_concurrent(t *testing.T) {
+	tree, err := generateAssetsTree("testdata/tree/ok/1", nil)
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	if err := tree.process(t.TempDir(), false, nil); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	imgNode := tree.findByRelPath("imgs/red.png")
+
+	var wg sync.WaitGroup
+	srcsets := make([]string, 8)
+	errs := make([]error, len(srcsets))
+
+	for i := range srcsets {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			imgNode.mu.Lock()
+			imgNode.addSizes(100, 200)
+			imgNode.mu.Unlock()
+
+			errs[i] = imgNode.processSizes(nil)
+
+			imgNode.mu.Lock()
+			srcsets[i] = imgNode.generateSrcSetValue("")
+			imgNode.mu.Unlock()
+		}()
+	}
+
+	wg.Wait()
+
+	for i := range srcsets {
+		if errs[i] != nil {
+			t.Fatalf("unexpected err: %v", errs[i])
+		}
+
+		for _, width := range []int{100, 200} {
+			if !strings.Contains(srcsets[i], fmt.Sprintf(" %vw", width)) {
+				t.Errorf("got %v, want a %vw size in srcset", srcsets[i], width)
+			}
+		}
+	}
+}
+
+func TestVerifyProcessedFiles(t *testing.T) {
+	tree, err := generateAssetsTree("testdata/tree/ok/1", nil)
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	outDirPath := t.TempDir()
+
+	if err := tree.process(outDirPath, false, nil); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	imgNode := tree.findByRelPath("imgs/red.png")
+	imgNode.addSizes(100)
+	if err := imgNode.processSizes(nil); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	// a size that isn't processed isn't linked, so it isn't verified.
+	imgNode.addSizes(200)
+
+	if errs := tree.verifyProcessedFiles(); len(errs) != 0 {
+		t.Fatalf("got %v, want no errors", errs)
+	}
+
+	fileNode := tree.findByRelPath("foo.txt")
+	removedPaths := []string{
+		fileNode.processedPath,
+		imgNode.generateSizeProcessedPath(false, imgNode.findSize(100)),
+	}
+
+	for _, p := range removedPaths {
+		if err := os.Remove(p); err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+	}
+
+	errs := tree.verifyProcessedFiles()
+	if len(errs) != len(removedPaths) {
+		t.Fatalf("got %v, want %v errors", errs, len(removedPaths))
+	}
+
+	for i, p := range removedPaths {
+		if !strings.Contains(errs[i].Error(), p) {
+			t.Errorf("got %v, want it to contain %v", errs[i], p)
+		}
+	}
+}
+
+func TestGenerateSizeFormatProcessedPath(t *testing.T) {
+	size := &assetsTreeNodeImgSize{width: 800}
+
+	tests := []struct {
+		flat, namedSizes bool
+		format           string
+		expected         string
+	}{
+		{false, false, originalImgFormat, "imgs/abc/800.jpg"},
+		{false, false, "png", "imgs/abc/800.png"},
+		{false, true, originalImgFormat, "imgs/abc/photo-800.jpg"},
+		{false, true, "png", "imgs/abc/photo-800.png"},
+		{true, false, originalImgFormat, "imgs/photo-abc-800.jpg"},
+		{true, true, "png", "imgs/photo-abc-800.png"},
+	}
+
+	for i, test := range tests {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			n := &assetsTreeNode{
+				t:                IMGNODE,
+				name:             "photo.jpg",
+				processedRelPath: "imgs/abc",
+				flat:             test.flat,
+				namedSizes:       test.namedSizes,
+			}
+			if test.flat {
+				n.processedRelPath = "imgs/photo-abc"
+			}
+
+			if got := n.generateSizeFormatProcessedPath(true, size, test.format); got != test.expected {
+				t.Errorf("got %v, want %v", got, test.expected)
+			}
+		})
+	}
+}
+
+func TestProcess_namedImgSizes(t *testing.T) {
+	tree, err := generateAssetsTree("testdata/tree/ok/1", nil)
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	outDirPath := t.TempDir()
+
+	err = tree.process(outDirPath, false, &assetsProcessingConfig{namedImgSizes: true})
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	imgNode := tree.findByRelPath("imgs/red.png")
+	imgNode.addSizes(100)
+	if err := imgNode.processSizes(nil); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	content, err := imgNode.getContent()
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	md5HashBs := md5.Sum(content)
+	md5Hash := hex.EncodeToString(md5HashBs[:])
+
+	for _, name := range []string{"red-1920.png", "red-100.png"} {
+		if _, err := os.Stat(path.Join(outDirPath, "imgs", md5Hash, name)); err != nil {
+			t.Errorf("unexpected err: %v", err)
+		}
+	}
+
+	expectedLink := "/assets/imgs/" + md5Hash + "/red-1920.png"
+	if link := imgNode.assetLink("", nil); link != expectedLink {
+		t.Errorf("got %v, want %v", link, expectedLink)
+	}
+
+	expectedSrcSet := "/assets/imgs/" + md5Hash + "/red-100.png 100w, " + expectedLink + " 1920w"
+	if srcset := imgNode.generateSrcSetValue(""); srcset != expectedSrcSet {
+		t.Errorf("got %v, want %v", srcset, expectedSrcSet)
+	}
+}
+
+func TestAssetsProcessingConfig_responsiveWidths(t *testing.T) {
+	tests := []struct {
+		pc       *assetsProcessingConfig
+		expected []int
+	}{
+		{nil, []int{425, 640, 960}},
+		{&assetsProcessingConfig{}, []int{425, 640, 960}},
+		{&assetsProcessingConfig{highDPI: true}, []int{425, 640, 850, 960, 1280, 1920}},
+	}
+
+	for i, test := range tests {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			if got := test.pc.responsiveWidths([]int{425, 640, 960}); !reflect.DeepEqual(got, test.expected) {
+				t.Errorf("got %v, want %v", got, test.expected)
+			}
+		})
+	}
+}
+
+func TestAddSizes_highDPI(t *testing.T) {
+	tree, err := generateAssetsTree("testdata/tree/ok/1", nil)
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	pc := &assetsProcessingConfig{highDPI: true}
+
+	if err := tree.process(t.TempDir(), false, pc); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	// red.png is 1920px wide, so the double of 1280 is capped at the original size.
+	imgNode := tree.findByRelPath("imgs/red.png")
+	imgNode.addSizes(pc.responsiveWidths([]int{425, 960, 1280})...)
+
+	if err := imgNode.processSizes(pc); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	var widths []int
+	for _, size := range imgNode.sizes {
+		widths = append(widths, size.width)
+	}
+
+	sort.Ints(widths)
+
+	if expected := []int{425, 850, 960, 1280, 1920}; !reflect.DeepEqual(widths, expected) {
+		t.Errorf("got %v widths, want %v", widths, expected)
+	}
+
+	srcset := imgNode.generateSrcSetValue("")
+	for _, descriptor := range []string{" 425w", " 850w", " 960w", " 1280w", " 1920w"} {
+		if !strings.Contains(srcset, descriptor) {
+			t.Errorf("got %v, want it to contain %v", srcset, descriptor)
+		}
+	}
+}
+
+func TestProcess_computeImgColors(t *testing.T) {
+	tree, err := generateAssetsTree("testdata/tree/ok/1", nil)
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	err = tree.process(t.TempDir(), false, &assetsProcessingConfig{computeImgColors: true})
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	imageColor := generateImageColorFn(tree, nil)
+
+	tests := []struct {
+		assetPath AssetRelPath
+		expected  string
+	}{
+		{"/imgs/red.png", "#ff0000"},
+		{"/foo.txt", ""},
+		{"/bar.png", ""},
+	}
+
+	for _, test := range tests {
+		if got := imageColor(test.assetPath); got != test.expected {
+			t.Errorf("got %q for %v, want %q", got, test.assetPath, test.expected)
+		}
+	}
+}
+
+func TestProcess_originalImgs(t *testing.T) {
+	tests := []struct {
+		pc *assetsProcessingConfig
+		// paths are relative to the directory of the img and don't include its md5 hash,
+		// which replaces the %v in them.
+		expectedFiles                      []string
+		expectedOriginalLink, expectedLink string
+	}{
+		{
+			&assetsProcessingConfig{originalImgs: true},
+			[]string{"%v/red.png", "%v/100.png"},
+			"%v/red.png",
+			"%v/red.png",
+		},
+		{
+			&assetsProcessingConfig{originalImgs: true, imgFormats: []string{"jpeg"}},
+			[]string{"%v/red.png", "%v/100.jpg", "%v/1920.jpg"},
+			"%v/red.png",
+			"%v/1920.jpg",
+		},
+		{
+			&assetsProcessingConfig{originalImgs: true, flatImgs: true},
+			[]string{"red-%v.png", "red-%v-100.png"},
+			"red-%v.png",
+			"red-%v.png",
+		},
+	}
+
+	for i, test := range tests {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			tree, err := generateAssetsTree("testdata/tree/ok/1", nil)
+			if err != nil {
+				t.Fatalf("unexpected err: %v", err)
+			}
+
+			outDirPath := t.TempDir()
+
+			if err := tree.process(outDirPath, false, test.pc); err != nil {
+				t.Fatalf("unexpected err: %v", err)
+			}
+
+			imgNode := tree.findByRelPath("imgs/red.png")
+			imgNode.addSizes(100)
+			if err := imgNode.processSizes(test.pc); err != nil {
+				t.Fatalf("unexpected err: %v", err)
+			}
+
+			content, err := imgNode.getContent()
+			if err != nil {
+				t.Fatalf("unexpected err: %v", err)
+			}
+
+			md5HashBs := md5.Sum(content)
+			md5Hash := hex.EncodeToString(md5HashBs[:])
+
+			// every file in the directory of the img is expected, so that no extra one,
+			// e.g. a size in the wrong format, goes unnoticed.
+			var files []string
+			err = fs.WalkDir(os.DirFS(path.Join(outDirPath, "imgs")), ".", func(p string, d fs.DirEntry, err error) error {
+				if err == nil && !d.IsDir() {
+					files = append(files, p)
+				}
+
+				return err
+			})
+			if err != nil {
+				t.Fatalf("unexpected err: %v", err)
+			}
+
+			var expectedFiles []string
+			for _, f := range test.expectedFiles {
+				expectedFiles = append(expectedFiles, fmt.Sprintf(f, md5Hash))
+			}
+
+			sort.Strings(files)
+			sort.Strings(expectedFiles)
+
+			if !reflect.DeepEqual(files, expectedFiles) {
+				t.Errorf("got %v files, want %v", files, expectedFiles)
+			}
+
+			originalContent, err := os.ReadFile(path.Join(outDirPath, "imgs", fmt.Sprintf(test.expectedOriginalLink, md5Hash)))
+			if err != nil {
+				t.Fatalf("unexpected err: %v", err)
+			}
+
+			if !bytes.Equal(originalContent, content) {
+				t.Error("expected the original file to have the content of the img")
+			}
+
+			if link, expected := imgNode.originalAssetLink(""), "/assets/imgs/"+fmt.Sprintf(test.expectedOriginalLink, md5Hash); link != expected {
+				t.Errorf("got %v original link, want %v", link, expected)
+			}
+
+			if link, expected := imgNode.assetLink("", nil), "/assets/imgs/"+fmt.Sprintf(test.expectedLink, md5Hash); link != expected {
+				t.Errorf("got %v link, want %v", link, expected)
+			}
+
+			if errs := tree.verifyProcessedFiles(); len(errs) > 0 {
+				t.Errorf("unexpected errs: %v", errs)
+			}
+		})
+	}
+}
+
+func TestProcess_minifiedExts(t *testing.T) {
+	files := map[string]string{
+		"data.json": "{\n  \"name\": \"foo\",\n  \"tags\": [ \"a\", \"b\" ]\n}\n",
+		"icon.SVG":  "<svg xmlns=\"http://www.w3.org/2000/svg\">\n  <!-- an icon -->\n  <rect   width=\"10\" height=\"10\" />\n</svg>\n",
+		"note.txt":  "  some   text  \n",
+	}
+
+	tests := []struct {
+		pc       *assetsProcessingConfig
+		expected map[string]string
+	}{
+		{nil, files},
+		{
+			&assetsProcessingConfig{minifiedExts: map[string]string{".json": "json", ".svg": "svg"}},
+			map[string]string{
+				"data.json": `{"name":"foo","tags":["a","b"]}`,
+				"icon.SVG":  `<svg xmlns="http://www.w3.org/2000/svg"><rect width="10" height="10"/></svg>`,
+				"note.txt":  files["note.txt"],
+			},
+		},
+	}
+
+	for i, test := range tests {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			inPath := t.TempDir()
+
+			for name, content := range files {
+				if err := os.WriteFile(path.Join(inPath, name), []byte(content), 0644); err != nil {
+					t.Fatalf("unexpected err: %v", err)
+				}
+			}
+
+			tree, err := generateAssetsTree(inPath, nil)
+			if err != nil {
+				t.Fatalf("unexpected err: %v", err)
+			}
+
+			if err := tree.process(t.TempDir(), false, test.pc); err != nil {
+				t.Fatalf("unexpected err: %v", err)
+			}
+
+			for name, expected := range test.expected {
+				n := tree.findByRelPath(name)
+
+				content, err := os.ReadFile(n.processedPath)
+				if err != nil {
+					t.Fatalf("unexpected err: %v", err)
+				}
+
+				if string(content) != expected {
+					t.Errorf("got %q for %v, want %q", content, name, expected)
+				}
+
+				// the md5 hash in the name of the file is the one of its written content.
+				md5HashBs := md5.Sum(content)
+				if md5Hash := hex.EncodeToString(md5HashBs[:]); !strings.Contains(n.processedRelPath, md5Hash) {
+					t.Errorf("got %v for %v, want it to contain %v", n.processedRelPath, name, md5Hash)
+				}
+			}
+		})
+	}
+}
+
+func TestImgDimensions_webp(t *testing.T) {
+	width, height, err := imgDimensions("testdata/img/blue-purple-pink.webp")
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	if width != 150 || height != 100 {
+		t.Errorf("got %vx%v, want 150x100", width, height)
+	}
+
+	file, err := os.Open("testdata/img/blue-purple-pink.webp")
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	defer file.Close()
+
+	img, format, err := image.Decode(file)
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	if format != "webp" || img.Bounds().Dx() != 150 {
+		t.Errorf("got a %v img %v wide, want a webp one 150 wide", format, img.Bounds().Dx())
+	}
+}
+
+func TestResizeImg_quality(t *testing.T) {
+	for _, format := range []string{jpegImgFormat, pngImgFormat} {
+		t.Run(format, func(t *testing.T) {
+			resizedByPreset := make(map[string][]byte, len(imgQualityPresets))
+
+			for preset, quality := range imgQualityPresets {
+				resized, err := resizeImg(100, "testdata/img/blue-purple-pink.webp", format, quality)
+				if err != nil {
+					t.Fatalf("unexpected err: %v", err)
+				}
+
+				img, decodedFormat, err := image.Decode(bytes.NewReader(resized))
+				if err != nil {
+					t.Fatalf("unexpected err: %v", err)
+				}
+
+				if decodedFormat != format || img.Bounds().Dx() != 100 || img.Bounds().Dy() != 67 {
+					t.Errorf("got a %v img of %vx%v with %v, want a %v one of 100x67", decodedFormat, img.Bounds().Dx(), img.Bounds().Dy(), preset, format)
+				}
+
+				for otherPreset, otherResized := range resizedByPreset {
+					if bytes.Equal(resized, otherResized) {
+						t.Errorf("expected %v and %v to produce different output", preset, otherPreset)
+					}
+				}
+
+				resizedByPreset[preset] = resized
+			}
+		})
+	}
+}
@@ -1,6 +1,11 @@
 package egen
 
-import "github.com/russross/blackfriday/v2"
+import (
+	"bytes"
+	"html"
+
+	"github.com/russross/blackfriday/v2"
+)
 
 func findBFNodeIndex(node *blackfriday.Node, parent *blackfriday.Node) int {
 	children := getBFNodeChildren(parent)
@@ -32,3 +37,53 @@ func getBFNodeChildren(n *blackfriday.Node) []*blackfriday.Node {
 
 	return children
 }
+
+// isBFBlockNode reports whether n is a block, as opposed to an inline element.
+func isBFBlockNode(n *blackfriday.Node) bool {
+	switch n.Type {
+	case blackfriday.Document, blackfriday.BlockQuote, blackfriday.List, blackfriday.Item,
+		blackfriday.Paragraph, blackfriday.Heading, blackfriday.HorizontalRule, blackfriday.CodeBlock,
+		blackfriday.HTMLBlock, blackfriday.Table, blackfriday.TableHead, blackfriday.TableBody,
+		blackfriday.TableRow, blackfriday.TableCell:
+		return true
+	}
+
+	return false
+}
+
+// bfLinkFlags returns the flags of the html renderer for links, which make absolute
+// links open in a new tab if targetBlank is true.
+func bfLinkFlags(targetBlank bool) blackfriday.HTMLFlags {
+	if !targetBlank {
+		return blackfriday.HTMLFlagsNone
+	}
+
+	return blackfriday.HrefTargetBlank | blackfriday.NoreferrerLinks
+}
+
+// renderBFInline renders md keeping only its inline elements, e.g. emphasis, links
+// and code spans. Raw html is escaped and unsafe links aren't rendered as links, so
+// that the output is safe to be used as html. Links open in a new tab if targetBlank is true.
+func renderBFInline(md []byte, targetBlank bool) []byte {
+	var buff bytes.Buffer
+
+	r := blackfriday.NewHTMLRenderer(blackfriday.HTMLRendererParameters{
+		Flags: bfLinkFlags(targetBlank) | blackfriday.Safelink,
+	})
+
+	rootNode := blackfriday.New(blackfriday.WithExtensions(blackfriday.CommonExtensions)).Parse(md)
+	rootNode.Walk(func(n *blackfriday.Node, entering bool) blackfriday.WalkStatus {
+		switch n.Type {
+		case blackfriday.Text, blackfriday.Emph, blackfriday.Strong, blackfriday.Del,
+			blackfriday.Link, blackfriday.Code, blackfriday.Softbreak, blackfriday.Hardbreak:
+			return r.RenderNode(&buff, n, entering)
+		case blackfriday.HTMLSpan, blackfriday.HTMLBlock, blackfriday.CodeBlock:
+			buff.WriteString(html.EscapeString(string(n.Literal)))
+		}
+
+		// Other nodes, e.g. paragraphs and imgs, only have their children rendered.
+		return blackfriday.GoToNext
+	})
+
+	return bytes.TrimSpace(buff.Bytes())
+}
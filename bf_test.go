@@ -0,0 +1,28 @@
+package egen
+
+import "testing"
+
+func TestRenderBFInline(t *testing.T) {
+	tests := []struct {
+		md, expected string
+	}{
+		{"plain", "plain"},
+		{"a *b* **c** `d`", "a <em>b</em> <strong>c</strong> <code>d</code>"},
+		{"[foo](https://foo.bar)", `<a href="https://foo.bar" target="_blank" rel="noreferrer">foo</a>`},
+		{"[foo](javascript:alert)", "<tt>foo</tt>"},
+		{"<script>alert(1)</script>", "&lt;script&gt;alert(1)&lt;/script&gt;"},
+		{`a <img src=x onerror="alert(1)"> b`, "a &lt;img src=x onerror=&#34;alert(1)&#34;&gt; b"},
+		{"# heading", "heading"},
+		{"![alt](foo.png)", "alt"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.md, func(t *testing.T) {
+			got := string(renderBFInline([]byte(test.md), true))
+
+			if got != test.expected {
+				t.Errorf("got %q, want %q", got, test.expected)
+			}
+		})
+	}
+}
@@ -5,253 +5,1694 @@ import (
 	"errors"
 	"fmt"
 	"html/template"
+	"io"
+	"io/fs"
+	"log/slog"
 	"os"
 	"path"
+	"runtime"
+	"slices"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/alecthomas/chroma"
 	chromaHTML "github.com/alecthomas/chroma/formatters/html"
 	"github.com/alecthomas/chroma/styles"
+	"github.com/efreitasn/egen/internal/limiter"
+	"github.com/efreitasn/egen/internal/logs"
+	"github.com/tdewolff/minify/v2"
 )
 
 // BuildConfig is the config used to build a blog.
 type BuildConfig struct {
 	InPath, OutPath string
-	TemplateFuncs   template.FuncMap
-	ChromaStyle     *chroma.Style
+	// TemplateFuncs are funcs available in every template. Since the pages of each lang are
+	// executed in parallel, they must be safe for concurrent use.
+	TemplateFuncs template.FuncMap
+	ChromaStyle   *chroma.Style
+	// WarnLargeImages is whether a warning should be emitted for each image whose
+	// width exceeds the largest responsive size by LargeImagesFactor.
+	WarnLargeImages bool
+	// LargeImagesFactor is the factor used by WarnLargeImages. If it's 0,
+	// defaultLargeImagesFactor is used.
+	LargeImagesFactor float64
+	// FlatAssets is whether the sizes of an image are written as
+	// <name>-<md5sum>-<width>.<ext> in the image's directory instead of
+	// as <width>.<ext> in a directory named <md5sum>.
+	FlatAssets bool
+	// NamedImageSizes is whether the sizes of an image are written as
+	// <name>-<width>.<ext>, where <name> is the image's name without its extension,
+	// instead of as <width>.<ext>. It has no effect if FlatAssets is set, since their
+	// names already start with it.
+	NamedImageSizes bool
+	// MinifyHTMLOptions are the options used when minifying the HTML of each page. If it's nil,
+	// all of the options are set to true.
+	MinifyHTMLOptions *MinifyHTMLOptions
+	// AtomicOutput is whether the blog is built into a temporary directory that replaces
+	// OutPath only if the build succeeds. This way, OutPath is never empty or left with
+	// partial content while building.
+	AtomicOutput bool
+	// Keep is a list of glob patterns, as in path.Match, of paths relative to OutPath that
+	// aren't deleted when cleaning OutPath before building. If a directory matches one of
+	// them, the directory and all of its contents are kept. Files generated by the build take
+	// precedence over the kept ones with the same paths, with or without AtomicOutput.
+	Keep []string
+	// SkipEmptyPosts is whether posts without any content file, e.g. ones whose directory
+	// has just been created, are skipped with a warning instead of failing the build. Posts
+	// missing only some of the content files still fail it.
+	SkipEmptyPosts bool
+	// Now returns the current time. It's used by the now and currentYear template funcs.
+	// If it's nil, time.Now is used.
+	Now func() time.Time
+	// Shortcodes are the shortcodes that can be used in the content of a post, keyed by name.
+	Shortcodes map[string]Shortcode
+	// VerifyOutput is whether, after building, it's checked that every file referenced by
+	// the links of the assets, e.g. the sizes of an img in a srcset, exists. If any of them
+	// doesn't, the build fails with an error listing all of them.
+	VerifyOutput bool
+	// Concurrency is the maximum number of tasks, e.g. the building of the pages of a lang,
+	// that run at the same time during a build. Setting it to 1 makes builds sequential.
+	// If it's 0, runtime.NumCPU() is used.
+	Concurrency int
+	// DryRun is whether the blog is built into a temporary directory that's deleted
+	// afterwards, so that OutPath isn't changed, in order to report, through
+	// Builder.Result, the files that would be written to it.
+	DryRun bool
+	// OnlyLangs are the tags of the langs whose pages are built, e.g. to speed up previews.
+	// If it's empty, the pages of every lang are built. The posts in the other langs aren't
+	// rendered, nor are they in the json and search indexes. Alternate links still
+	// reference every lang, so that they're valid once the whole blog is deployed, unless
+	// LimitAlternateLinks is set.
+	OnlyLangs []string
+	// LimitAlternateLinks is whether alternate links only reference the langs in OnlyLangs.
+	LimitAlternateLinks bool
+	// PostProcessHTML, if set, is called with the minified html of each page, along with
+	// its TemplateData.Page and TemplateData.Lang, and returns the html that's written in
+	// its place, e.g. with an analytics snippet. The root page is passed as "root", along
+	// with the default lang. An error aborts the build. Since the pages
+	// of each lang are built in parallel, it must be safe for concurrent use.
+	PostProcessHTML func(page string, lang *Lang, html []byte) ([]byte, error)
+	// DirPerm is the permission of the directories created in OutPath, before the umask is
+	// applied. It defaults to os.ModePerm.
+	DirPerm os.FileMode
+	// FilePerm is the permission of the files written to OutPath, before the umask is
+	// applied. It defaults to 0666, as in os.Create.
+	FilePerm os.FileMode
+	// Env is the name of the environment the blog is built for, e.g. dev, which templates
+	// can read through TemplateData.Env and the isProd template func, e.g. to include
+	// analytics only in production. It defaults to production.
+	Env string
+	// Logger is where the non-fatal issues found while building are reported to, e.g. posts
+	// skipped by SkipEmptyPosts, as warnings whose attrs identify what they're about, e.g. the
+	// post. It defaults to a logger that writes them to stderr.
+	Logger *slog.Logger
+	// preGATProc, if set, is called with the GAT right before it's processed, so that nodes
+	// can be added to it programmatically. An error aborts the build.
+	preGATProc func(gat *assetsTreeNode) error
 }
 
+// BuildResult is the result of a dry run.
+type BuildResult struct {
+	// Files are the files that would be written to OutPath, sorted by path.
+	Files []OutputFile
+}
+
+// OutputFile is a file written to OutPath.
+type OutputFile struct {
+	// Path is the path of the file relative to OutPath, with segments separated by /.
+	Path string
+	Size int64
+}
+
+var defaultLargeImagesFactor = 2.0
+
+// productionEnv is the default BuildConfig.Env, for which the isProd template func
+// returns true.
+const productionEnv = "production"
+
 // Build builds the blog.
 func Build(bc BuildConfig) error {
+	b, err := NewBuilder(bc)
+	if err != nil {
+		return err
+	}
+
+	return b.Build()
+}
+
+// Builder builds a blog. The config file, the data dir and the templates are read when
+// the Builder is created, so that they're not parsed again by each Build, e.g. while
+// watching InPath. It also keeps what's generated by its last Build, e.g. the global
+// assets tree (GAT) and the posts lists, so that the pages of a single post can be
+// rebuilt through BuildPost.
+type Builder struct {
+	bc BuildConfig
+
+	// the fields below are set by NewBuilder and Reload.
+	c            *config
+	data         map[string]interface{}
+	pc           *assetsProcessingConfig
+	chromaCSS    []byte
+	style        urlStyle
+	htmlMinifier *minify.M
+	// langs are the langs whose pages are built and alternateLinksLangs are the ones
+	// referenced by alternate links. See BuildConfig.OnlyLangs.
+	langs, alternateLinksLangs []*Lang
+	// pageTemplates are never executed, only cloned, since the funcs returned by
+	// generateBuildTemplateFuncs are set for each Build.
+	pageTemplates *pageTemplates
+
+	// out is only set after a successful Build.
+	out *builderOutput
+	// prevGAT is the GAT generated by the last Build, even if it failed, from which the
+	// GAT of the next one is generated, so that unchanged imgs aren't decoded again.
+	prevGAT *assetsTreeNode
+	// result is only set after a successful dry run.
+	result *BuildResult
+	// limiter limits the tasks of every parallel phase of a build, as set by
+	// BuildConfig.Concurrency.
+	limiter *limiter.Limiter
+}
+
+// builderOutput is what's generated by a Build.
+type builderOutput struct {
+	outPath, assetsOutPath string
+	gat                    *assetsTreeNode
+	socialCards            *socialCardGenerator
+	postsLists             *generatePostsListsOutput
+	templates              *pageTemplates
+}
+
+// NewBuilder creates a Builder that builds the blog according to bc. It reads the config
+// file, the data dir and the templates in bc.InPath.
+func NewBuilder(bc BuildConfig) (*Builder, error) {
 	if bc.InPath == "" {
-		return errors.New("InPath not provided")
+		return nil, errors.New("InPath not provided")
 	}
 
 	if bc.OutPath == "" {
-		return errors.New("OutPath not provided")
+		return nil, errors.New("OutPath not provided")
 	}
 
-	// deletes bc.OutPath if it already exists
-	if _, err := os.Stat(bc.OutPath); err != nil {
-		if !os.IsNotExist(err) {
+	if bc.Concurrency < 0 {
+		return nil, errors.New("Concurrency can't be negative")
+	}
+
+	if bc.ChromaStyle == nil {
+		bc.ChromaStyle = styles.Get("swapoff")
+	}
+
+	if bc.Logger == nil {
+		bc.Logger = logs.New()
+	}
+
+	if bc.Env == "" {
+		bc.Env = productionEnv
+	}
+
+	if bc.DirPerm == 0 {
+		bc.DirPerm = defaultOutputPerms.dir
+	}
+
+	if bc.FilePerm == 0 {
+		bc.FilePerm = defaultOutputPerms.file
+	}
+
+	concurrency := bc.Concurrency
+	if concurrency == 0 {
+		concurrency = runtime.NumCPU()
+	}
+
+	b := Builder{bc: bc, limiter: limiter.New(concurrency)}
+
+	if err := b.load(); err != nil {
+		return nil, err
+	}
+
+	return &b, nil
+}
+
+// Reload reads the config file, the data dir and the templates again, e.g. after one of
+// them has changed. What's kept by the last Build is discarded, so BuildPost can't be
+// called until Build is called again, but the GAT is still generated from the previous
+// one. If it fails, b is left unchanged.
+func (b *Builder) Reload() error {
+	nb := Builder{bc: b.bc, prevGAT: b.prevGAT, limiter: b.limiter}
+
+	if err := nb.load(); err != nil {
+		return err
+	}
+
+	*b = nb
+
+	return nil
+}
+
+// Build builds the whole blog. If BuildConfig.AtomicOutput or BuildConfig.DryRun is set,
+// what's generated isn't kept, since it refers to the temporary directory the blog is built
+// into, so BuildPost can't be called afterwards.
+func (b *Builder) Build() error {
+	// what's kept by a previous Build is discarded, so that it's not used if this one fails.
+	b.out = nil
+	b.result = nil
+
+	// like with AtomicOutput, what's generated by a dry run isn't kept.
+	if b.bc.DryRun {
+		err := b.buildDryRun()
+		b.out = nil
+
+		return err
+	}
+
+	if b.bc.AtomicOutput {
+		err := b.buildAtomically()
+		b.out = nil
+
+		return err
+	}
+
+	if err := b.build(b.bc.OutPath); err != nil {
+		b.out = nil
+
+		return err
+	}
+
+	if err := b.writeOutputManifest(b.bc.OutPath); err != nil {
+		b.out = nil
+
+		return err
+	}
+
+	return nil
+}
+
+// Result returns the result of the last Build if it was a successful dry run, i.e. if
+// BuildConfig.DryRun is set, or nil otherwise.
+func (b *Builder) Result() *BuildResult {
+	return b.result
+}
+
+// buildDryRun builds the blog into a temporary directory, which is deleted afterwards,
+// and sets b.result with the files in it.
+func (b *Builder) buildDryRun() error {
+	tmpOutPath, err := os.MkdirTemp("", "egen-dry-run-*")
+	if err != nil {
+		return fmt.Errorf("creating temporary directory for dry run: %v", err)
+	}
+	defer os.RemoveAll(tmpOutPath)
+
+	if err := b.build(tmpOutPath); err != nil {
+		return err
+	}
+
+	if err := b.writeOutputManifest(tmpOutPath); err != nil {
+		return err
+	}
+
+	var result BuildResult
+
+	err = fs.WalkDir(os.DirFS(tmpOutPath), ".", func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
 			return err
 		}
-	} else {
-		err := os.RemoveAll(bc.OutPath)
+
+		info, err := d.Info()
 		if err != nil {
-			return fmt.Errorf("removing %v and its contents: %v", bc.OutPath, err)
+			return err
 		}
+
+		result.Files = append(result.Files, OutputFile{Path: p, Size: info.Size()})
+
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("listing the files of dry run: %v", err)
 	}
 
-	// creates bc.OutPath
-	err := os.Mkdir(bc.OutPath, os.ModeDir|os.ModePerm)
+	b.result = &result
+
+	return nil
+}
+
+// build builds the blog into outPath, setting b.out.
+func (b *Builder) build(outPath string) error {
+	bc := b.bc
+	c := b.c
+
+	// the post directories are read before anything is written, so that errors such as
+	// two of them having the same slug don't leave a partial output behind.
+	postDirs, err := readSectionsPostDirs(bc.InPath, c, bc.Logger)
 	if err != nil {
 		return err
 	}
 
-	// config file
-	c, err := readConfigFile(bc.InPath)
+	// deletes outPath if it already exists, except for the entries matching bc.Keep
+	if _, err := os.Stat(outPath); err != nil {
+		if !os.IsNotExist(err) {
+			return err
+		}
+	} else if len(bc.Keep) == 0 {
+		err := os.RemoveAll(outPath)
+		if err != nil {
+			return fmt.Errorf("removing %v and its contents: %v", outPath, err)
+		}
+	} else {
+		_, err := cleanDir(outPath, "", bc.Keep)
+		if err != nil {
+			return fmt.Errorf("cleaning %v: %v", outPath, err)
+		}
+	}
+
+	// creates outPath
+	err = os.MkdirAll(outPath, bc.DirPerm)
 	if err != nil {
 		return err
 	}
 
 	// assets in
-	assetsPath := path.Join(bc.InPath, "assets")
-	gat, err := generateAssetsTree(assetsPath, nil)
+	assetsPath := path.Join(bc.InPath, c.AssetsInDir)
+	gat, err := generateAssetsTreeFromPrevious(assetsPath, nil, b.prevGAT, c.UndecodableImagesAsFiles)
 	if err != nil {
 		return fmt.Errorf("reading %v: %v", assetsPath, err)
 	}
 
-	// chroma styles
-	var chromaStylesBuff bytes.Buffer
-
-	if bc.ChromaStyle == nil {
-		bc.ChromaStyle = styles.Get("swapoff")
-	}
-
-	if err := chromaHTML.New().WriteCSS(&chromaStylesBuff, bc.ChromaStyle); err != nil {
-		return err
-	}
+	b.prevGAT = gat
 
+	// chroma styles
 	chromaNode := gat.addChild(FILENODE, "chroma.css")
-	chromaNode.setContent(chromaStylesBuff.Bytes())
+	chromaNode.setContent(b.chromaCSS)
 
 	// assets out
-	assetsOutPath := path.Join(bc.OutPath, "assets")
+	assetsOutPath := path.Join(outPath, c.AssetsDir)
 
-	err = os.Mkdir(assetsOutPath, os.ModeDir|os.ModePerm)
+	err = os.MkdirAll(assetsOutPath, bc.DirPerm)
 	if err != nil {
 		return fmt.Errorf("creating %v: %v", assetsOutPath, err)
 	}
 
+	if bc.preGATProc != nil {
+		if err := bc.preGATProc(gat); err != nil {
+			return err
+		}
+	}
+
 	// process gat
 	err = gat.processCSSFileNodes()
 	if err != nil {
 		return err
 	}
 
-	err = gat.process(assetsOutPath, false)
+	err = gat.process(assetsOutPath, false, b.pc)
 	if err != nil {
 		return err
 	}
 
+	// social cards
+	var socialCards *socialCardGenerator
+
+	if c.GenerateSocialCards {
+		var bgImgPath string
+
+		if c.SocialCardImg != "" {
+			bgImgNode, _ := findByRelPathInGATOrPAT(gat, nil, c.SocialCardImg)
+			if bgImgNode == nil || bgImgNode.t != IMGNODE {
+				return fmt.Errorf("socialCardImg %v in config file isn't an img in the global assets", c.SocialCardImg)
+			}
+
+			bgImgPath = bgImgNode.path
+		}
+
+		socialCards, err = newSocialCardGenerator(c, bgImgPath)
+		if err != nil {
+			return err
+		}
+	}
+
 	// posts
 	postsLists, err := generatePostsLists(
 		generatePostsListsInput{
-			bc:            &bc,
+			bc:            &b.bc,
 			c:             c,
 			gat:           gat,
 			assetsOutPath: assetsOutPath,
+			pc:            b.pc,
+			socialCards:   socialCards,
+			langs:         b.langs,
 		},
+		postDirs,
 	)
 	if err != nil {
 		return err
 	}
 
-	// base template
-	baseTemplate, err := createBaseTemplateWithIncludes(
-		bc.TemplateFuncs,
-		path.Join(bc.InPath, "includes"),
-		postsLists.invisiblePostsByLangTag,
-		gat,
-		c.URL,
-		c.ResponsiveImgSizes,
-	)
+	// templates
+	templates, err := b.pageTemplates.clone()
 	if err != nil {
 		return err
 	}
 
-	pagesInPath := path.Join(bc.InPath, "pages")
+	templates.funcs(generateBuildTemplateFuncs(postsLists, gat, c.ResponsiveImgSizes, b.pc, b.style))
 
-	// home page
-	homePageTemplate, err := createPageTemplate(pagesInPath, baseTemplate, "home")
-	if err != nil {
-		return err
+	b.out = &builderOutput{
+		outPath:       outPath,
+		assetsOutPath: assetsOutPath,
+		gat:           gat,
+		socialCards:   socialCards,
+		postsLists:    postsLists,
+		templates:     templates,
 	}
 
-	// post page
-	postPageTemplate, err := createPageTemplate(pagesInPath, baseTemplate, "post")
-	if err != nil {
+	// executing templates per lang
+	if err := b.buildLangs(func(l *Lang, t *pageTemplates) error {
+		return b.buildLangPages(l, t)
+	}); err != nil {
 		return err
 	}
 
-	// 404 page
-	notFoundPageTemplate, err := createPageTemplate(pagesInPath, baseTemplate, "404")
-	if err != nil {
-		return err
-	}
+	// root page
+	if c.RootStrategy != defaultRootStrategy {
+		err := writeFileAtomic(path.Join(outPath, b.style.homeFilename()), bc.FilePerm, func(w io.Writer) error {
+			var buff bytes.Buffer
 
-	// executing templates per lang
-	for _, l := range c.Langs {
-		langOutPath := bc.OutPath
-		if !l.Default {
-			langOutPath = path.Join(langOutPath, l.Tag)
-			if err := os.Mkdir(langOutPath, os.ModeDir|os.ModePerm); err != nil {
+			mw := b.htmlMinifier.Writer("text/html", &buff)
+			if err := writeRootPage(mw, c, b.alternateLinksLangs, b.style); err != nil {
+				return err
+			}
+
+			if err := mw.Close(); err != nil {
 				return err
 			}
+
+			html := buff.Bytes()
+
+			// the root page isn't in any lang, so it's post-processed as the default one's.
+			if bc.PostProcessHTML != nil {
+				var err error
+
+				html, err = bc.PostProcessHTML(rootPageName, c.defaultLang, html)
+				if err != nil {
+					return fmt.Errorf("post-processing html: %w", err)
+				}
+			}
+
+			_, err := w.Write(html)
+
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("writing root page: %v", err)
 		}
+	}
 
-		// home page
-		homePageTemplateData := TemplateData{
-			Posts:                     postsLists.visiblePostsByLangTag[l.Tag],
-			Lang:                      l,
-			Author:                    c.Author,
-			Color:                     c.Color,
-			ResponsiveImgMediaQueries: c.ResponsiveImgMediaQueries,
-			Title:                     c.Title,
-			Description:               c.Description[l.Tag],
-			Page:                      "home",
-			Img:                       c.defaultImgByLangTag[l.Tag],
+	// json index
+	if c.JSONIndex {
+		err := writeFileAtomic(path.Join(outPath, jsonIndexFilename), bc.FilePerm, func(w io.Writer) error {
+			return writeJSONIndex(w, c, b.langs, postsLists)
+		})
+		if err != nil {
+			return fmt.Errorf("writing %v: %v", jsonIndexFilename, err)
+		}
+	}
+
+	// search index
+	if c.SearchIndex {
+		err := writeFileAtomic(path.Join(outPath, searchIndexFilename), bc.FilePerm, func(w io.Writer) error {
+			return writeSearchIndex(w, c, b.langs, postsLists)
+		})
+		if err != nil {
+			return fmt.Errorf("writing %v: %v", searchIndexFilename, err)
+		}
+	}
+
+	// passthrough dir
+	// it's optional, so it's only copied if it exists.
+	passthroughInPath := path.Join(bc.InPath, c.PassthroughDir)
+	if _, err := os.Stat(passthroughInPath); err == nil {
+		if err := checkPassthroughDir(passthroughInPath, outPath, bc.Keep); err != nil {
+			return err
+		}
+
+		if err := copyDirRec(passthroughInPath, outPath, b.pc.outputPerms()); err != nil {
+			return fmt.Errorf("copying %v: %v", passthroughInPath, err)
 		}
+	} else if !os.IsNotExist(err) {
+		return err
+	}
 
-		homePageTemplateData.AlternateLinks = generateAlternateLinks(nil, nil, c.Langs)
+	// headers
+	// it's written after the passthrough dir is copied, so that its html pages are included.
+	if c.Headers {
+		pagesURLs, err := findPagesURLs(outPath, c.TrailingSlash)
+		if err != nil {
+			return fmt.Errorf("finding pages in %v: %v", outPath, err)
+		}
 
-		if l.Default {
-			homePageTemplateData.URL = "/"
-		} else {
-			homePageTemplateData.URL = "/" + l.Tag
+		err = writeConfigOutFile(outPath, headersFilename, "headers", bc.FilePerm, func(w io.Writer) error {
+			return writeHeaders(w, c.AssetsDir, pagesURLs)
+		})
+		if err != nil {
+			return err
 		}
+	}
 
-		err := executeMinifyAndWriteTemplate(homePageTemplate, homePageTemplateData, path.Join(langOutPath, "index.html"))
+	// redirects
+	if len(c.Redirects) > 0 {
+		err := writeConfigOutFile(outPath, redirectsFilename, "redirects", bc.FilePerm, func(w io.Writer) error {
+			return writeRedirects(w, c, b.style, postsLists)
+		})
 		if err != nil {
 			return err
 		}
+	}
 
-		// 404 page
-		// only execute the 404 page's template if it's the default language.
-		if l.Default {
-			notFoundPageTemplateData := TemplateData{
-				Color:                     c.Color,
-				Author:                    c.Author,
-				Description:               c.Description[l.Tag],
-				Img:                       c.defaultImgByLangTag[l.Tag],
-				Lang:                      l,
-				Page:                      "404",
-				Posts:                     postsLists.visiblePostsByLangTag[l.Tag],
-				Title:                     fmt.Sprintf("Not found - %v", c.Title),
-				ResponsiveImgMediaQueries: c.ResponsiveImgMediaQueries,
-				URL:                       "/404.html",
-			}
+	if bc.VerifyOutput {
+		if err := verifyAssetsTrees(gat, postsLists); err != nil {
+			return err
+		}
+	}
 
-			err := executeMinifyAndWriteTemplate(notFoundPageTemplate, notFoundPageTemplateData, path.Join(langOutPath, "404.html"))
-			if err != nil {
+	return nil
+}
+
+// writeOutputManifest writes the output manifest to outPath if outputManifest is set in the
+// config file. It's called once everything else, including the kept entries of an atomic
+// build, is in outPath, so that every file is listed.
+func (b *Builder) writeOutputManifest(outPath string) error {
+	if !b.c.OutputManifest {
+		return nil
+	}
+
+	hashes, err := findOutputFilesHashes(outPath)
+	if err != nil {
+		return fmt.Errorf("hashing files in %v: %v", outPath, err)
+	}
+
+	return writeConfigOutFile(outPath, outputManifestFilename, "outputManifest", b.bc.FilePerm, func(w io.Writer) error {
+		return writeOutputManifest(w, hashes)
+	})
+}
+
+// checkPassthroughDir returns an error if an entry in the passthrough dir at
+// passthroughInPath would overwrite, or be overwritten by, one generated in outPath, such as
+// a page. Directories are merged, so they only conflict with files, and the entries kept
+// from the previous output, over which generated ones take precedence, aren't conflicts.
+func checkPassthroughDir(passthroughInPath, outPath string, keep []string) error {
+	return fs.WalkDir(os.DirFS(passthroughInPath), ".", func(p string, d fs.DirEntry, err error) error {
+		if err != nil || p == "." {
+			return err
+		}
+
+		info, err := os.Lstat(path.Join(outPath, p))
+		if err != nil {
+			if !os.IsNotExist(err) {
 				return err
 			}
+
+			if d.IsDir() {
+				return fs.SkipDir
+			}
+
+			return nil
 		}
 
-		// post page
-		if len(postsLists.visiblePostsByLangTag) > 0 || len(postsLists.invisiblePostsByLangTag) > 0 {
-			postsDirOutPath := path.Join(langOutPath, "posts")
-			err = os.Mkdir(postsDirOutPath, os.ModeDir|os.ModePerm)
-			if err != nil {
+		if d.IsDir() && info.IsDir() || isKeptPath(p, keep) {
+			return nil
+		}
+
+		return fmt.Errorf("%v in passthrough dir conflicts with a generated file", p)
+	})
+}
+
+// isKeptPath returns whether relPath, or any of its parent directories, matches any of the
+// keep glob patterns.
+func isKeptPath(relPath string, keep []string) bool {
+	for p := relPath; p != "." && p != "/"; p = path.Dir(p) {
+		if matchesAnyPattern(p, keep) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// writeConfigOutFile writes the file named filename in outPath, which is generated by fn
+// because of the field named field in config file, with perm as its permissions. Since it's
+// written after the passthrough dir is copied, an error is returned if one with the same name
+// was copied from it.
+func writeConfigOutFile(outPath, filename, field string, perm os.FileMode, fn func(w io.Writer) error) error {
+	filePath := path.Join(outPath, filename)
+	if _, err := os.Stat(filePath); err == nil {
+		return fmt.Errorf("%v in passthrough dir conflicts with the one generated by the %v field in config file", filename, field)
+	}
+
+	if err := writeFileAtomic(filePath, perm, fn); err != nil {
+		return fmt.Errorf("writing %v: %v", filename, err)
+	}
+
+	return nil
+}
+
+// BuildPost rebuilds the pages of the post whose slug is slug in each lang, as well as its
+// assets, reusing what was kept by the last Build, which must've been successful. Other
+// pages, e.g. the home pages, aren't rebuilt, even if they list the post.
+func (b *Builder) BuildPost(slug string) error {
+	if b.out == nil {
+		return errors.New("BuildPost called without a successful Build")
+	}
+
+	dirs, err := readSectionsPostDirs(b.bc.InPath, b.c, b.bc.Logger)
+	if err != nil {
+		return err
+	}
+
+	i := slices.IndexFunc(dirs, func(d sectionPostDir) bool {
+		return d.slug == slug
+	})
+	if i == -1 {
+		return fmt.Errorf("%v post not found", slug)
+	}
+
+	newLists := newGeneratePostsListsOutput()
+
+	err = newLists.generatePost(
+		generatePostsListsInput{
+			bc:            &b.bc,
+			c:             b.c,
+			gat:           b.out.gat,
+			assetsOutPath: b.out.assetsOutPath,
+			pc:            b.pc,
+			socialCards:   b.out.socialCards,
+			langs:         b.langs,
+		},
+		dirs[i],
+	)
+	if err != nil {
+		return err
+	}
+
+	// the lists are updated in place, since the template funcs refer to them.
+	b.out.postsLists.replacePost(slug, newLists)
+
+	err = b.buildLangs(func(l *Lang, t *pageTemplates) error {
+		for _, p := range newLists.allPostsByLangTag[l.Tag] {
+			if err := b.buildPostPages(l, t, p); err != nil {
 				return err
 			}
+		}
 
-			for _, p := range postsLists.allPostsByLangTag[l.Tag] {
-				postDirPath := path.Join(postsDirOutPath, p.Slug)
-				err := os.Mkdir(postDirPath, os.ModeDir|os.ModePerm)
-				if err != nil {
-					return err
-				}
+		// the combined page is rebuilt, since it has the content of the post.
+		return b.buildCombinedPage(l, t)
+	})
+	if err != nil {
+		return err
+	}
 
-				postPageTemplateData := TemplateData{
-					Title:                     fmt.Sprintf("%v - %v", p.Title, c.Title),
-					Description:               p.Excerpt,
-					Page:                      "post",
-					Color:                     c.Color,
-					Post:                      p,
-					Lang:                      l,
-					Author:                    c.Author,
-					ResponsiveImgMediaQueries: c.ResponsiveImgMediaQueries,
-					Posts:                     postsLists.visiblePostsByLangTag[l.Tag],
-				}
+	if b.bc.VerifyOutput {
+		if err := verifyAssetsTrees(b.out.gat, newLists); err != nil {
+			return err
+		}
+	}
 
-				postPageTemplateData.AlternateLinks = generateAlternateLinks(nil, []string{"posts", p.Slug}, c.Langs)
+	// the output manifest is rewritten, since the files of the post changed.
+	if b.c.OutputManifest {
+		hashes, err := findOutputFilesHashes(b.out.outPath)
+		if err != nil {
+			return fmt.Errorf("hashing files in %v: %v", b.out.outPath, err)
+		}
 
-				if l.Default {
-					postPageTemplateData.URL = "/posts/" + p.Slug
-				} else {
-					postPageTemplateData.URL = "/" + l.Tag + "/posts/" + p.Slug
-				}
+		err = writeFileAtomic(path.Join(b.out.outPath, outputManifestFilename), b.bc.FilePerm, func(w io.Writer) error {
+			return writeOutputManifest(w, hashes)
+		})
+		if err != nil {
+			return fmt.Errorf("writing %v: %v", outputManifestFilename, err)
+		}
+	}
 
-				if p.Img != nil {
-					postPageTemplateData.Img = p.Img
-				} else {
-					postPageTemplateData.Img = c.defaultImgByLangTag[l.Tag]
-				}
+	return nil
+}
 
-				postPageTemplate.Funcs(map[string]interface{}{
-					"assetLink":   generateAssetsLinkFn(gat, p.pat, p.Slug),
-					"srcSetValue": generateSrcSetValueFn(gat, p.pat, p.Slug, c.ResponsiveImgSizes),
-					"hasAsset":    generateHasAsset(gat, p.pat, p.Slug),
-				})
+// verifyAssetsTrees returns an error listing the files that don't exist among the ones
+// referenced by the links of the processed nodes in gat and in the PATs of the posts in
+// postsLists.
+func verifyAssetsTrees(gat *assetsTreeNode, postsLists *generatePostsListsOutput) error {
+	trees := []*assetsTreeNode{gat}
 
-				err = executeMinifyAndWriteTemplate(postPageTemplate, postPageTemplateData, path.Join(postDirPath, "index.html"))
-				if err != nil {
-					return err
-				}
+	// the versions of a post in each lang share the same PAT.
+	for _, posts := range postsLists.allPostsByLangTag {
+		for _, p := range posts {
+			trees = append(trees, p.pat)
+		}
+	}
+
+	var errs []error
+	verified := make(map[*assetsTreeNode]struct{}, len(trees))
+
+	for _, tree := range trees {
+		if tree == nil || mapContains(verified, tree) {
+			continue
+		}
+
+		verified[tree] = struct{}{}
+		errs = append(errs, tree.verifyProcessedFiles()...)
+	}
+
+	if len(errs) > 0 {
+		// the errors are sorted, since the order of the PATs depends on the one of a map.
+		sort.Slice(errs, func(i, j int) bool {
+			return errs[i].Error() < errs[j].Error()
+		})
+
+		return fmt.Errorf("verifying output: %w", errors.Join(errs...))
+	}
+
+	return nil
+}
+
+// load reads the config file, the data dir and the templates, setting the respective
+// fields of b.
+func (b *Builder) load() error {
+	bc := b.bc
+
+	// config file
+	c, err := readConfigFile(bc.InPath, bc.Logger)
+	if err != nil {
+		return err
+	}
+
+	// data dir
+	dataPath := path.Join(bc.InPath, "data")
+	data, err := readDataDir(dataPath)
+	if err != nil {
+		return fmt.Errorf("reading %v: %v", dataPath, err)
+	}
+
+	// assets processing config
+	pc := assetsProcessingConfig{
+		flatImgs:         bc.FlatAssets,
+		namedImgSizes:    bc.NamedImageSizes,
+		imgFormats:       c.ImageFormats,
+		computeImgColors: c.ComputeImageColors,
+		highDPI:          c.HighDPI,
+		originalImgs:     c.OriginalImages,
+		minifiedExts:     c.MinifyAssets,
+		assetsDir:        c.AssetsDir,
+		perms:            outputPerms{dir: bc.DirPerm, file: bc.FilePerm},
+	}
+
+	if quality, ok := imgQualityPresets[c.ImageQuality]; ok {
+		pc.imgQuality = &quality
+	}
+
+	if bc.WarnLargeImages {
+		pc.largeImgsFactor = bc.LargeImagesFactor
+		pc.logger = bc.Logger
+		if pc.largeImgsFactor == 0 {
+			pc.largeImgsFactor = defaultLargeImagesFactor
+		}
+	}
+
+	// chroma styles
+	var chromaStylesBuff bytes.Buffer
+
+	if err := chromaHTML.New().WriteCSS(&chromaStylesBuff, bc.ChromaStyle); err != nil {
+		return err
+	}
+
+	langs, err := selectLangs(c.Langs, bc.OnlyLangs)
+	if err != nil {
+		return err
+	}
+
+	alternateLinksLangs := c.Langs
+	if bc.LimitAlternateLinks {
+		alternateLinksLangs = langs
+	}
+
+	style := c.urlStyle()
+
+	// base template
+	baseTemplate, err := createBaseTemplateWithIncludes(
+		bc.TemplateFuncs,
+		path.Join(bc.InPath, "includes"),
+		c.URL,
+		style,
+		c.Preconnect,
+		bc.Now,
+		bc.Env,
+	)
+	if err != nil {
+		return err
+	}
+
+	pagesInPath := path.Join(bc.InPath, "pages")
+
+	// home page
+	homePageTemplate, err := createRequiredPageTemplate(pagesInPath, baseTemplate, "home")
+	if err != nil {
+		return err
+	}
+
+	// post pages
+	// each section has its own template.
+	postPageTemplates := make(map[string]*template.Template, len(c.Sections))
+
+	for _, section := range c.Sections {
+		postPageTemplates[section.Name], err = createRequiredPageTemplate(pagesInPath, baseTemplate, section.Template)
+		if err != nil {
+			return err
+		}
+	}
+
+	// 404 page
+	// it's optional, so it's only executed if its template exists.
+	notFoundPageTemplate, err := createPageTemplate(pagesInPath, baseTemplate, "404")
+	if err != nil {
+		if !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+
+		notFoundPageTemplate = nil
+	}
+
+	// reader page
+	// it's only executed if enabled in the config file and if its template exists.
+	var readerPageTemplate *template.Template
+
+	if c.ReaderPages {
+		readerPageTemplate, err = createPageTemplate(pagesInPath, baseTemplate, "reader")
+		if err != nil {
+			if !errors.Is(err, fs.ErrNotExist) {
+				return err
+			}
+
+			readerPageTemplate = nil
+		}
+	}
+
+	// archive page
+	// it's optional, so it's only executed if its template exists.
+	archivePageTemplate, err := createPageTemplate(pagesInPath, baseTemplate, "archive")
+	if err != nil {
+		if !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+
+		archivePageTemplate = nil
+	}
+
+	// posts page
+	// it's optional, so it's only executed if its template exists.
+	postsListPageTemplate, err := createPageTemplate(pagesInPath, baseTemplate, "posts")
+	if err != nil {
+		if !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+
+		postsListPageTemplate = nil
+	}
+
+	// combined page
+	// it's only executed if the combinedPage field in the config file is true, in which case
+	// its template is required.
+	var combinedPageTemplate *template.Template
+	if c.CombinedPage {
+		combinedPageTemplate, err = createRequiredPageTemplate(pagesInPath, baseTemplate, "all")
+		if err != nil {
+			return err
+		}
+	}
+
+	b.pageTemplates = &pageTemplates{
+		home:      homePageTemplate,
+		posts:     postPageTemplates,
+		notFound:  notFoundPageTemplate,
+		reader:    readerPageTemplate,
+		archive:   archivePageTemplate,
+		postsList: postsListPageTemplate,
+		combined:  combinedPageTemplate,
+	}
+
+	b.c = c
+	b.data = data
+	b.pc = &pc
+	b.chromaCSS = chromaStylesBuff.Bytes()
+	b.style = style
+	b.langs = langs
+	b.alternateLinksLangs = alternateLinksLangs
+	b.htmlMinifier = newHTMLMinifier(bc.MinifyHTMLOptions)
+
+	return nil
+}
+
+// buildLangs calls fn for each lang in parallel. Each lang has its own clones of the page
+// templates, since the funcs of the post and reader ones are changed for each post. The
+// output must be the same regardless of BuildConfig.Concurrency, so what fn changes in
+// the shared trees and lists, e.g. the sizes added by srcSetValue, can't depend on the
+// order in which the langs are built.
+func (b *Builder) buildLangs(fn func(l *Lang, t *pageTemplates) error) error {
+	langsTemplates := make([]*pageTemplates, len(b.langs))
+
+	for i := range b.langs {
+		var err error
+
+		langsTemplates[i], err = b.out.templates.clone()
+		if err != nil {
+			return err
+		}
+	}
+
+	return runInParallel(b.limiter, len(b.langs), func(i int) error {
+		return fn(b.langs[i], langsTemplates[i])
+	})
+}
+
+// selectLangs returns the langs whose tags are in tags, in the order of langs. If tags is
+// empty, langs is returned.
+func selectLangs(langs []*Lang, tags []string) ([]*Lang, error) {
+	if len(tags) == 0 {
+		return langs, nil
+	}
+
+	for _, tag := range tags {
+		if !slices.ContainsFunc(langs, func(l *Lang) bool { return l.Tag == tag }) {
+			return nil, fmt.Errorf("%v in OnlyLangs isn't a lang in config file", tag)
+		}
+	}
+
+	var selected []*Lang
+
+	for _, l := range langs {
+		if slices.Contains(tags, l.Tag) {
+			selected = append(selected, l)
+		}
+	}
+
+	return selected, nil
+}
+
+// buildCombinedPage builds the combined page of l, if its template exists in t.
+func (b *Builder) buildCombinedPage(l *Lang, t *pageTemplates) error {
+	if t.combined == nil {
+		return nil
+	}
+
+	combinedPageTemplateData := TemplateData{
+		Color:                     b.c.Color,
+		Author:                    b.c.Author,
+		Description:               b.c.Description[l.Tag],
+		Img:                       b.c.defaultImgByLangTag[l.Tag],
+		OGImage:                   b.c.defaultOGImgByLangTag[l.Tag],
+		Lang:                      l,
+		Page:                      "all",
+		Posts:                     generateCombinedPagePosts(b.out.postsLists.visiblePostsByLangTag[l.Tag]),
+		FeedPosts:                 b.out.postsLists.feedPostsByLangTag[l.Tag],
+		Title:                     fmt.Sprintf("All posts - %v", b.c.Title),
+		ResponsiveImgMediaQueries: b.c.ResponsiveImgMediaQueries,
+		Data:                      b.data,
+		Env:                       b.bc.Env,
+		Langs:                     b.c.Langs,
+		AlternateLinks:            generateAlternateLinks(nil, []string{combinedPageFilename}, filePageKind, b.alternateLinksLangs, b.style),
+		URL:                       langRelURL(combinedPageFilename, l),
+	}
+
+	err := executeMinifyAndWriteTemplate(t.combined, combinedPageTemplateData, b.htmlMinifier, b.bc.PostProcessHTML, path.Join(langOutPath(b.out.outPath, l), combinedPageFilename), b.bc.FilePerm)
+	if err != nil {
+		return fmt.Errorf("executing combined page (%v): %w", l.Tag, err)
+	}
+
+	return nil
+}
+
+// pageTemplates are the templates of the pages. The optional ones are nil if they don't exist.
+type pageTemplates struct {
+	home, notFound, reader, archive *template.Template
+	// postsList is the template of the posts page, which lists the posts, unlike the post
+	// pages.
+	postsList *template.Template
+	// combined is the template of the combined page, which has the content of all of the
+	// posts.
+	combined *template.Template
+	// posts are the templates of the post pages keyed by the names of their sections.
+	posts map[string]*template.Template
+}
+
+// clone returns a copy of t whose templates can be changed and executed without affecting t.
+func (t *pageTemplates) clone() (*pageTemplates, error) {
+	c := pageTemplates{
+		posts: make(map[string]*template.Template, len(t.posts)),
+	}
+
+	for _, tmpl := range []struct {
+		src *template.Template
+		dst **template.Template
+	}{
+		{t.home, &c.home},
+		{t.notFound, &c.notFound},
+		{t.reader, &c.reader},
+		{t.archive, &c.archive},
+		{t.postsList, &c.postsList},
+		{t.combined, &c.combined},
+	} {
+		clone, err := cloneTemplate(tmpl.src)
+		if err != nil {
+			return nil, err
+		}
+
+		*tmpl.dst = clone
+	}
+
+	for name, tmpl := range t.posts {
+		clone, err := cloneTemplate(tmpl)
+		if err != nil {
+			return nil, err
+		}
+
+		c.posts[name] = clone
+	}
+
+	return &c, nil
+}
+
+// cloneTemplate returns a clone of t or nil if t is nil.
+func cloneTemplate(t *template.Template) (*template.Template, error) {
+	if t == nil {
+		return nil, nil
+	}
+
+	clone, err := t.Clone()
+	if err != nil {
+		return nil, fmt.Errorf("cloning %v template: %v", t.Name(), err)
+	}
+
+	return clone, nil
+}
+
+// funcs adds the elements of funcs to the func map of each template in t.
+func (t *pageTemplates) funcs(funcs template.FuncMap) {
+	for _, tmpl := range []*template.Template{t.home, t.notFound, t.reader, t.archive, t.postsList, t.combined} {
+		if tmpl != nil {
+			tmpl.Funcs(funcs)
+		}
+	}
+
+	for _, tmpl := range t.posts {
+		tmpl.Funcs(funcs)
+	}
+}
+
+// buildLangPages executes the page templates in t for l and writes the pages.
+func (b *Builder) buildLangPages(l *Lang, t *pageTemplates) error {
+	langOutPath := langOutPath(b.out.outPath, l)
+	if err := os.MkdirAll(langOutPath, b.bc.DirPerm); err != nil {
+		return err
+	}
+
+	// home page
+	homePageTemplateData := TemplateData{
+		Posts:                     latestPosts(b.out.postsLists.visiblePostsByLangTag[l.Tag], b.c.HomePostsLimit),
+		FeedPosts:                 b.out.postsLists.feedPostsByLangTag[l.Tag],
+		Lang:                      l,
+		Author:                    b.c.Author,
+		Color:                     b.c.Color,
+		ResponsiveImgMediaQueries: b.c.ResponsiveImgMediaQueries,
+		Data:                      b.data,
+		Env:                       b.bc.Env,
+		Langs:                     b.c.Langs,
+		Title:                     b.c.Title,
+		Description:               b.c.Description[l.Tag],
+		Page:                      "home",
+		Img:                       b.c.defaultImgByLangTag[l.Tag],
+		OGImage:                   b.c.defaultOGImgByLangTag[l.Tag],
+	}
+
+	homePageTemplateData.AlternateLinks = generateAlternateLinks(nil, nil, homePageKind, b.alternateLinksLangs, b.style)
+	homePageTemplateData.URL = b.style.pageRelURL("", l)
+
+	homeFilePath := b.style.homeFilePath(langOutPath, l)
+	if err := os.MkdirAll(path.Dir(homeFilePath), b.bc.DirPerm); err != nil {
+		return err
+	}
+
+	err := executeMinifyAndWriteTemplate(t.home, homePageTemplateData, b.htmlMinifier, b.bc.PostProcessHTML, homeFilePath, b.bc.FilePerm)
+	if err != nil {
+		return fmt.Errorf("executing home page (%v): %w", l.Tag, err)
+	}
+
+	// 404 page
+	// unless localized 404 pages are enabled, only execute the 404 page's template
+	// if it's the default language.
+	if (l.Default || b.c.Localized404Pages) && t.notFound != nil {
+		notFoundPageTemplateData := TemplateData{
+			Color:                     b.c.Color,
+			Author:                    b.c.Author,
+			Description:               b.c.Description[l.Tag],
+			Img:                       b.c.defaultImgByLangTag[l.Tag],
+			OGImage:                   b.c.defaultOGImgByLangTag[l.Tag],
+			Lang:                      l,
+			Page:                      "404",
+			Posts:                     b.out.postsLists.visiblePostsByLangTag[l.Tag],
+			FeedPosts:                 b.out.postsLists.feedPostsByLangTag[l.Tag],
+			Title:                     fmt.Sprintf("Not found - %v", b.c.Title),
+			ResponsiveImgMediaQueries: b.c.ResponsiveImgMediaQueries,
+			Data:                      b.data,
+			Env:                       b.bc.Env,
+			Langs:                     b.c.Langs,
+			URL:                       langRelURL("404.html", l),
+		}
+
+		err := executeMinifyAndWriteTemplate(t.notFound, notFoundPageTemplateData, b.htmlMinifier, b.bc.PostProcessHTML, path.Join(langOutPath, "404.html"), b.bc.FilePerm)
+		if err != nil {
+			return fmt.Errorf("executing 404 page (%v): %w", l.Tag, err)
+		}
+	}
+
+	// archive page
+	if t.archive != nil {
+		archiveFilePath := b.style.pageFilePath(langOutPath, "archive")
+		if err := os.MkdirAll(path.Dir(archiveFilePath), b.bc.DirPerm); err != nil {
+			return err
+		}
+
+		archivePageTemplateData := TemplateData{
+			Color:                     b.c.Color,
+			Author:                    b.c.Author,
+			Description:               b.c.Description[l.Tag],
+			Img:                       b.c.defaultImgByLangTag[l.Tag],
+			OGImage:                   b.c.defaultOGImgByLangTag[l.Tag],
+			Lang:                      l,
+			Page:                      "archive",
+			Posts:                     b.out.postsLists.visiblePostsByLangTag[l.Tag],
+			FeedPosts:                 b.out.postsLists.feedPostsByLangTag[l.Tag],
+			Archive:                   groupPostsByYearAndMonth(b.out.postsLists.visiblePostsByLangTag[l.Tag]),
+			Title:                     fmt.Sprintf("Archive - %v", b.c.Title),
+			ResponsiveImgMediaQueries: b.c.ResponsiveImgMediaQueries,
+			Data:                      b.data,
+			Env:                       b.bc.Env,
+			Langs:                     b.c.Langs,
+			AlternateLinks:            generateAlternateLinks(nil, []string{"archive"}, dirPageKind, b.alternateLinksLangs, b.style),
+			URL:                       b.style.pageRelURL("archive", l),
+		}
+
+		err := executeMinifyAndWriteTemplate(t.archive, archivePageTemplateData, b.htmlMinifier, b.bc.PostProcessHTML, archiveFilePath, b.bc.FilePerm)
+		if err != nil {
+			return fmt.Errorf("executing archive page (%v): %w", l.Tag, err)
+		}
+	}
+
+	// posts pages, one for each section at its URL prefix, which list only its posts.
+	if t.postsList != nil {
+		for _, section := range b.c.Sections {
+			if err := b.buildPostsPage(l, t, langOutPath, section); err != nil {
+				return err
 			}
 		}
 	}
 
+	// combined page
+	if err := b.buildCombinedPage(l, t); err != nil {
+		return err
+	}
+
+	// post page
+	for _, p := range b.out.postsLists.allPostsByLangTag[l.Tag] {
+		if err := b.buildPostPages(l, t, p); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// buildPostsPage builds the posts page of section in l, which is placed at the URL prefix
+// of section and lists its visible posts.
+func (b *Builder) buildPostsPage(l *Lang, t *pageTemplates, langOutPath string, section *Section) error {
+	postsListFilePath := b.style.pageFilePath(langOutPath, section.URLPrefix)
+	if err := os.MkdirAll(path.Dir(postsListFilePath), b.bc.DirPerm); err != nil {
+		return err
+	}
+
+	var posts []*Post
+	for _, p := range b.out.postsLists.visiblePostsByLangTag[l.Tag] {
+		if p.Section != nil && p.Section.Name == section.Name {
+			posts = append(posts, p)
+		}
+	}
+
+	postsListPageTemplateData := TemplateData{
+		Color:                     b.c.Color,
+		Author:                    b.c.Author,
+		Description:               b.c.Description[l.Tag],
+		Img:                       b.c.defaultImgByLangTag[l.Tag],
+		OGImage:                   b.c.defaultOGImgByLangTag[l.Tag],
+		Lang:                      l,
+		Page:                      "posts",
+		Section:                   section,
+		Posts:                     posts,
+		FeedPosts:                 b.out.postsLists.feedPostsByLangTag[l.Tag],
+		Title:                     fmt.Sprintf("Posts - %v", b.c.Title),
+		ResponsiveImgMediaQueries: b.c.ResponsiveImgMediaQueries,
+		Data:                      b.data,
+		Env:                       b.bc.Env,
+		Langs:                     b.c.Langs,
+		AlternateLinks:            generateAlternateLinks(nil, []string{section.URLPrefix}, dirPageKind, b.alternateLinksLangs, b.style),
+		URL:                       b.style.pageRelURL(section.URLPrefix, l),
+	}
+
+	err := executeMinifyAndWriteTemplate(t.postsList, postsListPageTemplateData, b.htmlMinifier, b.bc.PostProcessHTML, postsListFilePath, b.bc.FilePerm)
+	if err != nil {
+		return fmt.Errorf("executing posts page of %v section (%v): %w", section.Name, l.Tag, err)
+	}
+
+	return nil
+}
+
+// buildPostPages executes the post and reader page templates in t for p, whose lang is l,
+// and writes the pages.
+func (b *Builder) buildPostPages(l *Lang, t *pageTemplates, p *Post) error {
+	postsDirOutPath := path.Join(langOutPath(b.out.outPath, l), p.Section.URLPrefix)
+
+	postFilePath := b.style.pageFilePath(postsDirOutPath, p.Slug)
+	err := os.MkdirAll(path.Dir(postFilePath), b.bc.DirPerm)
+	if err != nil {
+		return err
+	}
+
+	postPageTemplateData := TemplateData{
+		Title:                     fmt.Sprintf("%v - %v", p.Title, b.c.Title),
+		Description:               p.Excerpt,
+		Page:                      "post",
+		Color:                     b.c.Color,
+		Post:                      p,
+		Section:                   p.Section,
+		Lang:                      l,
+		Author:                    b.c.Author,
+		ResponsiveImgMediaQueries: b.c.ResponsiveImgMediaQueries,
+		Data:                      b.data,
+		Env:                       b.bc.Env,
+		Langs:                     b.c.Langs,
+		Posts:                     b.out.postsLists.visiblePostsByLangTag[l.Tag],
+		FeedPosts:                 b.out.postsLists.feedPostsByLangTag[l.Tag],
+	}
+
+	postPageTemplateData.AlternateLinks = generateAlternateLinks(nil, []string{p.Section.URLPrefix, p.Slug}, dirPageKind, b.alternateLinksLangs, b.style)
+	postPageTemplateData.URL = p.URL
+
+	// the og image of a post falls back to its img and only then to the defaults.
+	switch {
+	case p.OGImage != nil:
+		postPageTemplateData.OGImage = p.OGImage
+	case p.Img == nil:
+		postPageTemplateData.OGImage = b.c.defaultOGImgByLangTag[l.Tag]
+	}
+
+	if p.Img != nil {
+		postPageTemplateData.Img = p.Img
+	} else {
+		postPageTemplateData.Img = b.c.defaultImgByLangTag[l.Tag]
+	}
+
+	postTemplate := t.posts[p.Section.Name]
+	postTemplate.Funcs(generatePostAssetsFuncs(b.out.gat, p, b.c.ResponsiveImgSizes, b.pc))
+
+	err = executeMinifyAndWriteTemplate(postTemplate, postPageTemplateData, b.htmlMinifier, b.bc.PostProcessHTML, postFilePath, b.bc.FilePerm)
+	if err != nil {
+		return fmt.Errorf("executing post page for '%v' (%v): %w", p.Slug, l.Tag, err)
+	}
+
+	// reader page
+	if t.reader != nil {
+		readerFilePath := b.style.pageFilePath(postsDirOutPath, path.Join(p.Slug, "reader"))
+		err := os.MkdirAll(path.Dir(readerFilePath), b.bc.DirPerm)
+		if err != nil {
+			return err
+		}
+
+		readerPageTemplateData := postPageTemplateData
+		readerPageTemplateData.Page = "reader"
+		readerPageTemplateData.URL = b.style.pageRelURL(path.Join(p.Section.URLPrefix, p.Slug, "reader"), l)
+		readerPageTemplateData.AlternateLinks = generateAlternateLinks(nil, []string{p.Section.URLPrefix, p.Slug, "reader"}, dirPageKind, b.alternateLinksLangs, b.style)
+
+		t.reader.Funcs(generatePostAssetsFuncs(b.out.gat, p, b.c.ResponsiveImgSizes, b.pc))
+
+		err = executeMinifyAndWriteTemplate(t.reader, readerPageTemplateData, b.htmlMinifier, b.bc.PostProcessHTML, readerFilePath, b.bc.FilePerm)
+		if err != nil {
+			return fmt.Errorf("executing reader page for '%v' (%v): %w", p.Slug, l.Tag, err)
+		}
+	}
+
+	return nil
+}
+
+// latestPosts returns the n most recent of posts, by date, in the order they're in in posts,
+// e.g. with pinned ones first. posts is returned as is if n is zero or if there are no more
+// than n of them.
+func latestPosts(posts []*Post, n int) []*Post {
+	if n == 0 || len(posts) <= n {
+		return posts
+	}
+
+	byDate := make([]*Post, len(posts))
+	copy(byDate, posts)
+
+	sort.SliceStable(byDate, func(i, j int) bool {
+		return byDate[i].Date.After(byDate[j].Date)
+	})
+
+	latestSet := make(map[*Post]struct{}, n)
+	for _, p := range byDate[:n] {
+		latestSet[p] = struct{}{}
+	}
+
+	latest := make([]*Post, 0, n)
+	for _, p := range posts {
+		if mapContains(latestSet, p) {
+			latest = append(latest, p)
+		}
+	}
+
+	return latest
+}
+
+// langOutPath returns the path of the directory in outPath in which the pages in l are placed.
+func langOutPath(outPath string, l *Lang) string {
+	if l.Default {
+		return outPath
+	}
+
+	return path.Join(outPath, l.Tag)
+}
+
+// runInParallel calls fn for each i in [0, n) in its own goroutine, as long as there's a
+// free slot in l. The calls are started in order, so they're sequential if l only has one
+// slot. Once fn returns an error, no other call is started. If more than one call returns
+// an error, the one with the lowest i is returned.
+func runInParallel(l *limiter.Limiter, n int, fn func(i int) error) error {
+	var (
+		wg     sync.WaitGroup
+		failed atomic.Bool
+		errs   = make([]error, n)
+	)
+
+	for i := 0; i < n; i++ {
+		l.Acquire()
+
+		if failed.Load() {
+			l.Release()
+
+			break
+		}
+
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+			defer l.Release()
+
+			if err := fn(i); err != nil {
+				errs[i] = err
+				failed.Store(true)
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// buildAtomically builds the blog into a temporary directory in the same directory as
+// OutPath and, if the build succeeds, replaces OutPath with it. If anything fails, OutPath is
+// left as it was and the temporary directory is removed.
+func (b *Builder) buildAtomically() error {
+	bc := b.bc
+	outPath := path.Clean(bc.OutPath)
+
+	// tmpPath holds the new output and, while it's replaced, the old one. Since it's created
+	// by os.MkdirTemp, its permissions are 0700, so the new output is built into a directory
+	// in it, which is created with bc.DirPerm like in a build without AtomicOutput.
+	tmpPath, err := os.MkdirTemp(path.Dir(outPath), "."+path.Base(outPath)+"-*")
+	if err != nil {
+		return fmt.Errorf("creating temporary directory for %v: %v", outPath, err)
+	}
+	defer os.RemoveAll(tmpPath)
+
+	newOutPath := path.Join(tmpPath, "out")
+	oldOutPath := path.Join(tmpPath, "old")
+
+	if err := b.build(newOutPath); err != nil {
+		return err
+	}
+
+	_, err = os.Stat(outPath)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	hasOldOut := err == nil
+
+	// kept entries are moved from the old output to the new one. If anything fails
+	// afterwards, they're moved back.
+	var kept []keptEntry
+
+	restoreKept := func() {
+		for i := len(kept) - 1; i >= 0; i-- {
+			os.Rename(kept[i].newPath, kept[i].oldPath)
+		}
+	}
+
+	if hasOldOut && len(bc.Keep) > 0 {
+		keptRelPaths, err := findKeptPaths(outPath, "", bc.Keep)
+		if err != nil {
+			return fmt.Errorf("finding kept entries in %v: %v", outPath, err)
+		}
+
+		for _, keptRelPath := range keptRelPaths {
+			err := moveKeptEntry(path.Join(outPath, keptRelPath), path.Join(newOutPath, keptRelPath), bc.DirPerm, &kept)
+			if err != nil {
+				restoreKept()
+
+				return fmt.Errorf("keeping %v: %v", keptRelPath, err)
+			}
+		}
+	}
+
+	// the output manifest is written after the kept entries are moved, so that they're
+	// listed like in a build without AtomicOutput.
+	if err := b.writeOutputManifest(newOutPath); err != nil {
+		restoreKept()
+
+		return err
+	}
+
+	// the old output, if there's one, is moved aside so that the new one can be renamed
+	// to outPath. It's removed along with tmpPath.
+	if hasOldOut {
+		if err := os.Rename(outPath, oldOutPath); err != nil {
+			restoreKept()
+
+			return fmt.Errorf("moving %v aside: %v", outPath, err)
+		}
+	}
+
+	if err := os.Rename(newOutPath, outPath); err != nil {
+		if hasOldOut {
+			os.Rename(oldOutPath, outPath)
+		}
+
+		restoreKept()
+
+		return fmt.Errorf("renaming %v to %v: %v", newOutPath, outPath, err)
+	}
+
+	return nil
+}
+
+// keptEntry is an entry moved from the old output to the new one by moveKeptEntry.
+type keptEntry struct {
+	oldPath, newPath string
+}
+
+// moveKeptEntry moves the kept entry at oldPath to newPath, in the new output, and appends
+// what's moved to kept. As in a build without AtomicOutput, in which kept entries are
+// overwritten by the files generated with the same paths, what's generated takes precedence:
+// if both oldPath and newPath are directories, only the entries of oldPath that weren't
+// generated are moved, while oldPath is left out if newPath is a generated file. An error is
+// returned if only one of them is a directory.
+func moveKeptEntry(oldPath, newPath string, dirPerm os.FileMode, kept *[]keptEntry) error {
+	newInfo, err := os.Lstat(newPath)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			return err
+		}
+
+		if err := os.MkdirAll(path.Dir(newPath), dirPerm); err != nil {
+			return err
+		}
+
+		if err := os.Rename(oldPath, newPath); err != nil {
+			return err
+		}
+
+		*kept = append(*kept, keptEntry{oldPath: oldPath, newPath: newPath})
+
+		return nil
+	}
+
+	oldInfo, err := os.Lstat(oldPath)
+	if err != nil {
+		return err
+	}
+
+	if oldInfo.IsDir() != newInfo.IsDir() {
+		return fmt.Errorf("%v conflicts with the one generated by the build", oldPath)
+	}
+
+	if !oldInfo.IsDir() {
+		return nil
+	}
+
+	entries, err := os.ReadDir(oldPath)
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		err := moveKeptEntry(path.Join(oldPath, entry.Name()), path.Join(newPath, entry.Name()), dirPerm, kept)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// matchesAnyPattern returns whether relPath matches any of the glob patterns.
+func matchesAnyPattern(relPath string, patterns []string) bool {
+	for _, pattern := range patterns {
+		if matched, _ := path.Match(pattern, relPath); matched {
+			return true
+		}
+	}
+
+	return false
+}
+
+// cleanDir deletes each entry in dirPath, recursively, whose path relative to the root
+// directory being cleaned doesn't match any of the keep glob patterns. relDirPath is the path
+// of dirPath relative to that root. A directory is only deleted if none of its descendants are
+// kept. It returns whether any entry was kept.
+func cleanDir(dirPath, relDirPath string, keep []string) (kept bool, err error) {
+	entries, err := os.ReadDir(dirPath)
+	if err != nil {
+		return false, err
+	}
+
+	for _, entry := range entries {
+		entryPath := path.Join(dirPath, entry.Name())
+		entryRelPath := path.Join(relDirPath, entry.Name())
+
+		if matchesAnyPattern(entryRelPath, keep) {
+			kept = true
+
+			continue
+		}
+
+		if entry.IsDir() {
+			entryKept, err := cleanDir(entryPath, entryRelPath, keep)
+			if err != nil {
+				return false, err
+			}
+
+			if entryKept {
+				kept = true
+
+				continue
+			}
+		}
+
+		if err := os.RemoveAll(entryPath); err != nil {
+			return false, err
+		}
+	}
+
+	return kept, nil
+}
+
+// findKeptPaths returns the paths, relative to the root directory being searched, of the
+// entries in dirPath, recursively, that match any of the keep glob patterns. relDirPath is
+// the path of dirPath relative to that root. The descendants of a matched directory aren't
+// included.
+func findKeptPaths(dirPath, relDirPath string, keep []string) ([]string, error) {
+	entries, err := os.ReadDir(dirPath)
+	if err != nil {
+		return nil, err
+	}
+
+	var keptRelPaths []string
+
+	for _, entry := range entries {
+		entryRelPath := path.Join(relDirPath, entry.Name())
+
+		if matchesAnyPattern(entryRelPath, keep) {
+			keptRelPaths = append(keptRelPaths, entryRelPath)
+
+			continue
+		}
+
+		if entry.IsDir() {
+			entryKeptRelPaths, err := findKeptPaths(path.Join(dirPath, entry.Name()), entryRelPath, keep)
+			if err != nil {
+				return nil, err
+			}
+
+			keptRelPaths = append(keptRelPaths, entryKeptRelPaths...)
+		}
+	}
+
+	return keptRelPaths, nil
+}
+
+// copyDirRec copies the contents of srcDirPath to dstDirPath recursively and verbatim,
+// creating the directories and the files with perms.
+func copyDirRec(srcDirPath, dstDirPath string, perms outputPerms) error {
+	entries, err := os.ReadDir(srcDirPath)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(dstDirPath, perms.dir); err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		srcPath := path.Join(srcDirPath, entry.Name())
+		dstPath := path.Join(dstDirPath, entry.Name())
+
+		if entry.IsDir() {
+			if err := copyDirRec(srcPath, dstPath, perms); err != nil {
+				return err
+			}
+
+			continue
+		}
+
+		content, err := os.ReadFile(srcPath)
+		if err != nil {
+			return err
+		}
+
+		if err := writeFileAtomicBytes(dstPath, perms.file, content); err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
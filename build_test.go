@@ -1,14 +1,32 @@
 package egen
 
 import (
+	"bytes"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"html/template"
 	"io"
+	"io/fs"
+	"log/slog"
 	"os"
 	"path"
+	"path/filepath"
 	"reflect"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
+
+	"github.com/efreitasn/egen/internal/limiter"
+	"github.com/efreitasn/egen/internal/logs"
 )
 
 type latexTestGenerator struct{}
@@ -29,6 +47,18 @@ func (*latexTestGenerator) SVGInline(math []byte) ([]byte, error) {
 	return []byte(str), nil
 }
 
+func (*latexTestGenerator) MathMLBlock(math []byte) ([]byte, error) {
+	str := fmt.Sprintf("latex-mathml-block(%s)", math)
+
+	return []byte(str), nil
+}
+
+func (*latexTestGenerator) MathMLInline(math []byte) ([]byte, error) {
+	str := fmt.Sprintf("latex-mathml-inline(%s)", math)
+
+	return []byte(str), nil
+}
+
 func TestBuild_ok(t *testing.T) {
 	latexGenerator = &latexTestGenerator{}
 
@@ -83,6 +113,13 @@ func TestBuild_ok(t *testing.T) {
 			},
 			path.Join(okDir, "3", "out"),
 		},
+		{
+			BuildConfig{
+				InPath:  path.Join(okDir, "4", "in"),
+				OutPath: path.Join(okDir, "4", "test_output"),
+			},
+			path.Join(okDir, "4", "out"),
+		},
 	}
 
 	for _, test := range tests {
@@ -263,3 +300,2908 @@ func compareDirsRec(t *testing.T, a, b string) {
 		}
 	}
 }
+
+func TestBuild_missingPageTemplates(t *testing.T) {
+	latexGenerator = &latexTestGenerator{}
+
+	tests := []struct {
+		pageName string
+		err      string
+	}{
+		{"home", "required page template pages/home.html not found"},
+		{"post", "required page template pages/post.html not found"},
+		{"404", ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.pageName, func(t *testing.T) {
+			inPath := path.Join(t.TempDir(), "in")
+			if err := copyDirRec(path.Join("testdata", "build", "ok", "4", "in"), inPath, defaultOutputPerms); err != nil {
+				t.Fatalf("unexpected err: %v", err)
+			}
+
+			if err := os.Remove(path.Join(inPath, "pages", test.pageName+".html")); err != nil {
+				t.Fatalf("unexpected err: %v", err)
+			}
+
+			outPath := path.Join(t.TempDir(), "out")
+
+			err := Build(BuildConfig{
+				InPath:  inPath,
+				OutPath: outPath,
+			})
+
+			if test.err != "" {
+				if err == nil || err.Error() != test.err {
+					t.Fatalf("got %v, want %v", err, test.err)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected err: %v", err)
+			}
+
+			if _, err := os.Stat(path.Join(outPath, test.pageName+".html")); !os.IsNotExist(err) {
+				t.Errorf("%v.html should not exist", test.pageName)
+			}
+		})
+	}
+}
+
+func TestBuild_atomicOutput(t *testing.T) {
+	latexGenerator = &latexTestGenerator{}
+
+	dirPath := t.TempDir()
+	outPath := path.Join(dirPath, "out")
+	okInPath := path.Join("testdata", "build", "ok", "4", "in")
+
+	// it's built twice so that there's an existing output to be replaced the second time.
+	for i := 0; i < 2; i++ {
+		err := Build(BuildConfig{
+			InPath:       okInPath,
+			OutPath:      outPath,
+			AtomicOutput: true,
+		})
+		if err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+
+		compareDirsRec(t, path.Join("testdata", "build", "ok", "4", "out"), outPath)
+	}
+
+	// a failed build leaves the existing output untouched.
+	err := Build(BuildConfig{
+		InPath:       path.Join("testdata", "build", "err", "3", "in"),
+		OutPath:      outPath,
+		AtomicOutput: true,
+	})
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+
+	compareDirsRec(t, path.Join("testdata", "build", "ok", "4", "out"), outPath)
+
+	entries, err := os.ReadDir(dirPath)
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	if len(entries) != 1 {
+		t.Errorf("got %v entries in %v, want 1", len(entries), dirPath)
+	}
+}
+
+func TestBuild_keep(t *testing.T) {
+	latexGenerator = &latexTestGenerator{}
+
+	for _, atomicOutput := range []bool{false, true} {
+		t.Run(fmt.Sprintf("atomicOutput=%v", atomicOutput), func(t *testing.T) {
+			// the passthrough dir is removed so that it doesn't overwrite the kept files.
+			inPath := path.Join(t.TempDir(), "in")
+			if err := copyDirRec(path.Join("testdata", "build", "ok", "4", "in"), inPath, defaultOutputPerms); err != nil {
+				t.Fatalf("unexpected err: %v", err)
+			}
+
+			if err := os.RemoveAll(path.Join(inPath, "root")); err != nil {
+				t.Fatalf("unexpected err: %v", err)
+			}
+
+			outPath := path.Join(t.TempDir(), "out")
+
+			files := map[string]string{
+				"CNAME":           "foo.bar",
+				"media/photo.txt": "photo",
+				"stale.html":      "stale",
+				"posts/old.html":  "old",
+				"index.html":      "kept",
+			}
+
+			for relPath, content := range files {
+				filePath := path.Join(outPath, relPath)
+
+				if err := os.MkdirAll(path.Dir(filePath), os.ModeDir|os.ModePerm); err != nil {
+					t.Fatalf("unexpected err: %v", err)
+				}
+
+				if err := os.WriteFile(filePath, []byte(content), 0644); err != nil {
+					t.Fatalf("unexpected err: %v", err)
+				}
+			}
+
+			err := Build(BuildConfig{
+				InPath:       inPath,
+				OutPath:      outPath,
+				Keep:         []string{"CNAME", "media", "index.html"},
+				AtomicOutput: atomicOutput,
+			})
+			if err != nil {
+				t.Fatalf("unexpected err: %v", err)
+			}
+
+			// generated files take precedence over the kept ones with the same paths.
+			if content, err := os.ReadFile(path.Join(outPath, "index.html")); err != nil {
+				t.Errorf("unexpected err: %v", err)
+			} else if string(content) == files["index.html"] {
+				t.Error("kept index.html should have been replaced by the generated one")
+			}
+
+			for _, relPath := range []string{"CNAME", "media/photo.txt"} {
+				content, err := os.ReadFile(path.Join(outPath, relPath))
+				if err != nil {
+					t.Fatalf("unexpected err: %v", err)
+				}
+
+				if string(content) != files[relPath] {
+					t.Errorf("got %v, want %v", string(content), files[relPath])
+				}
+			}
+
+			for _, relPath := range []string{"stale.html", "posts/old.html"} {
+				if _, err := os.Stat(path.Join(outPath, relPath)); !os.IsNotExist(err) {
+					t.Errorf("%v should not exist", relPath)
+				}
+			}
+
+		})
+	}
+}
+
+func TestBuild_atomicOutputKeepConflict(t *testing.T) {
+	latexGenerator = &latexTestGenerator{}
+
+	dirPath := t.TempDir()
+	outPath := path.Join(dirPath, "out")
+
+	// posts is a directory in the new output.
+	if err := os.MkdirAll(path.Join(outPath, "media"), os.ModePerm); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	files := map[string]string{
+		"posts":           "posts",
+		"media/photo.txt": "photo",
+	}
+
+	for relPath, content := range files {
+		if err := os.WriteFile(path.Join(outPath, relPath), []byte(content), 0644); err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+	}
+
+	err := Build(BuildConfig{
+		InPath:       path.Join("testdata", "build", "ok", "4", "in"),
+		OutPath:      outPath,
+		Keep:         []string{"media", "posts"},
+		AtomicOutput: true,
+	})
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+
+	// the old output is left as it was, including the kept entries moved before the error.
+	for relPath, content := range files {
+		got, err := os.ReadFile(path.Join(outPath, relPath))
+		if err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+
+		if string(got) != content {
+			t.Errorf("got %q for %v, want %q", got, relPath, content)
+		}
+	}
+
+	entries, err := os.ReadDir(dirPath)
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	if len(entries) != 1 {
+		t.Errorf("got %v entries in %v, want 1", len(entries), dirPath)
+	}
+}
+
+func TestBuild_passthroughDir(t *testing.T) {
+	latexGenerator = &latexTestGenerator{}
+
+	tests := []struct {
+		name string
+		// files are written to the passthrough dir, with a nil content being a dangling
+		// symlink.
+		files       map[string][]byte
+		expectedErr string
+	}{
+		{"no root", nil, ""},
+		{"merged dir", map[string][]byte{"posts/extra.txt": []byte("extra")}, ""},
+		{"generated page", map[string][]byte{"index.html": []byte("root")}, "index.html in passthrough dir conflicts with a generated file"},
+		{"generated dir", map[string][]byte{"posts": []byte("root")}, "posts in passthrough dir conflicts with a generated file"},
+		{"dangling symlink", map[string][]byte{"broken": nil}, "copying"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			inPath := copyTestBuildInPath(t, "")
+			outPath := path.Join(t.TempDir(), "out")
+			rootPath := path.Join(inPath, "root")
+
+			if err := os.RemoveAll(rootPath); err != nil {
+				t.Fatalf("unexpected err: %v", err)
+			}
+
+			for relPath, content := range test.files {
+				filePath := path.Join(rootPath, relPath)
+
+				if err := os.MkdirAll(path.Dir(filePath), os.ModePerm); err != nil {
+					t.Fatalf("unexpected err: %v", err)
+				}
+
+				if content == nil {
+					if err := os.Symlink(path.Join(rootPath, "missing"), filePath); err != nil {
+						t.Fatalf("unexpected err: %v", err)
+					}
+
+					continue
+				}
+
+				if err := os.WriteFile(filePath, content, 0644); err != nil {
+					t.Fatalf("unexpected err: %v", err)
+				}
+			}
+
+			err := Build(BuildConfig{InPath: inPath, OutPath: outPath})
+			if test.expectedErr != "" {
+				if err == nil || !strings.Contains(err.Error(), test.expectedErr) {
+					t.Fatalf("got %v, want an error containing %q", err, test.expectedErr)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected err: %v", err)
+			}
+
+			for relPath, content := range test.files {
+				got, err := os.ReadFile(path.Join(outPath, relPath))
+				if err != nil {
+					t.Fatalf("unexpected err: %v", err)
+				}
+
+				if !bytes.Equal(got, content) {
+					t.Errorf("got %q for %v, want %q", got, relPath, content)
+				}
+			}
+		})
+	}
+}
+
+// copyTestBuildInPath copies the inPath of testdata/build/ok/4 to a temp dir, appends
+// configLines to its config file and returns the path of the copy.
+func copyTestBuildInPath(t *testing.T, configLines string) string {
+	t.Helper()
+
+	inPath := path.Join(t.TempDir(), "in")
+	if err := copyDirRec(path.Join("testdata", "build", "ok", "4", "in"), inPath, defaultOutputPerms); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	appendTestConfigLines(t, path.Join(inPath, configFilename), configLines)
+
+	return inPath
+}
+
+func TestBuild_socialCards(t *testing.T) {
+	latexGenerator = &latexTestGenerator{}
+
+	inPath := copyTestBuildInPath(t, "generateSocialCards: true\n")
+
+	outPath := path.Join(t.TempDir(), "out")
+
+	if err := Build(BuildConfig{InPath: inPath, OutPath: outPath}); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	// glossary has no assets and no ogImage, so its assets dir only has the social cards.
+	cardPaths, err := filepath.Glob(path.Join(outPath, "assets", "glossary", socialCardNamePrefix+"*.png"))
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	if len(cardPaths) != 2 {
+		t.Fatalf("got %v social cards for glossary, want 2", len(cardPaths))
+	}
+
+	for _, cardPath := range cardPaths {
+		width, height, err := imgDimensions(cardPath)
+		if err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+
+		if width != socialCardWidth || height != socialCardHeight {
+			t.Errorf("got %vx%v social card, want %vx%v", width, height, socialCardWidth, socialCardHeight)
+		}
+	}
+
+	postHTML, err := os.ReadFile(path.Join(outPath, "posts", "glossary", "index.html"))
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	if !strings.Contains(string(postHTML), "https://foo.bar/assets/glossary/"+socialCardNamePrefix+"en-") {
+		t.Errorf("og:image of glossary isn't its social card")
+	}
+
+	// hello has an ogImage, so it has no social card.
+	helloCardPaths, err := filepath.Glob(path.Join(outPath, "assets", "hello", socialCardNamePrefix+"*"))
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	if len(helloCardPaths) != 0 {
+		t.Errorf("got %v social cards for hello, want 0", len(helloCardPaths))
+	}
+}
+
+func TestBuild_assetsDir(t *testing.T) {
+	latexGenerator = &latexTestGenerator{}
+
+	inPath := copyTestBuildInPath(t, "assetsDir: static/files\n")
+
+	outPath := path.Join(t.TempDir(), "out")
+
+	if err := Build(BuildConfig{InPath: inPath, OutPath: outPath}); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	if _, err := os.Stat(path.Join(outPath, "assets")); !os.IsNotExist(err) {
+		t.Errorf("assets should not exist")
+	}
+
+	if _, err := os.Stat(path.Join(outPath, "static", "files", "hello")); err != nil {
+		t.Errorf("unexpected err: %v", err)
+	}
+
+	postHTML, err := os.ReadFile(path.Join(outPath, "posts", "hello", "index.html"))
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	if strings.Contains(string(postHTML), "/assets/") {
+		t.Errorf("post links to /assets/")
+	}
+
+	if !strings.Contains(string(postHTML), "https://foo.bar/static/files/hello/") {
+		t.Errorf("post doesn't link to /static/files/hello/")
+	}
+}
+
+func TestBuild_headers(t *testing.T) {
+	latexGenerator = &latexTestGenerator{}
+
+	inPath := copyTestBuildInPath(t, "headers: true\nassetsDir: static\n")
+
+	outPath := path.Join(t.TempDir(), "out")
+
+	if err := Build(BuildConfig{InPath: inPath, OutPath: outPath}); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	headers, err := os.ReadFile(path.Join(outPath, headersFilename))
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	for _, s := range []string{
+		"/static/*\n  Cache-Control: public, max-age=31536000, immutable\n",
+		"/*.html\n  Cache-Control: no-cache\n",
+		"/posts/hello\n  Cache-Control: no-cache\n",
+		"/pt-BR/archive\n  Cache-Control: no-cache\n",
+	} {
+		if !strings.Contains(string(headers), s) {
+			t.Errorf("%v doesn't contain %q", headersFilename, s)
+		}
+	}
+
+	// a _headers file in the passthrough dir conflicts with the generated one.
+	passthroughPath := path.Join(inPath, defaultPassthroughDir)
+	if err := os.MkdirAll(passthroughPath, os.ModeDir|os.ModePerm); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	if err := os.WriteFile(path.Join(passthroughPath, headersFilename), nil, 0644); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	if err := Build(BuildConfig{InPath: inPath, OutPath: outPath}); err == nil {
+		t.Error("expected an error")
+	}
+}
+
+func TestBuild_redirects(t *testing.T) {
+	latexGenerator = &latexTestGenerator{}
+
+	inPath := copyTestBuildInPath(t, `redirects:
+  - from: /old
+    to: /new
+  - from: hi
+    to: hello
+    status: 302
+    post: true
+`)
+
+	outPath := path.Join(t.TempDir(), "out")
+
+	if err := Build(BuildConfig{InPath: inPath, OutPath: outPath}); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	redirects, err := os.ReadFile(path.Join(outPath, redirectsFilename))
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	expected := "/old /new 301\n/posts/hi /posts/hello 302\n/pt-BR/posts/hi /pt-BR/posts/hello 302\n"
+	if string(redirects) != expected {
+		t.Errorf("got %q, want %q", redirects, expected)
+	}
+}
+
+func TestBuild_defaultImgAlt(t *testing.T) {
+	latexGenerator = &latexTestGenerator{}
+
+	inPath := copyTestBuildInPath(t, "defaultImgAlt:\n  en: A default alt\n  pt-BR: Um alt padrão\n")
+
+	// the en version of hello doesn't have an imgAlt anymore, while the pt-BR one keeps its own.
+	contentPath := path.Join(inPath, "posts", "hello", "content_en.md")
+	content, err := os.ReadFile(contentPath)
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	content = bytes.Replace(content, []byte("imgAlt: A blue rectangle\n"), nil, 1)
+
+	if err := os.WriteFile(contentPath, content, 0644); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	outPath := path.Join(t.TempDir(), "out")
+
+	b, err := NewBuilder(BuildConfig{InPath: inPath, OutPath: outPath})
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	if err := b.Build(); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	tests := []struct {
+		p           string
+		expectedAlt string
+	}{
+		{"posts/hello/index.html", `alt="A default alt"`},
+		{"pt-BR/posts/hello/index.html", `alt="Um retângulo azul"`},
+	}
+
+	for _, test := range tests {
+		content, err := os.ReadFile(path.Join(outPath, test.p))
+		if err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+
+		if !bytes.Contains(content, []byte(test.expectedAlt)) {
+			t.Errorf("expected %v to contain %v", test.p, test.expectedAlt)
+		}
+	}
+}
+
+func TestBuild_postsPath(t *testing.T) {
+	latexGenerator = &latexTestGenerator{}
+
+	inPath := copyTestBuildInPath(t, "postsPath: blog\n")
+
+	outPath := path.Join(t.TempDir(), "out")
+
+	if err := Build(BuildConfig{InPath: inPath, OutPath: outPath}); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	for _, relPath := range []string{"posts", path.Join("pt-BR", "posts")} {
+		if _, err := os.Stat(path.Join(outPath, relPath)); !os.IsNotExist(err) {
+			t.Errorf("%v should not exist", relPath)
+		}
+	}
+
+	for _, relPath := range []string{
+		path.Join("blog", "hello", "index.html"),
+		path.Join("blog", "hello", "reader", "index.html"),
+		path.Join("pt-BR", "blog", "hello", "index.html"),
+	} {
+		if _, err := os.Stat(path.Join(outPath, relPath)); err != nil {
+			t.Errorf("unexpected err: %v", err)
+		}
+	}
+
+	postHTML, err := os.ReadFile(path.Join(outPath, "blog", "hello", "index.html"))
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	for _, link := range []string{"https://foo.bar/blog/hello", "https://foo.bar/pt-BR/blog/hello"} {
+		if !strings.Contains(string(postHTML), `"`+link+`"`) {
+			t.Errorf("post doesn't contain %v", link)
+		}
+	}
+
+	if strings.Contains(string(postHTML), "/posts/") {
+		t.Errorf("post links to /posts/")
+	}
+}
+
+func TestBuild_trailingSlash(t *testing.T) {
+	latexGenerator = &latexTestGenerator{}
+
+	tests := []struct {
+		trailingSlash bool
+		// linksByFile maps the path of output files to links they must contain.
+		linksByFile map[string][]string
+	}{
+		{false, map[string][]string{
+			"posts/hello/index.html":        {`"https://foo.bar/posts/hello"`, `"https://foo.bar/pt-BR/posts/hello"`},
+			"posts/hello/reader/index.html": {`"https://foo.bar/posts/hello/reader"`},
+		}},
+		{true, map[string][]string{
+			"posts/hello/index.html":        {`"https://foo.bar/posts/hello/"`, `"https://foo.bar/pt-BR/posts/hello/"`},
+			"posts/hello/reader/index.html": {`"https://foo.bar/posts/hello/reader/"`},
+		}},
+	}
+
+	for _, test := range tests {
+		t.Run(fmt.Sprintf("trailingSlash=%v", test.trailingSlash), func(t *testing.T) {
+			inPath := copyTestBuildInPath(t, fmt.Sprintf("trailingSlash: %v\n", test.trailingSlash))
+
+			outPath := path.Join(t.TempDir(), "out")
+
+			if err := Build(BuildConfig{InPath: inPath, OutPath: outPath}); err != nil {
+				t.Fatalf("unexpected err: %v", err)
+			}
+
+			for relPath, links := range test.linksByFile {
+				content, err := os.ReadFile(path.Join(outPath, relPath))
+				if err != nil {
+					t.Fatalf("unexpected err: %v", err)
+				}
+
+				for _, link := range links {
+					if !strings.Contains(string(content), link) {
+						t.Errorf("%v doesn't contain %v", relPath, link)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestBuild_uglyURLs(t *testing.T) {
+	latexGenerator = &latexTestGenerator{}
+
+	inPath := copyTestBuildInPath(t, "uglyURLs: true\n")
+	outPath := path.Join(t.TempDir(), "out")
+
+	if err := Build(BuildConfig{InPath: inPath, OutPath: outPath}); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	for _, relPath := range []string{"posts/hello/index.html", "archive/index.html"} {
+		if _, err := os.Stat(path.Join(outPath, relPath)); !os.IsNotExist(err) {
+			t.Errorf("%v should not exist", relPath)
+		}
+	}
+
+	// linksByFile maps the path of output files to links they must contain.
+	linksByFile := map[string][]string{
+		"index.html":                    {`"https://foo.bar"`},
+		"pt-BR/index.html":              {`"https://foo.bar/pt-BR"`},
+		"posts/hello.html":              {`"https://foo.bar/posts/hello.html"`, `"https://foo.bar/pt-BR/posts/hello.html"`},
+		"posts/hello/reader.html":       {`"https://foo.bar/posts/hello/reader.html"`},
+		"pt-BR/posts/hello/reader.html": {`"https://foo.bar/pt-BR/posts/hello/reader.html"`},
+		"pt-BR/posts/glossary.html":     {`"https://foo.bar/pt-BR/posts/glossary.html"`},
+		"archive.html":                  {`"https://foo.bar/archive.html"`, `"/posts/hello.html"`},
+	}
+
+	for relPath, links := range linksByFile {
+		content, err := os.ReadFile(path.Join(outPath, relPath))
+		if err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+
+		for _, link := range links {
+			if !strings.Contains(string(content), link) {
+				t.Errorf("%v doesn't contain %v", relPath, link)
+			}
+		}
+	}
+}
+
+func TestBuild_skipEmptyPosts(t *testing.T) {
+	latexGenerator = &latexTestGenerator{}
+
+	tests := []struct {
+		skipEmptyPosts bool
+		// contentFiles are the content files of the draft post.
+		contentFiles []string
+		err          bool
+	}{
+		{false, nil, true},
+		{true, nil, false},
+		// a post missing only some of the content files isn't empty.
+		{true, []string{"content_en.md"}, true},
+	}
+
+	for _, test := range tests {
+		t.Run(fmt.Sprintf("skipEmptyPosts=%v,contentFiles=%v", test.skipEmptyPosts, test.contentFiles), func(t *testing.T) {
+			inPath := copyTestBuildInPath(t, "")
+
+			// a post with only its data.yaml file, as if it had just been created, and contentFiles.
+			emptyPostPath := path.Join(inPath, "posts", "draft")
+			if err := os.Mkdir(emptyPostPath, os.ModeDir|os.ModePerm); err != nil {
+				t.Fatalf("unexpected err: %v", err)
+			}
+
+			if err := os.WriteFile(path.Join(emptyPostPath, "data.yaml"), []byte("date: 2023-06-01T00:00:00Z\n"), 0644); err != nil {
+				t.Fatalf("unexpected err: %v", err)
+			}
+
+			for _, contentFile := range test.contentFiles {
+				content := "---\ntitle: Draft\nexcerpt: Draft\n---\nDraft"
+				if err := os.WriteFile(path.Join(emptyPostPath, contentFile), []byte(content), 0644); err != nil {
+					t.Fatalf("unexpected err: %v", err)
+				}
+			}
+
+			var buff bytes.Buffer
+			oldOutput := logs.Output
+			logs.Output = &buff
+			t.Cleanup(func() { logs.Output = oldOutput })
+
+			outPath := path.Join(t.TempDir(), "out")
+
+			err := Build(BuildConfig{InPath: inPath, OutPath: outPath, SkipEmptyPosts: test.skipEmptyPosts})
+			if test.err {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected err: %v", err)
+			}
+
+			if !strings.Contains(buff.String(), "warning: skipping post, since it doesn't have any content file post=draft") {
+				t.Errorf("got %q, want a warning about the draft post", buff.String())
+			}
+
+			if _, err := os.Stat(path.Join(outPath, "posts", "draft")); !os.IsNotExist(err) {
+				t.Errorf("posts/draft should not exist")
+			}
+
+			if _, err := os.Stat(path.Join(outPath, "posts", "hello", "index.html")); err != nil {
+				t.Errorf("unexpected err: %v", err)
+			}
+		})
+	}
+}
+
+func TestBuild_logger(t *testing.T) {
+	latexGenerator = &latexTestGenerator{}
+
+	inPath := copyTestBuildInPath(t, "")
+
+	emptyPostPath := path.Join(inPath, "posts", "draft")
+	if err := os.Mkdir(emptyPostPath, os.ModeDir|os.ModePerm); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	if err := os.WriteFile(path.Join(emptyPostPath, "data.yaml"), []byte("date: 2023-06-01T00:00:00Z\n"), 0644); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	var stderrBuff bytes.Buffer
+	oldOutput := logs.Output
+	logs.Output = &stderrBuff
+	t.Cleanup(func() { logs.Output = oldOutput })
+
+	var buff bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&buff, &slog.HandlerOptions{
+		ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+			if a.Key == slog.TimeKey && len(groups) == 0 {
+				return slog.Attr{}
+			}
+
+			return a
+		},
+	}))
+
+	err := Build(BuildConfig{
+		InPath:         inPath,
+		OutPath:        path.Join(t.TempDir(), "out"),
+		SkipEmptyPosts: true,
+		Logger:         logger,
+	})
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	expected := "level=WARN msg=\"skipping post, since it doesn't have any content file\" post=draft\n"
+	if got := buff.String(); got != expected {
+		t.Errorf("got %q, want %q", got, expected)
+	}
+
+	if stderrBuff.Len() > 0 {
+		t.Errorf("got %q, want nothing written to logs.Output", stderrBuff.String())
+	}
+}
+
+func TestBuild_timezone(t *testing.T) {
+	latexGenerator = &latexTestGenerator{}
+
+	inPath := copyTestBuildInPath(t, "timezone: Asia/Tokyo\n")
+
+	dataFiles := map[string]string{
+		"glossary": "feed: true\ndate: 2023-06-01T10:00:00+02:00\n",
+		"hello":    "feed: true\ndate: 2024-01-01T00:00:00-03:00\nlastUpdateDate: 2024-01-02T12:00:00Z\nimg: page.png\nogImage: og.png\n",
+	}
+
+	for slug, content := range dataFiles {
+		if err := os.WriteFile(path.Join(inPath, "posts", slug, "data.yaml"), []byte(content), 0644); err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+	}
+
+	b, err := NewBuilder(BuildConfig{InPath: inPath, OutPath: path.Join(t.TempDir(), "out")})
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	if err := b.Build(); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	expected := map[string][]string{
+		"glossary": {"2023-06-01T17:00:00+09:00", "0001-01-01T00:00:00Z"},
+		"hello":    {"2024-01-01T12:00:00+09:00", "2024-01-02T21:00:00+09:00"},
+	}
+
+	for _, l := range b.c.Langs {
+		for _, p := range b.out.postsLists.allPostsByLangTag[l.Tag] {
+			got := []string{p.Date.Format(time.RFC3339), p.LastUpdateDate.Format(time.RFC3339)}
+			if !reflect.DeepEqual(got, expected[p.Slug]) {
+				t.Errorf("got %v dates for %v post (%v), want %v", got, p.Slug, l.Tag, expected[p.Slug])
+			}
+
+			if p.Date.Location().String() != "Asia/Tokyo" {
+				t.Errorf("got %v location for %v post (%v), want Asia/Tokyo", p.Date.Location(), p.Slug, l.Tag)
+			}
+		}
+	}
+}
+
+func TestBuild_dateOnlyPostDate(t *testing.T) {
+	latexGenerator = &latexTestGenerator{}
+
+	inPath := copyTestBuildInPath(t, "timezone: America/Sao_Paulo\n")
+
+	dataYAML := "feed: true\ndate: 2023-06-01\nlastUpdateDate: 2023-06-02\n"
+	if err := os.WriteFile(path.Join(inPath, "posts", "glossary", "data.yaml"), []byte(dataYAML), 0644); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	b, err := NewBuilder(BuildConfig{InPath: inPath, OutPath: path.Join(t.TempDir(), "out")})
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	if err := b.Build(); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	posts := b.out.postsLists.allPostsByLangTag["en"]
+
+	i := slices.IndexFunc(posts, func(p *Post) bool { return p.Slug == "glossary" })
+	if i == -1 {
+		t.Fatal("glossary post not found")
+	}
+
+	expected := []string{"2023-06-01T00:00:00-03:00", "2023-06-02T00:00:00-03:00"}
+	if got := []string{posts[i].Date.Format(time.RFC3339), posts[i].LastUpdateDate.Format(time.RFC3339)}; !reflect.DeepEqual(got, expected) {
+		t.Errorf("got %v, want %v", got, expected)
+	}
+}
+
+func TestBuild_postsPage(t *testing.T) {
+	latexGenerator = &latexTestGenerator{}
+
+	for _, withTemplate := range []bool{false, true} {
+		t.Run(fmt.Sprintf("withTemplate=%v", withTemplate), func(t *testing.T) {
+			inPath := copyTestBuildInPath(t, "")
+
+			if withTemplate {
+				content := `<p>{{ .Page }} {{ .URL }}</p>{{ range .Posts }}<a href="{{ .URL }}">{{ .Title }}</a>{{ end }}`
+				if err := os.WriteFile(path.Join(inPath, "pages", "posts.html"), []byte(content), 0644); err != nil {
+					t.Fatalf("unexpected err: %v", err)
+				}
+			}
+
+			outPath := path.Join(t.TempDir(), "out")
+
+			if err := Build(BuildConfig{InPath: inPath, OutPath: outPath}); err != nil {
+				t.Fatalf("unexpected err: %v", err)
+			}
+
+			expected := map[string]string{
+				"posts/index.html":       `<p>posts /posts</p><a href="/posts/hello">Hello</a><a href="/posts/glossary">Glossary</a>`,
+				"pt-BR/posts/index.html": `<p>posts /pt-BR/posts</p><a href="/pt-BR/posts/hello">Olá</a><a href="/pt-BR/posts/glossary">Glossário</a>`,
+			}
+
+			for relPath, content := range expected {
+				res, err := os.ReadFile(path.Join(outPath, relPath))
+				if !withTemplate {
+					if !os.IsNotExist(err) {
+						t.Errorf("%v should not exist", relPath)
+					}
+
+					continue
+				}
+				if err != nil {
+					t.Fatalf("unexpected err: %v", err)
+				}
+
+				if !strings.Contains(string(res), content) {
+					t.Errorf("got %q for %v, want it to contain %q", res, relPath, content)
+				}
+			}
+
+			if _, err := os.Stat(path.Join(outPath, "posts", "hello", "index.html")); err != nil {
+				t.Errorf("unexpected err: %v", err)
+			}
+		})
+	}
+}
+
+func TestBuild_postAssetsDir(t *testing.T) {
+	latexGenerator = &latexTestGenerator{}
+
+	// build returns the html of the en page of the hello post and the files of its assets.
+	build := func(t *testing.T, inPath string) (string, []string) {
+		t.Helper()
+
+		outPath := path.Join(t.TempDir(), "out")
+		if err := Build(BuildConfig{InPath: inPath, OutPath: outPath, VerifyOutput: true}); err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+
+		html, err := os.ReadFile(path.Join(outPath, "posts", "hello", "index.html"))
+		if err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+
+		var files []string
+
+		err = fs.WalkDir(os.DirFS(path.Join(outPath, "assets", "hello")), ".", func(p string, d fs.DirEntry, err error) error {
+			if err == nil && !d.IsDir() {
+				files = append(files, p)
+			}
+
+			return err
+		})
+		if err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+
+		return string(html), files
+	}
+
+	flatHTML, flatFiles := build(t, copyTestBuildInPath(t, ""))
+
+	inPath := copyTestBuildInPath(t, "postAssetsDir: assets\n")
+	postPath := path.Join(inPath, "posts", "hello")
+
+	if err := os.MkdirAll(path.Join(postPath, "assets", "extra"), 0755); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	for _, name := range []string{"clip.mp4", "og.png", "page.png", "song.mp3"} {
+		if err := os.Rename(path.Join(postPath, name), path.Join(postPath, "assets", name)); err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+	}
+
+	// subdirectories are part of the PAT, while files outside of it aren't.
+	if err := os.WriteFile(path.Join(postPath, "assets", "extra", "notes.txt"), []byte("notes"), 0644); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	if err := os.WriteFile(path.Join(postPath, "draft.txt"), []byte("draft"), 0644); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	// the glossary post doesn't have the directory, so its PAT is empty.
+	html, files := build(t, inPath)
+
+	if html != flatHTML {
+		t.Errorf("got %q, want the same html as in the flat layout, %q", html, flatHTML)
+	}
+
+	var extraFiles []string
+	for _, f := range files {
+		if !slices.Contains(flatFiles, f) {
+			extraFiles = append(extraFiles, f)
+		}
+	}
+
+	if len(files) != len(flatFiles)+1 || len(extraFiles) != 1 || !strings.HasPrefix(extraFiles[0], "extra/notes-") {
+		t.Errorf("got %v files, want %v and extra/notes-<md5>.txt", files, flatFiles)
+	}
+
+	for _, dir := range []string{".", "../assets", "/assets"} {
+		inPath := copyTestBuildInPath(t, fmt.Sprintf("postAssetsDir: %q\n", dir))
+		if err := Build(BuildConfig{InPath: inPath, OutPath: path.Join(t.TempDir(), "out")}); err == nil {
+			t.Errorf("expected an error for %v", dir)
+		}
+	}
+}
+
+func TestBuild_preconnect(t *testing.T) {
+	latexGenerator = &latexTestGenerator{}
+
+	inPath := copyTestBuildInPath(t, "preconnect:\n  - https://fonts.gstatic.com/\n  - http://localhost:8080\n")
+	outPath := path.Join(t.TempDir(), "out")
+
+	if err := Build(BuildConfig{InPath: inPath, OutPath: outPath}); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	expected := `<link rel="preconnect" href="https://fonts.gstatic.com">` +
+		"\n" + `<link rel="dns-prefetch" href="https://fonts.gstatic.com">` +
+		"\n" + `<link rel="preconnect" href="http://localhost:8080">` +
+		"\n" + `<link rel="dns-prefetch" href="http://localhost:8080">`
+
+	for _, relPath := range []string{"index.html", "pt-BR/index.html", "posts/hello/index.html", "archive/index.html"} {
+		html, err := os.ReadFile(path.Join(outPath, relPath))
+		if err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+
+		if !strings.Contains(string(html), expected) {
+			t.Errorf("got %q for %v, want it to contain %q", html, relPath, expected)
+		}
+	}
+
+	inPath = copyTestBuildInPath(t, "preconnect:\n  - https://fonts.gstatic.com/css\n")
+	if err := Build(BuildConfig{InPath: inPath, OutPath: path.Join(t.TempDir(), "out")}); err == nil {
+		t.Error("expected an error for an origin with a path")
+	}
+}
+
+func TestBuild_rootStrategy(t *testing.T) {
+	latexGenerator = &latexTestGenerator{}
+
+	picker := `<ul>` +
+		"\n" + `<li><a href="/en" hreflang="en" lang="en">English</a></li><li><a href="/pt-BR" hreflang="pt-BR" lang="pt-BR">Português do Brasil</a></li>` +
+		"\n" + `</ul>`
+
+	tests := []struct {
+		strategy string
+		// homePath is the path of the home page of the default lang in outPath.
+		homePath string
+		// homeURL is the URL of the home page of the default lang.
+		homeURL string
+		// expected are the strings the file at the root of outPath must contain.
+		expected []string
+		// notExpected are the strings it mustn't contain.
+		notExpected []string
+	}{
+		{
+			strategy:    "",
+			homePath:    "index.html",
+			homeURL:     "https://foo.bar",
+			expected:    []string{`<meta property="og:url" content="https://foo.bar">`},
+			notExpected: []string{"location.replace"},
+		},
+		{
+			strategy:    "default",
+			homePath:    "index.html",
+			homeURL:     "https://foo.bar",
+			expected:    []string{`<meta property="og:url" content="https://foo.bar">`},
+			notExpected: []string{"location.replace"},
+		},
+		{
+			strategy: "redirect",
+			homePath: "en/index.html",
+			homeURL:  "https://foo.bar/en",
+			expected: []string{
+				`var homes = {"en":"/en","pt":"/pt-BR","pt-br":"/pt-BR"};`,
+				`location.replace("/en");`,
+				`<noscript><meta http-equiv="refresh" content="0; url=/en"></noscript>`,
+				picker,
+			},
+		},
+		{
+			strategy:    "picker",
+			homePath:    "en/index.html",
+			homeURL:     "https://foo.bar/en",
+			expected:    []string{picker},
+			notExpected: []string{"location.replace", "http-equiv"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.strategy, func(t *testing.T) {
+			var configLines string
+			if test.strategy != "" {
+				configLines = fmt.Sprintf("rootStrategy: %v\n", test.strategy)
+			}
+
+			inPath := copyTestBuildInPath(t, configLines)
+			outPath := path.Join(t.TempDir(), "out")
+
+			if err := Build(BuildConfig{InPath: inPath, OutPath: outPath}); err != nil {
+				t.Fatalf("unexpected err: %v", err)
+			}
+
+			root, err := os.ReadFile(path.Join(outPath, "index.html"))
+			if err != nil {
+				t.Fatalf("unexpected err: %v", err)
+			}
+
+			for _, s := range test.expected {
+				if !strings.Contains(string(root), s) {
+					t.Errorf("got %q, want it to contain %q", root, s)
+				}
+			}
+
+			for _, s := range test.notExpected {
+				if strings.Contains(string(root), s) {
+					t.Errorf("got %q, want it not to contain %q", root, s)
+				}
+			}
+
+			home, err := os.ReadFile(path.Join(outPath, test.homePath))
+			if err != nil {
+				t.Fatalf("unexpected err: %v", err)
+			}
+
+			// the home page of pt-BR links to the one of the default lang.
+			ptHome, err := os.ReadFile(path.Join(outPath, "pt-BR/index.html"))
+			if err != nil {
+				t.Fatalf("unexpected err: %v", err)
+			}
+
+			expectedLink := fmt.Sprintf(`<link rel="alternate" hreflang="en" href="%v">`, test.homeURL)
+
+			for _, html := range [][]byte{home, ptHome} {
+				if !strings.Contains(string(html), expectedLink) {
+					t.Errorf("got %q, want it to contain %q", html, expectedLink)
+				}
+			}
+		})
+	}
+
+	inPath := copyTestBuildInPath(t, "rootStrategy: detect\n")
+	if err := Build(BuildConfig{InPath: inPath, OutPath: path.Join(t.TempDir(), "out")}); err == nil {
+		t.Error("expected an error for an unknown root strategy")
+	}
+}
+
+func TestBuild_outputManifest(t *testing.T) {
+	latexGenerator = &latexTestGenerator{}
+
+	inPath := copyTestBuildInPath(t, "outputManifest: true\n")
+	outPath := path.Join(t.TempDir(), "out")
+
+	b, err := NewBuilder(BuildConfig{InPath: inPath, OutPath: outPath})
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	if err := b.Build(); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	readManifest := func() map[string]string {
+		t.Helper()
+
+		content, err := os.ReadFile(path.Join(outPath, "manifest.json"))
+		if err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+
+		var manifest map[string]string
+		if err := json.Unmarshal(content, &manifest); err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+
+		return manifest
+	}
+
+	manifest := readManifest()
+
+	if _, ok := manifest["manifest.json"]; ok {
+		t.Error("expected the manifest not to list itself")
+	}
+
+	var n int
+
+	err = filepath.WalkDir(outPath, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || d.Name() == "manifest.json" {
+			return err
+		}
+
+		n++
+
+		relPath, _ := filepath.Rel(outPath, p)
+
+		content, err := os.ReadFile(p)
+		if err != nil {
+			return err
+		}
+
+		if expected := fmt.Sprintf("%x", sha256.Sum256(content)); manifest[relPath] != expected {
+			t.Errorf("got %q for %v, want %q", manifest[relPath], relPath, expected)
+		}
+
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	if len(manifest) != n {
+		t.Errorf("got %v files in manifest, want %v", len(manifest), n)
+	}
+
+	for _, relPath := range []string{"index.html", "pt-BR/index.html", "posts/hello/index.html"} {
+		if _, ok := manifest[relPath]; !ok {
+			t.Errorf("expected %v in manifest", relPath)
+		}
+	}
+
+	// BuildPost rewrites the manifest with the new hashes of the pages of the post.
+	contentPath := path.Join(inPath, "posts/hello/content_en.md")
+
+	content, err := os.ReadFile(contentPath)
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	if err := os.WriteFile(contentPath, append(content, "\nMore text.\n"...), 0644); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	if err := b.BuildPost("hello"); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	newManifest := readManifest()
+
+	if newManifest["posts/hello/index.html"] == manifest["posts/hello/index.html"] {
+		t.Error("expected the hash of posts/hello/index.html to change")
+	}
+
+	if newManifest["index.html"] != manifest["index.html"] {
+		t.Error("expected the hash of index.html not to change")
+	}
+}
+
+func TestBuild_outputManifestKeep(t *testing.T) {
+	latexGenerator = &latexTestGenerator{}
+
+	for _, atomicOutput := range []bool{false, true} {
+		t.Run(fmt.Sprintf("atomicOutput=%v", atomicOutput), func(t *testing.T) {
+			inPath := copyTestBuildInPath(t, "outputManifest: true\n")
+			outPath := path.Join(t.TempDir(), "out")
+
+			if err := os.MkdirAll(path.Join(outPath, "media"), os.ModePerm); err != nil {
+				t.Fatalf("unexpected err: %v", err)
+			}
+
+			if err := os.WriteFile(path.Join(outPath, "media", "photo.txt"), []byte("photo"), 0644); err != nil {
+				t.Fatalf("unexpected err: %v", err)
+			}
+
+			err := Build(BuildConfig{
+				InPath:       inPath,
+				OutPath:      outPath,
+				Keep:         []string{"media"},
+				AtomicOutput: atomicOutput,
+			})
+			if err != nil {
+				t.Fatalf("unexpected err: %v", err)
+			}
+
+			content, err := os.ReadFile(path.Join(outPath, "manifest.json"))
+			if err != nil {
+				t.Fatalf("unexpected err: %v", err)
+			}
+
+			var manifest map[string]string
+			if err := json.Unmarshal(content, &manifest); err != nil {
+				t.Fatalf("unexpected err: %v", err)
+			}
+
+			if expected := fmt.Sprintf("%x", sha256.Sum256([]byte("photo"))); manifest["media/photo.txt"] != expected {
+				t.Errorf("got %q for media/photo.txt, want %q", manifest["media/photo.txt"], expected)
+			}
+		})
+	}
+}
+
+func TestBuild_postIndexingFlags(t *testing.T) {
+	latexGenerator = &latexTestGenerator{}
+
+	inPath := copyTestBuildInPath(t, "")
+	outPath := path.Join(t.TempDir(), "out")
+
+	for slug, lines := range map[string]string{
+		"hello":    "noFeed: true\nnoIndex: true\n",
+		"glossary": "noSitemap: true\n",
+	} {
+		appendTestConfigLines(t, path.Join(inPath, "posts", slug, "data.yaml"), "\n"+lines)
+	}
+
+	b, err := NewBuilder(BuildConfig{InPath: inPath, OutPath: outPath})
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	if err := b.Build(); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	lists := b.out.postsLists
+
+	for _, l := range b.c.Langs {
+		var feedSlugs, visibleSlugs []string
+
+		for _, p := range lists.feedPostsByLangTag[l.Tag] {
+			feedSlugs = append(feedSlugs, p.Slug)
+		}
+
+		for _, p := range lists.visiblePostsByLangTag[l.Tag] {
+			visibleSlugs = append(visibleSlugs, p.Slug)
+		}
+
+		// noFeed doesn't affect whether the post is listed.
+		if expected := []string{"glossary"}; !reflect.DeepEqual(feedSlugs, expected) {
+			t.Errorf("got %v feed posts in %v, want %v", feedSlugs, l.Tag, expected)
+		}
+
+		if expected := []string{"hello", "glossary"}; !reflect.DeepEqual(visibleSlugs, expected) {
+			t.Errorf("got %v visible posts in %v, want %v", visibleSlugs, l.Tag, expected)
+		}
+
+		for _, p := range lists.allPostsByLangTag[l.Tag] {
+			if expected := p.Slug == "glossary"; p.NoSitemap != expected {
+				t.Errorf("got NoSitemap = %v for %v post in %v, want %v", p.NoSitemap, p.Slug, l.Tag, expected)
+			}
+
+			if expected := p.Slug == "hello"; p.NoIndex != expected {
+				t.Errorf("got NoIndex = %v for %v post in %v, want %v", p.NoIndex, p.Slug, l.Tag, expected)
+			}
+		}
+	}
+
+	robots := `<meta name="robots" content="noindex">`
+
+	for relPath, expected := range map[string]bool{
+		"posts/hello/index.html":       true,
+		"pt-BR/posts/hello/index.html": true,
+		"posts/glossary/index.html":    false,
+		"index.html":                   false,
+	} {
+		html, err := os.ReadFile(path.Join(outPath, relPath))
+		if err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+
+		if got := strings.Contains(string(html), robots); got != expected {
+			t.Errorf("got %v for whether %v has %q, want %v", got, relPath, robots, expected)
+		}
+	}
+}
+
+func TestBuild_contentExtensions(t *testing.T) {
+	latexGenerator = &latexTestGenerator{}
+
+	inPath := copyTestBuildInPath(t, "contentExtensions: [.md, .markdown]\n")
+	outPath := path.Join(t.TempDir(), "out")
+
+	postPath := path.Join(inPath, "posts", "hello")
+	if err := os.Rename(path.Join(postPath, "content_pt-BR.md"), path.Join(postPath, "content_pt-BR.markdown")); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	b, err := NewBuilder(BuildConfig{InPath: inPath, OutPath: outPath})
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	if err := b.Build(); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	var titles []string
+	for _, p := range b.out.postsLists.allPostsByLangTag["pt-BR"] {
+		titles = append(titles, p.Title)
+	}
+
+	if expected := []string{"Glossário", "Olá"}; !reflect.DeepEqual(titles, expected) {
+		t.Errorf("got %v, want %v", titles, expected)
+	}
+
+	if _, err := os.Stat(path.Join(outPath, "pt-BR/posts/hello/index.html")); err != nil {
+		t.Errorf("unexpected err: %v", err)
+	}
+
+	// the .markdown content file isn't in the PAT of the post.
+	if n, _ := findByRelPathInGATOrPAT(nil, b.out.postsLists.findPostBySlug("hello").pat, "content_pt-BR.markdown"); n != nil {
+		t.Error("expected content_pt-BR.markdown not to be in the PAT of hello")
+	}
+}
+
+func TestBuild_duplicateSlugs(t *testing.T) {
+	latexGenerator = &latexTestGenerator{}
+
+	inPath := copyTestBuildInPath(t, "normalizeSlugs: true\n")
+	outPath := path.Join(t.TempDir(), "out")
+
+	// "Hello" is normalized into hello, which is the slug of the hello post.
+	if err := copyDirRec(path.Join(inPath, "posts", "hello"), path.Join(inPath, "posts", "Hello"), defaultOutputPerms); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	// the previous output is left as it is.
+	if err := os.MkdirAll(outPath, os.ModeDir|os.ModePerm); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	if err := os.WriteFile(path.Join(outPath, "index.html"), []byte("previous"), 0644); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	err := Build(BuildConfig{InPath: inPath, OutPath: outPath})
+
+	expectedErr := `reading posts of posts section: "Hello" and "hello" post directories have the same slug: hello`
+	if err == nil || err.Error() != expectedErr {
+		t.Fatalf("got %v, want %v", err, expectedErr)
+	}
+
+	entries, err := os.ReadDir(outPath)
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	if len(entries) != 1 {
+		t.Errorf("got %v entries in outPath, want only index.html", len(entries))
+	}
+
+	content, err := os.ReadFile(path.Join(outPath, "index.html"))
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	if string(content) != "previous" {
+		t.Errorf("got %q, want the previous index.html", content)
+	}
+}
+
+func TestLatestPosts(t *testing.T) {
+	pinned := &Post{Slug: "pinned", Weight: 1, Date: time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC)}
+	oldest := &Post{Slug: "oldest", Date: time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC)}
+	middle := &Post{Slug: "middle", Date: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)}
+	newest := &Post{Slug: "newest", Date: time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)}
+
+	posts := []*Post{pinned, newest, middle, oldest}
+
+	tests := []struct {
+		n        int
+		expected []*Post
+	}{
+		{0, posts},
+		{1, []*Post{newest}},
+		{2, []*Post{newest, middle}},
+		// the order of posts is kept, so pinned posts among the latest ones come first.
+		{4, posts},
+		{10, posts},
+	}
+
+	for _, test := range tests {
+		t.Run(strconv.Itoa(test.n), func(t *testing.T) {
+			if got := latestPosts(posts, test.n); !reflect.DeepEqual(got, test.expected) {
+				t.Errorf("got %v, want %v", got, test.expected)
+			}
+		})
+	}
+
+	pinned.Date = time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	if got, expected := latestPosts(posts, 2), []*Post{pinned, newest}; !reflect.DeepEqual(got, expected) {
+		t.Errorf("got %v, want %v", got, expected)
+	}
+}
+
+func TestBuild_homePostsLimit(t *testing.T) {
+	latexGenerator = &latexTestGenerator{}
+
+	for _, test := range []struct {
+		limit    int
+		expected string
+	}{
+		{0, "<p>hello</p><p>glossary</p>"},
+		{1, "<p>hello</p>"},
+	} {
+		t.Run(strconv.Itoa(test.limit), func(t *testing.T) {
+			inPath := copyTestBuildInPath(t, fmt.Sprintf("homePostsLimit: %v\n", test.limit))
+			outPath := path.Join(t.TempDir(), "out")
+
+			list := `{{ range .Posts }}<p>{{ .Slug }}</p>{{ end }}`
+			for _, name := range []string{"home.html", "posts.html"} {
+				if err := os.WriteFile(path.Join(inPath, "pages", name), []byte(list), 0644); err != nil {
+					t.Fatalf("unexpected err: %v", err)
+				}
+			}
+
+			if err := Build(BuildConfig{InPath: inPath, OutPath: outPath}); err != nil {
+				t.Fatalf("unexpected err: %v", err)
+			}
+
+			for relPath, expected := range map[string]string{
+				"index.html":       test.expected,
+				"pt-BR/index.html": test.expected,
+				// the posts pages list every post.
+				"posts/index.html": "<p>hello</p><p>glossary</p>",
+			} {
+				html, err := os.ReadFile(path.Join(outPath, relPath))
+				if err != nil {
+					t.Fatalf("unexpected err: %v", err)
+				}
+
+				if !strings.Contains(string(html), expected) {
+					t.Errorf("got %q for %v, want it to contain %q", html, relPath, expected)
+				}
+
+				if n := strings.Count(string(html), "<p>"); n != strings.Count(expected, "<p>") {
+					t.Errorf("got %v posts in %v, want %v", n, relPath, strings.Count(expected, "<p>"))
+				}
+			}
+		})
+	}
+
+	inPath := copyTestBuildInPath(t, "homePostsLimit: -1\n")
+	if err := Build(BuildConfig{InPath: inPath, OutPath: path.Join(t.TempDir(), "out")}); err == nil {
+		t.Error("expected an error for a negative limit")
+	}
+}
+
+func TestBuild_perms(t *testing.T) {
+	latexGenerator = &latexTestGenerator{}
+
+	umask := testUmask(t)
+
+	tests := []struct {
+		name              string
+		dirPerm, filePerm os.FileMode
+		atomicOutput      bool
+		expectedDirPerm   os.FileMode
+		expectedFilePerm  os.FileMode
+	}{
+		{"default", 0, 0, false, os.ModePerm, 0666},
+		{"custom", 0750, 0600, false, 0750, 0600},
+		{"custom atomic", 0750, 0600, true, 0750, 0600},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			// social cards are included, since they're generated apart from the other assets.
+			inPath := copyTestBuildInPath(t, "generateSocialCards: true\n")
+			outPath := path.Join(t.TempDir(), "out")
+
+			if err := os.MkdirAll(path.Join(inPath, "root"), os.ModePerm); err != nil {
+				t.Fatalf("unexpected err: %v", err)
+			}
+
+			if err := os.WriteFile(path.Join(inPath, "root", "robots.txt"), []byte("User-agent: *\n"), 0666); err != nil {
+				t.Fatalf("unexpected err: %v", err)
+			}
+
+			err := Build(BuildConfig{
+				InPath:       inPath,
+				OutPath:      outPath,
+				DirPerm:      test.dirPerm,
+				FilePerm:     test.filePerm,
+				AtomicOutput: test.atomicOutput,
+			})
+			if err != nil {
+				t.Fatalf("unexpected err: %v", err)
+			}
+
+			var socialCards int
+
+			// outPath itself is included.
+			err = filepath.WalkDir(outPath, func(p string, d fs.DirEntry, err error) error {
+				if err != nil {
+					return err
+				}
+
+				info, err := d.Info()
+				if err != nil {
+					return err
+				}
+
+				perm := info.Mode().Perm()
+
+				// the perms of both directories and files are subject to the umask.
+				if d.IsDir() {
+					if expected := test.expectedDirPerm &^ umask; perm != expected {
+						t.Errorf("got %v for %v, want %v", perm, p, expected)
+					}
+
+					return nil
+				}
+
+				if strings.HasPrefix(d.Name(), socialCardNamePrefix) {
+					socialCards++
+				}
+
+				if expected := test.expectedFilePerm &^ umask; perm != expected {
+					t.Errorf("got %v for %v, want %v", perm, p, expected)
+				}
+
+				return nil
+			})
+			if err != nil {
+				t.Fatalf("unexpected err: %v", err)
+			}
+
+			if socialCards == 0 {
+				t.Error("expected social cards in the output")
+			}
+		})
+	}
+}
+
+// testUmask returns the umask of the process, which is found by creating a directory,
+// since it can't be read without being changed.
+func testUmask(t *testing.T) os.FileMode {
+	t.Helper()
+
+	dirPath := path.Join(t.TempDir(), "umask")
+	if err := os.Mkdir(dirPath, os.ModePerm); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	info, err := os.Stat(dirPath)
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	return os.ModePerm &^ info.Mode().Perm()
+}
+
+func TestRunInParallel(t *testing.T) {
+	var calls atomic.Int32
+
+	err := runInParallel(limiter.New(4), 10, func(i int) error {
+		calls.Add(1)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	if calls.Load() != 10 {
+		t.Errorf("got %v calls, want 10", calls.Load())
+	}
+
+	err = runInParallel(limiter.New(4), 10, func(i int) error {
+		if i == 0 || i == 1 {
+			return fmt.Errorf("err %v", i)
+		}
+
+		return nil
+	})
+	if err == nil || err.Error() != "err 0" && err.Error() != "err 1" {
+		t.Errorf("got %v, want err 0 or err 1", err)
+	}
+}
+
+func TestRunInParallel_concurrency1(t *testing.T) {
+	var (
+		inFlight, maxInFlight atomic.Int32
+		order                 []int
+	)
+
+	err := runInParallel(limiter.New(1), 10, func(i int) error {
+		if n := inFlight.Add(1); n > maxInFlight.Load() {
+			maxInFlight.Store(n)
+		}
+		defer inFlight.Add(-1)
+
+		// order isn't guarded by a mutex, since calls must not overlap.
+		order = append(order, i)
+
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	if maxInFlight.Load() != 1 {
+		t.Errorf("got %v calls at the same time, want 1", maxInFlight.Load())
+	}
+
+	if expected := []int{0, 1, 2, 3, 4, 5, 6, 7, 8, 9}; !reflect.DeepEqual(order, expected) {
+		t.Errorf("got %v, want %v", order, expected)
+	}
+
+	// calls after a failure aren't started.
+	order = nil
+
+	err = runInParallel(limiter.New(1), 10, func(i int) error {
+		order = append(order, i)
+
+		if i == 2 {
+			return fmt.Errorf("err %v", i)
+		}
+
+		return nil
+	})
+	if err == nil || err.Error() != "err 2" {
+		t.Errorf("got %v, want err 2", err)
+	}
+
+	if expected := []int{0, 1, 2}; !reflect.DeepEqual(order, expected) {
+		t.Errorf("got %v, want %v", order, expected)
+	}
+}
+
+func TestBuild_concurrency1(t *testing.T) {
+	latexGenerator = &latexTestGenerator{}
+
+	inPath := copyTestBuildInPath(t, "")
+
+	// the langs are built in the order of the config file, so the template func is always
+	// called with en before pt-BR.
+	var langs []string
+
+	bc := BuildConfig{
+		InPath:      inPath,
+		Concurrency: 1,
+		TemplateFuncs: template.FuncMap{
+			"currentLang": func(l *Lang) string {
+				langs = append(langs, l.Tag)
+				return ""
+			},
+		},
+	}
+
+	homeTemplatePath := path.Join(inPath, "pages", "home.html")
+	homeTemplate, err := os.ReadFile(homeTemplatePath)
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	if err := os.WriteFile(homeTemplatePath, append(homeTemplate, "{{ currentLang .Lang }}"...), 0644); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	var outPaths []string
+
+	for i := 0; i < 2; i++ {
+		langs = nil
+		bc.OutPath = path.Join(t.TempDir(), "out")
+		outPaths = append(outPaths, bc.OutPath)
+
+		if err := Build(bc); err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+
+		if expected := []string{"en", "pt-BR"}; !reflect.DeepEqual(langs, expected) {
+			t.Errorf("got %v, want %v", langs, expected)
+		}
+	}
+
+	compareDirsRec(t, outPaths[0], outPaths[1])
+}
+
+func TestBuild_concurrencyDeterminism(t *testing.T) {
+	latexGenerator = &latexTestGenerator{}
+
+	okDir := path.Join("testdata", "build", "ok")
+	inPaths := []string{
+		path.Join(okDir, "1", "in"),
+		path.Join(okDir, "2", "in"),
+		path.Join(okDir, "3", "in"),
+		path.Join(okDir, "4", "in"),
+		copyTestBuildInPath(t, `responsiveImgSizes: [100, 200]
+responsiveImgMediaQueries: 100vw
+highDPI: true
+imageFormats: [original, jpeg]
+computeImageColors: true
+generateSocialCards: true
+`),
+	}
+
+	templateFuncs := template.FuncMap{
+		"formatDateByLang": func(date time.Time, l *Lang) string {
+			return date.Format("2006-01-02") + " " + l.Tag
+		},
+	}
+
+	for i, inPath := range inPaths {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			sequentialOutPath := path.Join(t.TempDir(), "out")
+
+			err := Build(BuildConfig{
+				InPath:        inPath,
+				OutPath:       sequentialOutPath,
+				TemplateFuncs: templateFuncs,
+				Concurrency:   1,
+			})
+			if err != nil {
+				t.Fatalf("unexpected err: %v", err)
+			}
+
+			// the parallel build is run more than once, since the order of the langs
+			// depends on how the goroutines are scheduled.
+			for j := 0; j < 3; j++ {
+				parallelOutPath := path.Join(t.TempDir(), "out")
+
+				err := Build(BuildConfig{
+					InPath:        inPath,
+					OutPath:       parallelOutPath,
+					TemplateFuncs: templateFuncs,
+					Concurrency:   16,
+				})
+				if err != nil {
+					t.Fatalf("unexpected err: %v", err)
+				}
+
+				compareDirsRec(t, sequentialOutPath, parallelOutPath)
+			}
+		})
+	}
+}
+
+func TestNewBuilder_negativeConcurrency(t *testing.T) {
+	_, err := NewBuilder(BuildConfig{InPath: "in", OutPath: "out", Concurrency: -1})
+	if err == nil {
+		t.Error("expected an error")
+	}
+}
+
+func TestBuilder_BuildPost(t *testing.T) {
+	latexGenerator = &latexTestGenerator{}
+
+	inPath := copyTestBuildInPath(t, "")
+	outPath := path.Join(t.TempDir(), "out")
+
+	b, err := NewBuilder(BuildConfig{InPath: inPath, OutPath: outPath})
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	if err := b.BuildPost("hello"); err == nil {
+		t.Fatal("expected an error when calling BuildPost before Build")
+	}
+
+	if err := b.Build(); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	contentPath := path.Join(inPath, "posts", "hello", "content_en.md")
+	content, err := os.ReadFile(contentPath)
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	content = bytes.Replace(content, []byte("title: Hello"), []byte("title: Hello again"), 1)
+	content = bytes.Replace(content, []byte("Hello, *world*."), []byte("Hello again, *world*."), 1)
+
+	if err := os.WriteFile(contentPath, content, 0644); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	if err := b.BuildPost("hello"); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	// contentByFile maps the path of output files to what they must contain.
+	contentByFile := map[string]string{
+		"posts/hello/index.html":        "Hello again - The thing",
+		"posts/hello/reader/index.html": "Hello again, <em>world</em>.",
+		// other pages aren't rebuilt.
+		"archive/index.html": ">Hello</a>",
+	}
+
+	for relPath, expected := range contentByFile {
+		content, err := os.ReadFile(path.Join(outPath, relPath))
+		if err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+
+		if !strings.Contains(string(content), expected) {
+			t.Errorf("%v doesn't contain %v", relPath, expected)
+		}
+	}
+
+	var titles []string
+	for _, p := range b.out.postsLists.allPostsByLangTag["en"] {
+		titles = append(titles, p.Title)
+	}
+
+	sort.Strings(titles)
+
+	if expected := []string{"Glossary", "Hello again"}; !reflect.DeepEqual(titles, expected) {
+		t.Errorf("got %v posts, want %v", titles, expected)
+	}
+
+	if err := b.BuildPost("foo"); err == nil {
+		t.Error("expected an error when calling BuildPost with an unknown post")
+	}
+}
+
+func TestBuilder_Reload(t *testing.T) {
+	latexGenerator = &latexTestGenerator{}
+
+	inPath := copyTestBuildInPath(t, "")
+	outPath := path.Join(t.TempDir(), "out")
+
+	b, err := NewBuilder(BuildConfig{InPath: inPath, OutPath: outPath})
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	configPath := path.Join(inPath, configFilename)
+	configContent, err := os.ReadFile(configPath)
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	writeConfig := func(content []byte) {
+		if err := os.WriteFile(configPath, content, 0644); err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+	}
+
+	checkTitle := func(expected string) {
+		t.Helper()
+
+		if err := b.Build(); err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+
+		content, err := os.ReadFile(path.Join(outPath, "posts", "hello", "index.html"))
+		if err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+
+		if !strings.Contains(string(content), "Hello - "+expected) {
+			t.Errorf("post page doesn't contain the %v title", expected)
+		}
+	}
+
+	writeConfig(bytes.Replace(configContent, []byte("title: The thing"), []byte("title: Another thing"), 1))
+
+	// the config file is only read again by Reload.
+	checkTitle("The thing")
+
+	if err := b.Reload(); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	if err := b.BuildPost("hello"); err == nil {
+		t.Error("expected an error when calling BuildPost after Reload")
+	}
+
+	checkTitle("Another thing")
+
+	writeConfig([]byte("title: [\n"))
+
+	if err := b.Reload(); err == nil {
+		t.Fatal("expected an error")
+	}
+
+	// a failed Reload leaves the Builder unchanged.
+	checkTitle("Another thing")
+}
+
+func TestBuilder_Build_changedImg(t *testing.T) {
+	latexGenerator = &latexTestGenerator{}
+
+	inPath := copyTestBuildInPath(t, "img: /img.png\nimgAlt:\n  en: Img\n  pt-BR: Imagem\n")
+	outPath := path.Join(t.TempDir(), "out")
+	imgPath := path.Join(inPath, "assets", "img.png")
+
+	copyImg := func(srcPath string, modTime time.Time) {
+		content, err := os.ReadFile(srcPath)
+		if err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+
+		if err := os.MkdirAll(path.Dir(imgPath), os.ModeDir|os.ModePerm); err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+
+		if err := os.WriteFile(imgPath, content, 0644); err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+
+		if err := os.Chtimes(imgPath, modTime, modTime); err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+	}
+
+	b, err := NewBuilder(BuildConfig{InPath: inPath, OutPath: outPath})
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	imgSrcRx := regexp.MustCompile(`<img src="?([^" >]+)`)
+
+	checkImgSrc := func(width string) {
+		t.Helper()
+
+		if err := b.Build(); err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+
+		content, err := os.ReadFile(path.Join(outPath, "posts", "glossary", "index.html"))
+		if err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+
+		match := imgSrcRx.FindSubmatch(content)
+		if match == nil {
+			t.Fatal("img not found in post page")
+		}
+
+		src := string(match[1])
+		if !strings.HasSuffix(src, "/"+width+".png") {
+			t.Errorf("got %v src, want it to end with /%v.png", src, width)
+		}
+
+		if _, err := os.Stat(path.Join(outPath, src)); err != nil {
+			t.Errorf("unexpected err: %v", err)
+		}
+	}
+
+	modTime := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	copyImg(path.Join("testdata", "build", "err", "2", "in", "assets", "red.png"), modTime)
+	checkImgSrc("1920")
+
+	// the img is decoded again, since it's changed.
+	copyImg(path.Join("testdata", "build", "err", "2", "in", "assets", "imgs", "green.png"), modTime.Add(time.Hour))
+	checkImgSrc("1280")
+}
+
+func TestBuilder_verifyOutput(t *testing.T) {
+	latexGenerator = &latexTestGenerator{}
+
+	inPath := copyTestBuildInPath(t, "")
+	outPath := path.Join(t.TempDir(), "out")
+
+	b, err := NewBuilder(BuildConfig{InPath: inPath, OutPath: outPath, VerifyOutput: true})
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	if err := b.Build(); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	styleCSSPath := b.out.gat.findByRelPath("style.css").processedPath
+	if err := os.Remove(styleCSSPath); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	// the GAT isn't processed again by BuildPost, so the removed file is missing.
+	err = b.BuildPost("hello")
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+
+	if !strings.Contains(err.Error(), styleCSSPath) {
+		t.Errorf("got %v, want it to contain %v", err, styleCSSPath)
+	}
+}
+
+func TestBuilder_dryRun(t *testing.T) {
+	latexGenerator = &latexTestGenerator{}
+
+	inPath := copyTestBuildInPath(t, "")
+	outPath := path.Join(t.TempDir(), "out")
+
+	b, err := NewBuilder(BuildConfig{InPath: inPath, OutPath: outPath, DryRun: true})
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	if err := b.Build(); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	if _, err := os.Stat(outPath); !os.IsNotExist(err) {
+		t.Errorf("got %v, want %v to not exist", err, outPath)
+	}
+
+	result := b.Result()
+	if result == nil {
+		t.Fatal("expected a result")
+	}
+
+	// the files of the dry run are the ones written by an actual build.
+	if err := Build(BuildConfig{InPath: inPath, OutPath: outPath}); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	var expected []OutputFile
+
+	err = filepath.WalkDir(outPath, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		relPath, err := filepath.Rel(outPath, p)
+		if err != nil {
+			return err
+		}
+
+		expected = append(expected, OutputFile{Path: filepath.ToSlash(relPath), Size: info.Size()})
+
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	if !reflect.DeepEqual(result.Files, expected) {
+		t.Errorf("got %v, want %v", result.Files, expected)
+	}
+}
+
+func TestBuild_templateExecutionErrContext(t *testing.T) {
+	latexGenerator = &latexTestGenerator{}
+
+	tests := []struct {
+		pageName string
+		err      string
+	}{
+		{"home", "executing home page (en): "},
+		{"post", "executing post page for 'glossary' (en): "},
+		{"reader", "executing reader page for 'glossary' (en): "},
+	}
+
+	for _, test := range tests {
+		t.Run(test.pageName, func(t *testing.T) {
+			inPath := path.Join(t.TempDir(), "in")
+			if err := copyDirRec(path.Join("testdata", "build", "ok", "4", "in"), inPath, defaultOutputPerms); err != nil {
+				t.Fatalf("unexpected err: %v", err)
+			}
+
+			err := os.WriteFile(path.Join(inPath, "pages", test.pageName+".html"), []byte(`{{ assetLink "/not-found.png" }}`), 0644)
+			if err != nil {
+				t.Fatalf("unexpected err: %v", err)
+			}
+
+			err = Build(BuildConfig{
+				InPath:  inPath,
+				OutPath: path.Join(t.TempDir(), "out"),
+			})
+			if err == nil || !strings.HasPrefix(err.Error(), test.err) {
+				t.Fatalf("got %v, want an error starting with %v", err, test.err)
+			}
+		})
+	}
+}
+
+func TestBuild_normalizeSlugs(t *testing.T) {
+	latexGenerator = &latexTestGenerator{}
+
+	tests := []struct {
+		configLines string
+		slug        string
+		warning     bool
+		err         bool
+	}{
+		{"", "Hello World", true, false},
+		{"strictSlugs: true\n", "", false, true},
+		{"normalizeSlugs: true\n", "hello-world", false, false},
+		{"normalizeSlugs: true\nstrictSlugs: true\n", "hello-world", false, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.configLines, func(t *testing.T) {
+			inPath := copyTestBuildInPath(t, test.configLines)
+
+			err := os.Rename(path.Join(inPath, "posts", "hello"), path.Join(inPath, "posts", "Hello World"))
+			if err != nil {
+				t.Fatalf("unexpected err: %v", err)
+			}
+
+			var buff bytes.Buffer
+			oldOutput := logs.Output
+			logs.Output = &buff
+			t.Cleanup(func() { logs.Output = oldOutput })
+
+			outPath := path.Join(t.TempDir(), "out")
+
+			b, err := NewBuilder(BuildConfig{InPath: inPath, OutPath: outPath})
+			if err != nil {
+				t.Fatalf("unexpected err: %v", err)
+			}
+
+			err = b.Build()
+			if test.err {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected err: %v", err)
+			}
+
+			if warned := strings.Contains(buff.String(), "isn't a valid slug"); warned != test.warning {
+				t.Errorf("got %v warning, want %v; output: %v", warned, test.warning, buff.String())
+			}
+
+			i := slices.IndexFunc(b.out.postsLists.allPostsByLangTag["en"], func(p *Post) bool {
+				return p.Slug == test.slug
+			})
+			if i == -1 {
+				t.Fatalf("%v post not found", test.slug)
+			}
+
+			if url, expected := b.out.postsLists.allPostsByLangTag["en"][i].URL, "/posts/"+test.slug; url != expected {
+				t.Errorf("got %v url, want %v", url, expected)
+			}
+
+			for _, p := range []string{
+				path.Join(outPath, "posts", test.slug, "index.html"),
+				path.Join(outPath, "pt-BR", "posts", test.slug, "index.html"),
+				path.Join(outPath, "assets", test.slug),
+			} {
+				if _, err := os.Stat(p); err != nil {
+					t.Errorf("unexpected err: %v", err)
+				}
+			}
+
+			// the slug locates the post's directory.
+			if err := b.BuildPost(test.slug); err != nil {
+				t.Errorf("unexpected err: %v", err)
+			}
+
+			if test.slug != "Hello World" {
+				if err := b.BuildPost("Hello World"); err == nil {
+					t.Error("expected an error")
+				}
+			}
+		})
+	}
+}
+
+func TestBuild_homeFile(t *testing.T) {
+	latexGenerator = &latexTestGenerator{}
+
+	inPath := copyTestBuildInPath(t, "homeFile: home.html\n")
+	outPath := path.Join(t.TempDir(), "out")
+
+	if err := Build(BuildConfig{InPath: inPath, OutPath: outPath}); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	for _, p := range []string{"index.html", path.Join("pt-BR", "index.html")} {
+		if _, err := os.Stat(path.Join(outPath, p)); !os.IsNotExist(err) {
+			t.Errorf("expected %v not to exist, got %v", p, err)
+		}
+	}
+
+	content, err := os.ReadFile(path.Join(outPath, "pt-BR", "home.html"))
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	for _, s := range []string{
+		`<a href="/home.html">English</a>`,
+		`<a href="/pt-BR/home.html">`,
+		`<meta property="og:url" content="https://foo.bar/pt-BR/home.html">`,
+	} {
+		if !bytes.Contains(content, []byte(s)) {
+			t.Errorf("expected the home page to contain %v", s)
+		}
+	}
+
+	if _, err := os.Stat(path.Join(outPath, "home.html")); err != nil {
+		t.Errorf("unexpected err: %v", err)
+	}
+}
+
+func TestBuild_onlyLangs(t *testing.T) {
+	latexGenerator = &latexTestGenerator{}
+
+	for _, limitAlternateLinks := range []bool{false, true} {
+		t.Run(strconv.FormatBool(limitAlternateLinks), func(t *testing.T) {
+			inPath := copyTestBuildInPath(t, "generateSocialCards: true\njsonIndex: true\nsearchIndex: true\n")
+			outPath := path.Join(t.TempDir(), "out")
+
+			err := Build(BuildConfig{
+				InPath:              inPath,
+				OutPath:             outPath,
+				OnlyLangs:           []string{"en"},
+				LimitAlternateLinks: limitAlternateLinks,
+			})
+			if err != nil {
+				t.Fatalf("unexpected err: %v", err)
+			}
+
+			if _, err := os.Stat(path.Join(outPath, "pt-BR")); !os.IsNotExist(err) {
+				t.Errorf("expected pt-BR not to exist, got %v", err)
+			}
+
+			// the posts of the langs that aren't built have neither social cards nor
+			// entries in the indexes.
+			cardPaths, err := filepath.Glob(path.Join(outPath, "assets", "glossary", socialCardNamePrefix+"*.png"))
+			if err != nil {
+				t.Fatalf("unexpected err: %v", err)
+			}
+
+			if len(cardPaths) != 1 || !strings.HasPrefix(path.Base(cardPaths[0]), socialCardNamePrefix+"en") {
+				t.Errorf("got %v social cards, want only the en one", cardPaths)
+			}
+
+			for _, filename := range []string{jsonIndexFilename, searchIndexFilename} {
+				content, err := os.ReadFile(path.Join(outPath, filename))
+				if err != nil {
+					t.Fatalf("unexpected err: %v", err)
+				}
+
+				if !bytes.Contains(content, []byte(`"en"`)) || bytes.Contains(content, []byte(`"pt-BR"`)) {
+					t.Errorf("expected %v to only have en posts, got %s", filename, content)
+				}
+			}
+
+			for _, p := range []string{"index.html", path.Join("posts", "hello", "index.html")} {
+				content, err := os.ReadFile(path.Join(outPath, p))
+				if err != nil {
+					t.Fatalf("unexpected err: %v", err)
+				}
+
+				if !bytes.Contains(content, []byte(`hreflang="en"`)) {
+					t.Errorf("expected %v to have an en alternate link", p)
+				}
+
+				if hasPTBR := bytes.Contains(content, []byte(`hreflang="pt-BR"`)); hasPTBR == limitAlternateLinks {
+					t.Errorf("got %v for whether %v has a pt-BR alternate link, want %v", hasPTBR, p, !limitAlternateLinks)
+				}
+			}
+		})
+	}
+}
+
+func TestNewBuilder_unknownOnlyLangs(t *testing.T) {
+	_, err := NewBuilder(BuildConfig{
+		InPath:    path.Join("testdata", "build", "ok", "4", "in"),
+		OutPath:   t.TempDir(),
+		OnlyLangs: []string{"en", "fr"},
+	})
+	if err == nil {
+		t.Error("expected an error")
+	}
+}
+
+func TestBuild_postProcessHTML(t *testing.T) {
+	latexGenerator = &latexTestGenerator{}
+
+	outPath := path.Join(t.TempDir(), "out")
+
+	err := Build(BuildConfig{
+		InPath:  path.Join("testdata", "build", "ok", "4", "in"),
+		OutPath: outPath,
+		PostProcessHTML: func(page string, lang *Lang, html []byte) ([]byte, error) {
+			return append(html, fmt.Sprintf("<!-- %v %v -->", page, lang.Tag)...), nil
+		},
+	})
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	var htmlFiles int
+
+	err = filepath.WalkDir(outPath, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || path.Ext(p) != ".html" {
+			return err
+		}
+
+		htmlFiles++
+
+		content, err := os.ReadFile(p)
+		if err != nil {
+			return err
+		}
+
+		if !regexp.MustCompile(`<!-- [a-z0-9]+ [a-zA-Z-]+ -->$`).Match(content) {
+			t.Errorf("expected %v to end with the marker", p)
+		}
+
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	if htmlFiles == 0 {
+		t.Error("expected html files")
+	}
+
+	content, err := os.ReadFile(path.Join(outPath, "pt-BR", "posts", "hello", "index.html"))
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	if !bytes.HasSuffix(content, []byte("<!-- post pt-BR -->")) {
+		t.Errorf("expected the marker of the pt-BR post page")
+	}
+}
+
+func TestBuild_postProcessHTMLRootPage(t *testing.T) {
+	latexGenerator = &latexTestGenerator{}
+
+	outPath := path.Join(t.TempDir(), "out")
+
+	err := Build(BuildConfig{
+		InPath:  copyTestBuildInPath(t, "rootStrategy: picker\n"),
+		OutPath: outPath,
+		PostProcessHTML: func(page string, lang *Lang, html []byte) ([]byte, error) {
+			return append(html, fmt.Sprintf("<!-- %v %v -->", page, lang.Tag)...), nil
+		},
+	})
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	content, err := os.ReadFile(path.Join(outPath, "index.html"))
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	if !bytes.HasSuffix(content, []byte("<!-- root en -->")) {
+		t.Errorf("expected the marker of the root page, got %s", content)
+	}
+}
+
+func TestBuild_postProcessHTMLErr(t *testing.T) {
+	latexGenerator = &latexTestGenerator{}
+
+	err := Build(BuildConfig{
+		InPath:  path.Join("testdata", "build", "ok", "4", "in"),
+		OutPath: path.Join(t.TempDir(), "out"),
+		PostProcessHTML: func(page string, lang *Lang, html []byte) ([]byte, error) {
+			if page == "archive" {
+				return nil, errors.New("some error")
+			}
+
+			return html, nil
+		},
+	})
+	if err == nil || !strings.Contains(err.Error(), "some error") {
+		t.Errorf("got %v, want the err of PostProcessHTML", err)
+	}
+}
+
+func TestBuild_nestedPosts(t *testing.T) {
+	latexGenerator = &latexTestGenerator{}
+
+	tests := []struct {
+		nesting          string
+		url              string
+		filePath         string
+		assetsPathPrefix string
+	}{
+		{"flat", "/posts/hello", "posts/hello/index.html", "/assets/hello/"},
+		{"nested", "/posts/2024/hello", "posts/2024/hello/index.html", "/assets/2024/hello/"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.nesting, func(t *testing.T) {
+			inPath := copyTestBuildInPath(t, "nestedPosts: "+test.nesting+"\n")
+
+			if err := os.Mkdir(path.Join(inPath, "posts", "2024"), 0755); err != nil {
+				t.Fatalf("unexpected err: %v", err)
+			}
+
+			err := os.Rename(path.Join(inPath, "posts", "hello"), path.Join(inPath, "posts", "2024", "hello"))
+			if err != nil {
+				t.Fatalf("unexpected err: %v", err)
+			}
+
+			outPath := path.Join(t.TempDir(), "out")
+
+			b, err := NewBuilder(BuildConfig{InPath: inPath, OutPath: outPath, VerifyOutput: true})
+			if err != nil {
+				t.Fatalf("unexpected err: %v", err)
+			}
+
+			if err := b.Build(); err != nil {
+				t.Fatalf("unexpected err: %v", err)
+			}
+
+			var urls []string
+			for _, p := range b.out.postsLists.allPostsByLangTag["en"] {
+				urls = append(urls, p.URL)
+			}
+
+			expected := []string{"/posts/glossary", test.url}
+
+			sort.Strings(urls)
+			sort.Strings(expected)
+
+			if !reflect.DeepEqual(urls, expected) {
+				t.Errorf("got %v urls, want %v", urls, expected)
+			}
+
+			content, err := os.ReadFile(path.Join(outPath, test.filePath))
+			if err != nil {
+				t.Fatalf("unexpected err: %v", err)
+			}
+
+			if s := `<img src="` + test.assetsPathPrefix; !bytes.Contains(content, []byte(s)) {
+				t.Errorf("expected %v to contain %v", test.filePath, s)
+			}
+
+			slug := strings.TrimPrefix(test.url, "/posts/")
+			if err := b.BuildPost(slug); err != nil {
+				t.Errorf("unexpected err: %v", err)
+			}
+		})
+	}
+}
+
+func TestBuild_sections(t *testing.T) {
+	latexGenerator = &latexTestGenerator{}
+
+	inPath := copyTestBuildInPath(t, `sections:
+  - name: posts
+  - name: notes
+    template: note
+    urlPrefix: n
+redirects:
+  - from: old-note
+    to: a-note
+    post: true
+`)
+
+	files := map[string]string{
+		"pages/note.html":               `<div>{{ .Section.Name }}: {{ .Post.Title }}</div>{{ range sectionPosts .Lang "notes" }}<a href="{{ .URL }}">{{ .Title }}</a>{{ end }}`,
+		"pages/home.html":               `<a href="{{ postLinkBySlugAndLang "a-note" .Lang }}">A note</a>`,
+		"notes/a-note/data.yaml":        "feed: true\ndate: 2023-09-01T00:00:00Z\n",
+		"notes/a-note/content_en.md":    "---\ntitle: A note\nexcerpt: A note.\n---\nA note.\n",
+		"notes/a-note/content_pt-BR.md": "---\ntitle: Uma nota\nexcerpt: Uma nota.\n---\nUma nota.\n",
+	}
+
+	for p, content := range files {
+		if err := os.MkdirAll(path.Dir(path.Join(inPath, p)), 0755); err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+
+		if err := os.WriteFile(path.Join(inPath, p), []byte(content), 0644); err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+	}
+
+	outPath := path.Join(t.TempDir(), "out")
+
+	b, err := NewBuilder(BuildConfig{InPath: inPath, OutPath: outPath})
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	if err := b.Build(); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	tests := []struct {
+		p        string
+		expected string
+	}{
+		{"n/a-note/index.html", `<div>notes: A note</div><a href="/n/a-note">A note</a>`},
+		{"pt-BR/n/a-note/index.html", `<div>notes: Uma nota</div><a href="/pt-BR/n/a-note">Uma nota</a>`},
+		{"n/a-note/reader/index.html", `<link rel="alternate" hreflang="en" href="https://foo.bar/n/a-note/reader">`},
+		{"posts/hello/index.html", `<a rel="prev" href="/posts/glossary">Glossary</a>`},
+		// links and redirects to posts are in the URL prefixes of their sections.
+		{"index.html", `<a href="/n/a-note">A note</a>`},
+		{"pt-BR/index.html", `<a href="/pt-BR/n/a-note">A note</a>`},
+		{redirectsFilename, "/n/old-note /n/a-note 301\n/pt-BR/n/old-note /pt-BR/n/a-note 301\n"},
+	}
+
+	for _, test := range tests {
+		content, err := os.ReadFile(path.Join(outPath, test.p))
+		if err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+
+		if !bytes.Contains(content, []byte(test.expected)) {
+			t.Errorf("expected %v to contain %v", test.p, test.expected)
+		}
+	}
+
+	// the posts of each section are linked only to the ones in the same section, even
+	// though a-note was published between glossary and hello.
+	for _, p := range b.out.postsLists.visiblePostsByLangTag["en"] {
+		switch p.Slug {
+		case "a-note":
+			if p.Prev != nil || p.Next != nil {
+				t.Errorf("expected a-note not to have neighbors, got %v and %v", p.Prev, p.Next)
+			}
+		case "glossary":
+			if p.Next == nil || p.Next.Slug != "hello" {
+				t.Errorf("got %v, want hello as the next post of glossary", p.Next)
+			}
+		}
+	}
+
+	if err := b.BuildPost("a-note"); err != nil {
+		t.Errorf("unexpected err: %v", err)
+	}
+
+	// slugs must be unique across sections.
+	if err := os.Rename(path.Join(inPath, "notes", "a-note"), path.Join(inPath, "notes", "hello")); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	expectedErr := `"posts/hello" post directory in posts section and "notes/hello" post directory in notes section have the same slug: hello`
+	if err := b.Build(); err == nil || err.Error() != expectedErr {
+		t.Errorf("got %v, want %v", err, expectedErr)
+	}
+}
+
+func TestBuild_sectionsPostsPages(t *testing.T) {
+	latexGenerator = &latexTestGenerator{}
+
+	inPath := copyTestBuildInPath(t, `sections:
+  - name: articles
+    path: posts
+    urlPrefix: articles
+  - name: notes
+    urlPrefix: n
+`)
+
+	files := map[string]string{
+		"pages/posts.html":              `<div>{{ .Section.Name }} {{ .URL }}:{{ range .Posts }} {{ .Slug }}{{ end }}</div>`,
+		"notes/a-note/data.yaml":        "feed: true\ndate: 2023-09-01T00:00:00Z\n",
+		"notes/a-note/content_en.md":    "---\ntitle: A note\nexcerpt: A note.\n---\nA note.\n",
+		"notes/a-note/content_pt-BR.md": "---\ntitle: Uma nota\nexcerpt: Uma nota.\n---\nUma nota.\n",
+	}
+
+	for p, content := range files {
+		if err := os.MkdirAll(path.Dir(path.Join(inPath, p)), 0755); err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+
+		if err := os.WriteFile(path.Join(inPath, p), []byte(content), 0644); err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+	}
+
+	outPath := path.Join(t.TempDir(), "out")
+
+	if err := Build(BuildConfig{InPath: inPath, OutPath: outPath}); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	tests := []struct {
+		p        string
+		expected string
+	}{
+		{"articles/index.html", "<div>articles /articles: hello glossary</div>"},
+		{"pt-BR/articles/index.html", "<div>articles /pt-BR/articles: hello glossary</div>"},
+		{"n/index.html", "<div>notes /n: a-note</div>"},
+		{"pt-BR/n/index.html", "<div>notes /pt-BR/n: a-note</div>"},
+	}
+
+	for _, test := range tests {
+		content, err := os.ReadFile(path.Join(outPath, test.p))
+		if err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+
+		if !bytes.Contains(content, []byte(test.expected)) {
+			t.Errorf("expected %v to contain %v, got %s", test.p, test.expected, content)
+		}
+	}
+
+	// postsPath belongs to no section.
+	if _, err := os.Stat(path.Join(outPath, "posts", "index.html")); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("got %v, want %v", err, fs.ErrNotExist)
+	}
+}
+
+func TestBuild_combinedPage(t *testing.T) {
+	latexGenerator = &latexTestGenerator{}
+
+	inPath := copyTestBuildInPath(t, "combinedPage: true\n")
+	outPath := path.Join(t.TempDir(), "out")
+
+	// the template is required if combinedPage is true.
+	if err := Build(BuildConfig{InPath: inPath, OutPath: outPath}); err == nil {
+		t.Fatal("expected an error for a missing pages/all.html template")
+	}
+
+	combined := `{{ range .Posts }}<article id="{{ .Slug }}">{{ .Content }}</article>{{ end }}`
+	if err := os.WriteFile(path.Join(inPath, "pages", "all.html"), []byte(combined), 0644); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	if err := Build(BuildConfig{InPath: inPath, OutPath: outPath}); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	srcRx := regexp.MustCompile(`src="?(/[^"\s>]+)`)
+
+	for relPath, expectedContents := range map[string][]string{
+		"all.html": {
+			`<article id="hello"><p>Hello, <em>world</em>.</p>`,
+			`<article id="glossary"><p>Some terms.</p>`,
+			"A loyal animal.",
+			"<video controls><source src=",
+		},
+		"pt-BR/all.html": {
+			`<article id="hello"><p>Olá, <em>mundo</em>.</p>`,
+			`<article id="glossary"><p>Alguns termos.</p>`,
+			"Um animal leal.",
+		},
+	} {
+		html, err := os.ReadFile(path.Join(outPath, relPath))
+		if err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+
+		for _, expected := range expectedContents {
+			if !strings.Contains(string(html), expected) {
+				t.Errorf("got %q for %v, want it to contain %q", html, relPath, expected)
+			}
+		}
+
+		// the links to the assets of the posts resolve from the combined page.
+		for _, match := range srcRx.FindAllStringSubmatch(string(html), -1) {
+			if _, err := os.Stat(path.Join(outPath, match[1])); err != nil {
+				t.Errorf("%v in %v doesn't resolve: %v", match[1], relPath, err)
+			}
+		}
+	}
+}
+
+func TestBuild_env(t *testing.T) {
+	latexGenerator = &latexTestGenerator{}
+
+	for _, test := range []struct {
+		env, expected string
+	}{
+		{"", "<p>production true</p>"},
+		{"dev", "<p>dev false</p>"},
+	} {
+		t.Run(test.env, func(t *testing.T) {
+			inPath := copyTestBuildInPath(t, "")
+			outPath := path.Join(t.TempDir(), "out")
+
+			for _, name := range []string{"home.html", "post.html"} {
+				if err := os.WriteFile(path.Join(inPath, "pages", name), []byte(`<p>{{ .Env }} {{ isProd }}</p>`), 0644); err != nil {
+					t.Fatalf("unexpected err: %v", err)
+				}
+			}
+
+			if err := Build(BuildConfig{InPath: inPath, OutPath: outPath, Env: test.env}); err != nil {
+				t.Fatalf("unexpected err: %v", err)
+			}
+
+			for _, relPath := range []string{"index.html", "pt-BR/index.html", "posts/hello/index.html"} {
+				html, err := os.ReadFile(path.Join(outPath, relPath))
+				if err != nil {
+					t.Fatalf("unexpected err: %v", err)
+				}
+
+				if !strings.Contains(string(html), test.expected) {
+					t.Errorf("got %q for %v, want it to contain %q", html, relPath, test.expected)
+				}
+			}
+		})
+	}
+}
+
+func TestBuild_assetInOtherTree(t *testing.T) {
+	latexGenerator = &latexTestGenerator{}
+
+	tests := []struct {
+		name        string
+		content     string
+		postPage    string
+		expectedErr string
+	}{
+		{
+			"img in content",
+			"Hello.\n\n![A rectangle](/page.png)\n",
+			"",
+			"/page.png img not found in hello post, did you mean page.png, which is in the PAT?",
+		},
+		{
+			"media in content",
+			"Hello.\n\n![A clip](/clip.mp4)\n",
+			"",
+			"/clip.mp4 media not found in hello post, did you mean clip.mp4, which is in the PAT?",
+		},
+		{
+			"template func",
+			"",
+			`{{ if eq .Post.Slug "hello" }}{{ assetLink "/og.png" }}{{ end }}`,
+			"/og.png not found in either GAT or PAT, did you mean og.png, which is in the PAT?",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			inPath := copyTestBuildInPath(t, "")
+
+			if test.content != "" {
+				content := "---\ntitle: Hello\nexcerpt: hello\n---\n" + test.content
+				if err := os.WriteFile(path.Join(inPath, "posts", "hello", "content_en.md"), []byte(content), 0644); err != nil {
+					t.Fatalf("unexpected err: %v", err)
+				}
+			}
+
+			if test.postPage != "" {
+				if err := os.WriteFile(path.Join(inPath, "pages", "post.html"), []byte(test.postPage), 0644); err != nil {
+					t.Fatalf("unexpected err: %v", err)
+				}
+			}
+
+			err := Build(BuildConfig{InPath: inPath, OutPath: path.Join(t.TempDir(), "out")})
+			if err == nil || !strings.Contains(err.Error(), test.expectedErr) {
+				t.Errorf("got %v, want an error containing %q", err, test.expectedErr)
+			}
+		})
+	}
+}
+
+func TestBuild_xDefaultAlternateLink(t *testing.T) {
+	latexGenerator = &latexTestGenerator{}
+
+	tests := []struct {
+		name     string
+		bc       BuildConfig
+		expected string
+	}{
+		{"all langs", BuildConfig{}, `<link rel="alternate" hreflang="x-default" href="https://foo.bar/posts/hello">`},
+		// the default lang isn't referenced, so there's no x-default link.
+		{"limited alternate links", BuildConfig{OnlyLangs: []string{"pt-BR"}, LimitAlternateLinks: true}, ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			bc := test.bc
+			bc.InPath = copyTestBuildInPath(t, "")
+			bc.OutPath = path.Join(t.TempDir(), "out")
+
+			if err := Build(bc); err != nil {
+				t.Fatalf("unexpected err: %v", err)
+			}
+
+			html, err := os.ReadFile(path.Join(bc.OutPath, "pt-BR", "posts", "hello", "index.html"))
+			if err != nil {
+				t.Fatalf("unexpected err: %v", err)
+			}
+
+			n := strings.Count(string(html), `hreflang="x-default"`)
+
+			if test.expected == "" {
+				if n != 0 {
+					t.Errorf("got %q, want it not to have an x-default link", html)
+				}
+
+				return
+			}
+
+			if n != 1 || !strings.Contains(string(html), test.expected) {
+				t.Errorf("got %q, want it to contain %q once", html, test.expected)
+			}
+
+			// the x-default link isn't among the alternate links, so en is only referenced once.
+			if n := strings.Count(string(html), `hreflang="en"`); n != 1 {
+				t.Errorf("got %v en alternate links, want 1", n)
+			}
+		})
+	}
+}
+
+func TestBuild_preGATProc(t *testing.T) {
+	latexGenerator = &latexTestGenerator{}
+
+	content, err := os.ReadFile("testdata/tree/ok/1/imgs/red.png")
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	inPath := copyTestBuildInPath(t, "")
+	outPath := path.Join(t.TempDir(), "out")
+
+	bc := BuildConfig{InPath: inPath, OutPath: outPath}
+	bc.preGATProc = func(gat *assetsTreeNode) error {
+		// neither new nor new/deep exist in the assets dir.
+		imgNode := gat.addChild(DIRNODE, "new").addChild(DIRNODE, "deep").addChild(IMGNODE, "green.png")
+		imgNode.content = content
+		imgNode.sizes = []*assetsTreeNodeImgSize{
+			{
+				original: true,
+				width:    1920,
+			},
+		}
+
+		return nil
+	}
+
+	b, err := NewBuilder(bc)
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	if err := b.Build(); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	if n, _ := findByRelPathInGATOrPAT(b.out.gat, nil, "/new/deep/green.png"); n == nil {
+		t.Error("/new/deep/green.png not found in GAT")
+	}
+
+	md5HashBs := md5.Sum(content)
+	md5Hash := hex.EncodeToString(md5HashBs[:])
+
+	if _, err := os.Stat(path.Join(outPath, "assets", "new", "deep", md5Hash, "1920.png")); err != nil {
+		t.Errorf("unexpected err: %v", err)
+	}
+
+	bc.preGATProc = func(gat *assetsTreeNode) error {
+		return errors.New("some")
+	}
+
+	if err := Build(bc); err == nil {
+		t.Error("expected an error")
+	}
+}
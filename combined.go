@@ -0,0 +1,39 @@
+package egen
+
+import (
+	"html/template"
+	"regexp"
+	"strings"
+)
+
+// combinedPageFilename is the name of the file, in the output dir of each lang, of the
+// combined page, which has the content of all of the posts in the lang.
+var combinedPageFilename = "all.html"
+
+// htmlIDRefRx matches the attributes that define ids and the references to them in html:
+// id attributes, fragment-only href and xlink:href attributes and url(#...) values, as used
+// in svgs.
+var htmlIDRefRx = regexp.MustCompile(`(\sid=["']|\s(?:xlink:)?href=["']#|url\(["']?#)([^"'\s>)]+)`)
+
+// namespaceHTMLIDs returns content with prefix prepended to every id in it, as well as to
+// every reference to an id within the same page, so that the content of several posts can
+// be placed in a single page without their ids colliding.
+func namespaceHTMLIDs(content template.HTML, prefix string) template.HTML {
+	return template.HTML(htmlIDRefRx.ReplaceAllString(string(content), "${1}"+strings.ReplaceAll(prefix, "$", "$$")+"${2}"))
+}
+
+// generateCombinedPagePosts returns a copy of each post in posts whose Content has its ids
+// namespaced by the post's slug, e.g. fn:1 becomes hello-fn:1 in the hello post, which lets
+// each post be linked to by its slug in the combined page.
+func generateCombinedPagePosts(posts []*Post) []*Post {
+	combinedPosts := make([]*Post, 0, len(posts))
+
+	for _, p := range posts {
+		combinedPost := *p
+		combinedPost.Content = namespaceHTMLIDs(p.Content, p.Slug+"-")
+
+		combinedPosts = append(combinedPosts, &combinedPost)
+	}
+
+	return combinedPosts
+}
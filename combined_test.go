@@ -0,0 +1,35 @@
+package egen
+
+import (
+	"html/template"
+	"testing"
+)
+
+func TestNamespaceHTMLIDs(t *testing.T) {
+	tests := []struct {
+		content, expected template.HTML
+	}{
+		{
+			`<h2 id="intro">Intro</h2><p><a href="#intro">Intro</a></p>`,
+			`<h2 id="foo-intro">Intro</h2><p><a href="#foo-intro">Intro</a></p>`,
+		},
+		{
+			`<sup class="footnote-ref" id="fnref:1"><a href="#fn:1">1</a></sup>`,
+			`<sup class="footnote-ref" id="foo-fnref:1"><a href="#foo-fn:1">1</a></sup>`,
+		},
+		{
+			`<svg><defs><linearGradient id='g'></linearGradient></defs><rect fill="url(#g)"/><use xlink:href="#g"/></svg>`,
+			`<svg><defs><linearGradient id='foo-g'></linearGradient></defs><rect fill="url(#foo-g)"/><use xlink:href="#foo-g"/></svg>`,
+		},
+		{
+			`<a href="/posts/bar#intro">Bar</a><img src="/assets/a.png" alt="id=&quot;x&quot;"><a href="#">Top</a>`,
+			`<a href="/posts/bar#intro">Bar</a><img src="/assets/a.png" alt="id=&quot;x&quot;"><a href="#">Top</a>`,
+		},
+	}
+
+	for _, test := range tests {
+		if got := namespaceHTMLIDs(test.content, "foo-"); got != test.expected {
+			t.Errorf("got %q, want %q", got, test.expected)
+		}
+	}
+}
@@ -3,8 +3,16 @@ package egen
 import (
 	"errors"
 	"fmt"
+	"log/slog"
+	"net/url"
 	"os"
 	"path"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"time"
 
 	"gopkg.in/yaml.v2"
 )
@@ -22,32 +30,222 @@ type Img struct {
 	Alt  string
 }
 
+// Section is a group of posts with its own directory, template and URLs, e.g. posts and notes.
+type Section struct {
+	// Name identifies the section, e.g. in TemplateData.Section.
+	Name string
+	// Path is the directory in InPath with the posts of the section. It defaults to Name.
+	Path string
+	// Template is the name, without its extension, of the template in <inPath>/pages used
+	// for the posts of the section. It defaults to post.
+	Template string
+	// URLPrefix is the path, relative to the site's root, in which the posts of the section
+	// are placed, e.g. /notes/<slug>. It defaults to Path.
+	URLPrefix string `yaml:"urlPrefix"`
+}
+
 // Map of internationalized versions of a string.
 // Example: pt-BR -> foobar
 type i18nStrings map[string]string
 
+// i18nAssetRelPath is the path of an asset that's either the same for every lang, when it's
+// a string in the config file, or set per lang, when it's a map of lang tags to paths, in
+// which case the langs not in the map don't have the asset.
+type i18nAssetRelPath struct {
+	all       AssetRelPath
+	byLangTag map[string]AssetRelPath
+}
+
+func (p *i18nAssetRelPath) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	if err := unmarshal(&p.all); err == nil {
+		return nil
+	}
+
+	return unmarshal(&p.byLangTag)
+}
+
+// get returns the path of the asset in the lang whose tag is langTag or an empty path if
+// there's none.
+func (p i18nAssetRelPath) get(langTag string) AssetRelPath {
+	if p.byLangTag != nil {
+		return p.byLangTag[langTag]
+	}
+
+	return p.all
+}
+
 type configFileData struct {
-	Title                     string
-	Description               i18nStrings
-	ImgAlt                    i18nStrings `yaml:"imgAlt"`
-	URL                       string
-	Color                     string
-	Img                       AssetRelPath
+	Title       string
+	Description i18nStrings
+	ImgAlt      i18nStrings `yaml:"imgAlt"`
+	URL         string
+	Color       string
+	// Img is the default img of the pages. It can be set per lang.
+	Img i18nAssetRelPath
+	// DefaultImgAlt is the alt of the imgs, of the site or of the posts, whose alt isn't
+	// provided, e.g. decorative ones.
+	DefaultImgAlt i18nStrings `yaml:"defaultImgAlt"`
+	// OGImage is the default img used in Open Graph meta tags. It defaults to Img.
+	OGImage                   AssetRelPath `yaml:"ogImage"`
+	OGImageAlt                i18nStrings  `yaml:"ogImageAlt"`
 	Langs                     []*Lang
 	Author                    *Author
 	ResponsiveImgSizes        []int  `yaml:"responsiveImgSizes"`
 	ResponsiveImgMediaQueries string `yaml:"responsiveImgMediaQueries"`
 	Latex                     bool
+	// LatexOutput is the format latex is rendered as: svg, mathml or both.
+	LatexOutput       string `yaml:"latexOutput"`
+	ReaderPages       bool   `yaml:"readerPages"`
+	Localized404Pages bool   `yaml:"localized404Pages"`
+	// JSONIndex enables the generation of an index.json file listing the visible posts.
+	JSONIndex bool `yaml:"jsonIndex"`
+	// SearchIndex enables the generation of a search-index.json file with the text of the visible posts.
+	SearchIndex bool `yaml:"searchIndex"`
+	// ImageFormats are the formats imgs are encoded to, e.g. original, jpeg, png or webp.
+	// The first one is used in links. If it's not set, only the original format is used.
+	ImageFormats []string `yaml:"imageFormats"`
+	// ImageQuality is the preset, fast, balanced or best, that sets how imgs are resized and
+	// encoded, trading speed for quality. If it's empty, imgs are resized with bilinear
+	// interpolation and encoded with the default quality of each format.
+	ImageQuality string `yaml:"imageQuality"`
+	// ComputeImageColors enables the computation of the average color of imgs, which is
+	// returned by the imageColor template func.
+	ComputeImageColors bool `yaml:"computeImageColors"`
+	// HighDPI enables the generation of sizes of imgs with the double of each responsive
+	// img size, so that there are sizes suited for 2x displays.
+	HighDPI bool `yaml:"highDPI"`
+	// OriginalImages is whether the file of each img is also placed, as is and with its
+	// name, among the files of its sizes, so that it can be linked through the assetOriginal
+	// template func, e.g. in a "download full resolution" link.
+	OriginalImages bool `yaml:"originalImages"`
+	// UndecodableImagesAsFiles is whether the imgs whose dimensions can't be read, e.g. empty
+	// or corrupt ones, are copied as they are, like other assets, instead of failing the build.
+	UndecodableImagesAsFiles bool `yaml:"undecodableImagesAsFiles"`
+	// MinifyAssets maps the extensions of assets, e.g. .json, to the names of the minifiers
+	// in assetMinifiers, e.g. json, that minify them before they're written. By default,
+	// only the CSS files bundled into style.css are minified.
+	MinifyAssets map[string]string `yaml:"minifyAssets"`
+	// GenerateSocialCards enables the generation of a social card img for each post without
+	// an ogImage, which is used in Open Graph meta tags.
+	GenerateSocialCards bool `yaml:"generateSocialCards"`
+	// SocialCardColor is the hex background color of social cards. It defaults to Color.
+	SocialCardColor string `yaml:"socialCardColor"`
+	// SocialCardImg is the background img of social cards. It takes precedence over SocialCardColor.
+	SocialCardImg AssetRelPath `yaml:"socialCardImg"`
+	// HomePostsLimit is the maximum number of posts, the most recent ones, in the Posts of
+	// the home pages. The others are still listed in the posts pages. Zero means no limit.
+	HomePostsLimit int `yaml:"homePostsLimit"`
+	// CombinedPage is whether to render all of the posts of each lang into a single all.html
+	// file, using the pages/all.html template.
+	CombinedPage bool `yaml:"combinedPage"`
+	// ExcerptWords is the maximum number of words in a post's excerpt. Zero means no limit.
+	ExcerptWords int `yaml:"excerptWords"`
+	// PassthroughDir is the name of the directory in InPath whose contents are copied
+	// verbatim to OutPath.
+	PassthroughDir string `yaml:"passthroughDir"`
+	// AssetsDir is the name of the directory in OutPath in which the assets are placed,
+	// which is also the prefix of their links.
+	AssetsDir string `yaml:"assetsDir"`
+	// AssetsInDir is the name of the directory in InPath with the global assets.
+	AssetsInDir string `yaml:"assetsInDir"`
+	// PostAssetsDir is the name of the directory in the directory of each post with the
+	// post's assets, whose PAT is rooted at it. If it's empty, the PAT of a post is rooted at
+	// its directory and is made of the files in it other than the ones of its content.
+	PostAssetsDir string `yaml:"postAssetsDir"`
+	// PostsPath is the path, relative to the site's root, in which posts are placed,
+	// e.g. /posts/<slug> or /<lang>/posts/<slug>.
+	PostsPath string `yaml:"postsPath"`
+	// TrailingSlash is whether the URLs of pages end with /, e.g. /posts/<slug>/.
+	TrailingSlash bool `yaml:"trailingSlash"`
+	// UglyURLs is whether pages, except home pages, are placed in <page>.html files, e.g.
+	// /posts/<slug>.html, rather than in <page>/index.html ones.
+	UglyURLs bool `yaml:"uglyURLs"`
+	// HomeFile is the name of the file in which home pages are placed. It defaults to
+	// index.html.
+	HomeFile string `yaml:"homeFile"`
+	// LinkTargetBlank is whether absolute links in posts open in a new tab, i.e. have
+	// target="_blank" and rel="noreferrer". It defaults to true.
+	LinkTargetBlank *bool `yaml:"linkTargetBlank"`
+	// RootStrategy is what's placed at the root of the site: the home page of the default
+	// lang, if it's default, a page that redirects to the home page of the lang of the
+	// browser, if it's redirect, or a page that links to the home page of each lang, if
+	// it's picker. In the last two, the home page of the default lang is placed at /<tag>,
+	// like the ones of the other langs. It defaults to default.
+	RootStrategy string `yaml:"rootStrategy"`
+	// Preconnect are the origins, e.g. https://fonts.gstatic.com, that pages hint the browser
+	// to connect to early through preconnect and dns-prefetch links.
+	Preconnect []string `yaml:"preconnect"`
+	// UpdateThreshold is how long after its date, e.g. 24h, a post must have been last
+	// updated to be considered updated. See Post.WasUpdated. It defaults to zero.
+	UpdateThreshold string `yaml:"updateThreshold"`
+	// Timezone is the IANA name of the timezone, e.g. America/Sao_Paulo, to which the dates
+	// of posts are converted, regardless of the offset they're written with. If it's empty,
+	// they keep their offset.
+	Timezone string `yaml:"timezone"`
+	// ContentExtensions are the extensions, e.g. .md and .markdown, that the content files of
+	// posts can have. The first one whose file exists is used. It defaults to .md.
+	ContentExtensions []string `yaml:"contentExtensions"`
+	// NormalizeSlugs is whether the names of post directories that aren't valid slugs are
+	// normalized into one, e.g. "Hello World" into hello-world, rather than being kept as is
+	// with a warning.
+	NormalizeSlugs bool `yaml:"normalizeSlugs"`
+	// StrictSlugs is whether the names of post directories that aren't valid slugs are an
+	// error, rather than being kept as is with a warning. It has no effect if NormalizeSlugs
+	// is true.
+	StrictSlugs bool `yaml:"strictSlugs"`
+	// NestedPosts enables posts in directories nested in posts, e.g. posts/2024/<slug>, in
+	// which case post directories are the ones with a data.yaml file. If it's flat, the
+	// slug of a post is the name of its directory and, if it's nested, the path of its
+	// directory relative to posts, e.g. 2024/<slug>.
+	NestedPosts string `yaml:"nestedPosts"`
+	// Headers enables the generation of a _headers file, as used by Netlify and Cloudflare
+	// Pages, that makes assets be cached indefinitely and html pages be revalidated.
+	Headers bool
+	// OutputManifest enables the generation of a manifest.json file, written after every
+	// other one, that maps the path of each file in OutPath to its SHA-256.
+	OutputManifest bool `yaml:"outputManifest"`
+	// Redirects are the redirects written to a Netlify-style _redirects file.
+	Redirects []*Redirect
+	// Sections are the sections of posts, whose slugs must be unique across all of them. If
+	// it's empty, there's a single one, named posts, with the posts in <inPath>/posts, which
+	// are placed at PostsPath.
+	Sections []*Section
 }
 
+var (
+	defaultPassthroughDir = "root"
+	defaultPostsPath      = "posts"
+	defaultHomeFile       = "index.html"
+	defaultPostTemplate   = "post"
+)
+
+const (
+	svgLatexOutput    = "svg"
+	mathMLLatexOutput = "mathml"
+	bothLatexOutput   = "both"
+
+	flatPostsNesting   = "flat"
+	nestedPostsNesting = "nested"
+)
+
 type config struct {
 	configFileData
 
 	defaultLang         *Lang
 	defaultImgByLangTag map[string]*Img
+	// defaultOGImgByLangTag is only set if OGImage is provided.
+	defaultOGImgByLangTag map[string]*Img
+	// updateThreshold is UpdateThreshold parsed.
+	updateThreshold time.Duration
+	// location is Timezone loaded. It's nil if Timezone is empty.
+	location *time.Location
+	// nonPostAssetsRxs are the regexps returned by generateNonPostAssetsRxs for
+	// ContentExtensions.
+	nonPostAssetsRxs []*regexp.Regexp
 }
 
-func readConfigFile(InPath string) (*config, error) {
+// readConfigFile reads the config file in InPath, reporting its warnings to logger.
+func readConfigFile(InPath string, logger *slog.Logger) (*config, error) {
 	cFilePath := path.Join(InPath, configFilename)
 	cFile, err := os.Open(cFilePath)
 	if err != nil {
@@ -79,11 +277,180 @@ func readConfigFile(InPath string) (*config, error) {
 		return nil, errors.New("author.name field in config file cannot be empty")
 	}
 
+	switch cFileData.LatexOutput {
+	case "":
+		cFileData.LatexOutput = svgLatexOutput
+	case svgLatexOutput, mathMLLatexOutput, bothLatexOutput:
+	default:
+		return nil, fmt.Errorf("latexOutput field in config file must be %v, %v or %v", svgLatexOutput, mathMLLatexOutput, bothLatexOutput)
+	}
+
+	sizes, err := normalizeResponsiveImgSizes(cFileData.ResponsiveImgSizes)
+	if err != nil {
+		return nil, err
+	}
+
+	cFileData.ResponsiveImgSizes = sizes
+
+	// these are warnings rather than errors because sizes can still be used without
+	// media queries through the sizes directive of imgs in posts.
+	switch {
+	case cFileData.ResponsiveImgMediaQueries != "" && len(cFileData.ResponsiveImgSizes) == 0:
+		logger.Warn("responsiveImgMediaQueries is set in config file, but responsiveImgSizes is empty, so imgs won't have resized versions; set responsiveImgSizes too")
+	case cFileData.ResponsiveImgMediaQueries == "" && len(cFileData.ResponsiveImgSizes) > 0:
+		logger.Warn("responsiveImgSizes is set in config file, but responsiveImgMediaQueries is empty, so imgs in posts won't be responsive unless they override their sizes attribute; set responsiveImgMediaQueries too")
+	}
+
+	if cFileData.ImageFormats != nil {
+		if len(cFileData.ImageFormats) == 0 {
+			return nil, errors.New("imageFormats field in config file cannot be empty")
+		}
+
+		for _, format := range cFileData.ImageFormats {
+			switch {
+			case format == originalImgFormat || imgFormatExts[format] != "":
+			case mapContains(unsupportedImgFormats, format):
+				return nil, fmt.Errorf("%v format in imageFormats field in config file isn't supported, since there's no encoder for it", format)
+			default:
+				return nil, fmt.Errorf("unknown %v format in imageFormats field in config file", format)
+			}
+		}
+	}
+
+	if cFileData.ImageQuality != "" && !mapContains(imgQualityPresets, cFileData.ImageQuality) {
+		return nil, fmt.Errorf("imageQuality field in config file must be %v, %v or %v", fastImgQuality, balancedImgQuality, bestImgQuality)
+	}
+
+	contentExts, err := normalizeContentExtensions(cFileData.ContentExtensions)
+	if err != nil {
+		return nil, err
+	}
+
+	cFileData.ContentExtensions = contentExts
+
+	if cFileData.HomePostsLimit < 0 {
+		return nil, errors.New("homePostsLimit field in config file cannot be negative")
+	}
+
+	switch cFileData.RootStrategy {
+	case "":
+		cFileData.RootStrategy = defaultRootStrategy
+	case defaultRootStrategy, redirectRootStrategy, pickerRootStrategy:
+	default:
+		return nil, fmt.Errorf("rootStrategy field in config file must be %v, %v or %v", defaultRootStrategy, redirectRootStrategy, pickerRootStrategy)
+	}
+
+	for i, origin := range cFileData.Preconnect {
+		normalized, err := normalizeOrigin(origin)
+		if err != nil {
+			return nil, fmt.Errorf("preconnect[%v] in config file is invalid: %v", i, err)
+		}
+
+		cFileData.Preconnect[i] = normalized
+	}
+
+	minifyAssets, err := normalizeMinifyAssets(cFileData.MinifyAssets)
+	if err != nil {
+		return nil, err
+	}
+
+	cFileData.MinifyAssets = minifyAssets
+
+	if cFileData.SocialCardColor != "" {
+		if _, err := parseHexColor(cFileData.SocialCardColor); err != nil {
+			return nil, fmt.Errorf("socialCardColor field in config file is invalid: %v", err)
+		}
+	}
+
+	switch cFileData.NestedPosts {
+	case "", flatPostsNesting, nestedPostsNesting:
+	default:
+		return nil, fmt.Errorf("nestedPosts field in config file must be %v or %v", flatPostsNesting, nestedPostsNesting)
+	}
+
+	var updateThreshold time.Duration
+	if cFileData.UpdateThreshold != "" {
+		updateThreshold, err = time.ParseDuration(cFileData.UpdateThreshold)
+		if err != nil {
+			return nil, fmt.Errorf("updateThreshold field in config file is invalid: %v", err)
+		}
+
+		if updateThreshold < 0 {
+			return nil, errors.New("updateThreshold field in config file cannot be negative")
+		}
+	}
+
+	var location *time.Location
+	if cFileData.Timezone != "" {
+		location, err = time.LoadLocation(cFileData.Timezone)
+		if err != nil {
+			return nil, fmt.Errorf("timezone field in config file is invalid: %v", err)
+		}
+	}
+
+	for i, r := range cFileData.Redirects {
+		if r == nil {
+			return nil, fmt.Errorf("redirects[%v] in config file cannot be empty", i)
+		}
+
+		if err := r.validate(i); err != nil {
+			return nil, err
+		}
+	}
+
+	switch {
+	case cFileData.HomeFile == "":
+		cFileData.HomeFile = defaultHomeFile
+	case strings.Contains(cFileData.HomeFile, "/") || path.Ext(cFileData.HomeFile) != ".html":
+		return nil, fmt.Errorf("homeFile field in config file must be the name of an html file, got %q", cFileData.HomeFile)
+	}
+
+	if cFileData.PassthroughDir == "" {
+		cFileData.PassthroughDir = defaultPassthroughDir
+	}
+
+	cFileData.AssetsDir, err = normalizeConfigDir("assetsDir", cFileData.AssetsDir, defaultAssetsDir)
+	if err != nil {
+		return nil, err
+	}
+
+	cFileData.AssetsInDir, err = normalizeConfigDir("assetsInDir", cFileData.AssetsInDir, defaultAssetsDir)
+	if err != nil {
+		return nil, err
+	}
+
+	cFileData.PostAssetsDir, err = normalizeConfigDir("postAssetsDir", cFileData.PostAssetsDir, "")
+	if err != nil {
+		return nil, err
+	}
+
+	if cFileData.PostAssetsDir == "." {
+		return nil, errors.New("postAssetsDir field in config file must be a directory in the directory of each post")
+	}
+
+	cFileData.PostsPath, err = normalizeConfigDir("postsPath", cFileData.PostsPath, defaultPostsPath)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := checkPostsPath("postsPath", cFileData.PostsPath, cFileData.AssetsDir, cFileData.Langs); err != nil {
+		return nil, err
+	}
+
+	cFileData.Sections, err = normalizeSections(cFileData.Sections, cFileData.PostsPath, cFileData.AssetsDir, cFileData.Langs)
+	if err != nil {
+		return nil, err
+	}
+
 	var c config
 
 	// default img
 	c.configFileData = cFileData
+	c.updateThreshold = updateThreshold
+	c.location = location
+	c.nonPostAssetsRxs = generateNonPostAssetsRxs(cFileData.ContentExtensions)
 	c.defaultImgByLangTag = make(map[string]*Img, len(cFileData.ImgAlt))
+	c.defaultOGImgByLangTag = make(map[string]*Img, len(cFileData.OGImageAlt))
 
 	// default lang
 	for _, lang := range cFileData.Langs {
@@ -91,14 +458,33 @@ func readConfigFile(InPath string) (*config, error) {
 			return nil, fmt.Errorf("description in %v in config file not provided", lang.Tag)
 		}
 
-		if cFileData.Img != "" {
-			if cFileData.ImgAlt[lang.Tag] == "" {
+		if img := cFileData.Img.get(lang.Tag); img != "" {
+			alt := firstNonEmpty(cFileData.ImgAlt[lang.Tag], cFileData.DefaultImgAlt[lang.Tag])
+			if alt == "" {
 				return nil, fmt.Errorf("alt for default image in %v in config file not provided", lang.Tag)
 			}
 
 			c.defaultImgByLangTag[lang.Tag] = &Img{
-				Path: cFileData.Img,
-				Alt:  cFileData.ImgAlt[lang.Tag],
+				Path: img,
+				Alt:  alt,
+			}
+		}
+
+		if cFileData.OGImage != "" {
+			// the alt of Img is used if the OG image doesn't have one.
+			alt := firstNonEmpty(
+				cFileData.OGImageAlt[lang.Tag],
+				cFileData.ImgAlt[lang.Tag],
+				cFileData.DefaultImgAlt[lang.Tag],
+			)
+
+			if alt == "" {
+				return nil, fmt.Errorf("alt for default og image in %v in config file not provided", lang.Tag)
+			}
+
+			c.defaultOGImgByLangTag[lang.Tag] = &Img{
+				Path: cFileData.OGImage,
+				Alt:  alt,
 			}
 		}
 
@@ -113,3 +499,206 @@ func readConfigFile(InPath string) (*config, error) {
 
 	return &c, nil
 }
+
+// urlStyle returns the style of the URLs of pages set in c.
+func (c *config) urlStyle() urlStyle {
+	return urlStyle{
+		uglyURLs:          c.UglyURLs,
+		trailingSlash:     c.TrailingSlash,
+		homeFile:          c.HomeFile,
+		taggedDefaultHome: c.RootStrategy != defaultRootStrategy,
+	}
+}
+
+// linkTargetBlank returns whether absolute links in posts open in a new tab.
+func (c *config) linkTargetBlank() bool {
+	return c.LinkTargetBlank == nil || *c.LinkTargetBlank
+}
+
+// normalizeContentExtensions returns exts or, if it's empty, defaultContentExts. An error is
+// returned if an extension doesn't start with a dot, has a /, or is repeated.
+func normalizeContentExtensions(exts []string) ([]string, error) {
+	if len(exts) == 0 {
+		return defaultContentExts, nil
+	}
+
+	seen := make(map[string]struct{}, len(exts))
+
+	for i, ext := range exts {
+		if len(ext) < 2 || ext[0] != '.' || strings.Contains(ext, "/") {
+			return nil, fmt.Errorf("contentExtensions[%v] in config file must be an extension starting with a dot, got %q", i, ext)
+		}
+
+		if mapContains(seen, ext) {
+			return nil, fmt.Errorf("%v is repeated in contentExtensions field in config file", ext)
+		}
+
+		seen[ext] = struct{}{}
+	}
+
+	return exts, nil
+}
+
+// normalizeSections returns sections with their default values set or, if it's empty, the
+// default section, whose posts are placed at postsPath. An error is returned if a section
+// is invalid, e.g. if its urlPrefix collides with assetsDir or the tag of one of langs, as
+// checked by checkPostsPath, or if two of them have the same name.
+func normalizeSections(sections []*Section, postsPath, assetsDir string, langs []*Lang) ([]*Section, error) {
+	if len(sections) == 0 {
+		return []*Section{{
+			Name:      "posts",
+			Path:      "posts",
+			Template:  defaultPostTemplate,
+			URLPrefix: postsPath,
+		}}, nil
+	}
+
+	names := make(map[string]struct{}, len(sections))
+
+	for i, s := range sections {
+		if s == nil || s.Name == "" {
+			return nil, fmt.Errorf("name of sections[%v] in config file cannot be empty", i)
+		}
+
+		if mapContains(names, s.Name) {
+			return nil, fmt.Errorf("there's more than one section named %v in config file", s.Name)
+		}
+
+		names[s.Name] = struct{}{}
+
+		var err error
+
+		s.Path, err = normalizeConfigDir(fmt.Sprintf("sections[%v].path", i), s.Path, s.Name)
+		if err != nil {
+			return nil, err
+		}
+
+		urlPrefixField := fmt.Sprintf("sections[%v].urlPrefix", i)
+
+		s.URLPrefix, err = normalizeConfigDir(urlPrefixField, s.URLPrefix, s.Path)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := checkPostsPath(urlPrefixField, s.URLPrefix, assetsDir, langs); err != nil {
+			return nil, err
+		}
+
+		switch {
+		case s.Template == "":
+			s.Template = defaultPostTemplate
+		case strings.ContainsAny(s.Template, "/."):
+			return nil, fmt.Errorf("template of sections[%v] in config file must be the name of a template in pages without its extension, got %q", i, s.Template)
+		}
+	}
+
+	return sections, nil
+}
+
+// checkPostsPath returns an error if the pages of the posts at postsPath, a cleaned path and
+// the value of the field named field, can collide with other files in the output dir, i.e. if
+// it's the output dir itself, if it overlaps with assetsDir or if it starts with the tag of
+// one of langs, whose pages are placed in the directory named after it.
+func checkPostsPath(field, postsPath, assetsDir string, langs []*Lang) error {
+	if postsPath == "." {
+		return fmt.Errorf("%v field in config file must be a directory in the output dir, not the output dir itself", field)
+	}
+
+	if postsPath == assetsDir || strings.HasPrefix(postsPath, assetsDir+"/") || strings.HasPrefix(assetsDir, postsPath+"/") {
+		return fmt.Errorf("%v field in config file overlaps with assetsDir, %v", field, assetsDir)
+	}
+
+	firstSegment, _, _ := strings.Cut(postsPath, "/")
+
+	for _, l := range langs {
+		if firstSegment == l.Tag {
+			return fmt.Errorf("%v field in config file cannot start with %v, since it's the tag of a lang", field, l.Tag)
+		}
+	}
+
+	return nil
+}
+
+// normalizeConfigDir returns dir, the value of the field named field, cleaned or defaultDir
+// if it's empty. An error is returned if dir isn't a relative path inside its parent directory.
+func normalizeConfigDir(field, dir, defaultDir string) (string, error) {
+	if dir == "" {
+		return defaultDir, nil
+	}
+
+	if !filepath.IsLocal(dir) {
+		return "", fmt.Errorf("%v field in config file must be a relative path that doesn't leave its parent directory", field)
+	}
+
+	return path.Clean(dir), nil
+}
+
+// normalizeOrigin returns origin, an absolute http or https origin, e.g. https://foo.bar,
+// without a trailing slash. An error is returned if it has anything else, e.g. a path.
+func normalizeOrigin(origin string) (string, error) {
+	u, err := url.Parse(origin)
+	if err != nil {
+		return "", err
+	}
+
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return "", fmt.Errorf("%q isn't an absolute http or https origin", origin)
+	}
+
+	if (u.Path != "" && u.Path != "/") || u.User != nil || u.RawQuery != "" || u.ForceQuery || u.Fragment != "" {
+		return "", fmt.Errorf("%q has more than a scheme, a host and a port", origin)
+	}
+
+	return u.Scheme + "://" + u.Host, nil
+}
+
+// normalizeMinifyAssets returns minifyAssets with its extensions in lowercase. An error is
+// returned if an extension doesn't start with a dot or if a minifier doesn't exist.
+func normalizeMinifyAssets(minifyAssets map[string]string) (map[string]string, error) {
+	if len(minifyAssets) == 0 {
+		return minifyAssets, nil
+	}
+
+	normalized := make(map[string]string, len(minifyAssets))
+
+	for ext, minifier := range minifyAssets {
+		if len(ext) < 2 || ext[0] != '.' || strings.ContainsAny(ext[1:], "./") {
+			return nil, fmt.Errorf("%q in minifyAssets field in config file isn't an extension, e.g. .json", ext)
+		}
+
+		if !mapContains(assetMinifiers, minifier) {
+			return nil, fmt.Errorf("unknown %v minifier for %v in minifyAssets field in config file", minifier, ext)
+		}
+
+		ext = strings.ToLower(ext)
+		if other, ok := normalized[ext]; ok && other != minifier {
+			return nil, fmt.Errorf("%v has more than one minifier in minifyAssets field in config file", ext)
+		}
+
+		normalized[ext] = minifier
+	}
+
+	return normalized, nil
+}
+
+// normalizeResponsiveImgSizes returns sizes without duplicates and sorted in ascending order.
+// An error is returned if any size isn't positive.
+func normalizeResponsiveImgSizes(sizes []int) ([]int, error) {
+	if len(sizes) == 0 {
+		return sizes, nil
+	}
+
+	normalized := make([]int, 0, len(sizes))
+
+	for _, size := range sizes {
+		if size <= 0 {
+			return nil, fmt.Errorf("responsiveImgSizes field in config file must only contain positive integers, got %v", size)
+		}
+
+		normalized = append(normalized, size)
+	}
+
+	sort.Ints(normalized)
+
+	return slices.Compact(normalized), nil
+}
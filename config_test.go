@@ -0,0 +1,731 @@
+package egen
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/efreitasn/egen/internal/logs"
+)
+
+func TestNormalizeResponsiveImgSizes(t *testing.T) {
+	tests := []struct {
+		sizes    []int
+		expected []int
+		err      bool
+	}{
+		{nil, nil, false},
+		{[]int{425, 640}, []int{425, 640}, false},
+		{[]int{960, 425, 640}, []int{425, 640, 960}, false},
+		{[]int{640, 425, 640, 425}, []int{425, 640}, false},
+		{[]int{425, 0}, nil, true},
+		{[]int{-425, 640}, nil, true},
+	}
+
+	for _, test := range tests {
+		t.Run(fmt.Sprint(test.sizes), func(t *testing.T) {
+			got, err := normalizeResponsiveImgSizes(test.sizes)
+			if test.err {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected err: %v", err)
+			}
+
+			if !reflect.DeepEqual(got, test.expected) {
+				t.Errorf("got %v, want %v", got, test.expected)
+			}
+		})
+	}
+}
+
+func writeTestConfigFile(t *testing.T, sizes, mediaQueries string) string {
+	t.Helper()
+
+	dir := t.TempDir()
+	content := fmt.Sprintf(`title: The thing
+description:
+  en: A blog
+url: https://foo.bar
+author:
+  name: John Doe
+langs:
+  - tag: en
+    name: English
+    default: true
+responsiveImgSizes: %v
+responsiveImgMediaQueries: %q
+`, sizes, mediaQueries)
+
+	if err := os.WriteFile(path.Join(dir, configFilename), []byte(content), 0644); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	return dir
+}
+
+// appendTestConfigLines appends lines, followed by a newline, to the yaml file at filePath,
+// e.g. a config file written by writeTestConfigFile or the data.yaml of a post.
+func appendTestConfigLines(t *testing.T, filePath, lines string) {
+	t.Helper()
+
+	f, err := os.OpenFile(filePath, os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	if _, err := fmt.Fprintln(f, lines); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	if err := f.Close(); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+}
+
+func TestReadConfigFile_responsiveImgSizes(t *testing.T) {
+	c, err := readConfigFile(writeTestConfigFile(t, "[960, 425, 960, 640]", "100vw"), logs.New())
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	if expected := []int{425, 640, 960}; !reflect.DeepEqual(c.ResponsiveImgSizes, expected) {
+		t.Errorf("got %v, want %v", c.ResponsiveImgSizes, expected)
+	}
+
+	for _, sizes := range []string{"[425, 0]", "[-640]"} {
+		if _, err := readConfigFile(writeTestConfigFile(t, sizes, "100vw"), logs.New()); err == nil {
+			t.Errorf("expected an error for %v", sizes)
+		}
+	}
+}
+
+func TestReadConfigFile_responsiveImgsMismatch(t *testing.T) {
+	tests := []struct {
+		sizes, mediaQueries string
+		expectedWarning     string
+	}{
+		{"[425]", "100vw", ""},
+		{"[]", "", ""},
+		{"[]", "100vw", "responsiveImgSizes is empty"},
+		{"[425]", "", "responsiveImgMediaQueries is empty"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.sizes+"/"+test.mediaQueries, func(t *testing.T) {
+			var buff bytes.Buffer
+
+			oldOutput := logs.Output
+			logs.Output = &buff
+			t.Cleanup(func() { logs.Output = oldOutput })
+
+			if _, err := readConfigFile(writeTestConfigFile(t, test.sizes, test.mediaQueries), logs.New()); err != nil {
+				t.Fatalf("unexpected err: %v", err)
+			}
+
+			if test.expectedWarning == "" {
+				if buff.Len() > 0 {
+					t.Errorf("got %q, want no warnings", buff.String())
+				}
+
+				return
+			}
+
+			if !strings.Contains(buff.String(), test.expectedWarning) {
+				t.Errorf("got %q, want a warning containing %q", buff.String(), test.expectedWarning)
+			}
+		})
+	}
+}
+
+func TestReadConfigFile_imageFormats(t *testing.T) {
+	tests := []struct {
+		formats string
+		err     bool
+	}{
+		{"[png]", false},
+		{"[original, jpeg]", false},
+		{"[]", true},
+		{"[webp]", false},
+		{"[avif, webp]", true},
+		{"[gif]", true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.formats, func(t *testing.T) {
+			dir := writeTestConfigFile(t, "[425]", "100vw")
+
+			appendTestConfigLines(t, path.Join(dir, configFilename), fmt.Sprintf("imageFormats: %v", test.formats))
+
+			_, err := readConfigFile(dir, logs.New())
+			if test.err && err == nil {
+				t.Fatal("expected an error")
+			}
+			if !test.err && err != nil {
+				t.Fatalf("unexpected err: %v", err)
+			}
+		})
+	}
+}
+
+func TestReadConfigFile_postsPath(t *testing.T) {
+	tests := []struct {
+		lines    string
+		expected string
+		err      bool
+	}{
+		{"", "posts", false},
+		{"postsPath: blog/", "blog", false},
+		{"postsPath: blog/en", "blog/en", false},
+		{"postsPath: .", "", true},
+		{"postsPath: ./", "", true},
+		{"postsPath: assets", "", true},
+		{"postsPath: assets/posts", "", true},
+		{"postsPath: static\nassetsDir: static/assets", "", true},
+		{"postsPath: en", "", true},
+		{"postsPath: en/posts", "", true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.lines, func(t *testing.T) {
+			dir := writeTestConfigFile(t, "[425]", "100vw")
+
+			appendTestConfigLines(t, path.Join(dir, configFilename), test.lines)
+
+			c, err := readConfigFile(dir, logs.New())
+			if test.err {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected err: %v", err)
+			}
+
+			if c.PostsPath != test.expected {
+				t.Errorf("got %v, want %v", c.PostsPath, test.expected)
+			}
+		})
+	}
+}
+
+func TestReadConfigFile_assetsDir(t *testing.T) {
+	tests := []struct {
+		line     string
+		expected string
+		err      bool
+	}{
+		{"", "assets", false},
+		{"assetsDir: static", "static", false},
+		{"assetsDir: static/assets/", "static/assets", false},
+		{"assetsDir: ../static", "", true},
+		{"assetsDir: /static", "", true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.line, func(t *testing.T) {
+			dir := writeTestConfigFile(t, "[425]", "100vw")
+
+			appendTestConfigLines(t, path.Join(dir, configFilename), test.line)
+
+			c, err := readConfigFile(dir, logs.New())
+			if test.err {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected err: %v", err)
+			}
+
+			if c.AssetsDir != test.expected {
+				t.Errorf("got %v, want %v", c.AssetsDir, test.expected)
+			}
+		})
+	}
+}
+
+func TestReadConfigFile_defaultImgAlt(t *testing.T) {
+	tests := []struct {
+		lines            string
+		expectedImgAlt   string
+		expectedOGImgAlt string
+		err              bool
+	}{
+		{"img: /img.png\ndefaultImgAlt:\n  en: Default", "Default", "", false},
+		{"img: /img.png\nimgAlt:\n  en: Img\ndefaultImgAlt:\n  en: Default", "Img", "", false},
+		{"img: /img.png\nogImage: /og.png\ndefaultImgAlt:\n  en: Default", "Default", "Default", false},
+		{"img: /img.png\nogImage: /og.png\nogImageAlt:\n  en: OG\ndefaultImgAlt:\n  en: Default", "Default", "OG", false},
+		{"img: /img.png", "", "", true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.lines, func(t *testing.T) {
+			dir := writeTestConfigFile(t, "[425]", "100vw")
+
+			appendTestConfigLines(t, path.Join(dir, configFilename), test.lines)
+
+			c, err := readConfigFile(dir, logs.New())
+			if test.err {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected err: %v", err)
+			}
+
+			if alt := c.defaultImgByLangTag["en"].Alt; alt != test.expectedImgAlt {
+				t.Errorf("got %v img alt, want %v", alt, test.expectedImgAlt)
+			}
+
+			if test.expectedOGImgAlt != "" {
+				if alt := c.defaultOGImgByLangTag["en"].Alt; alt != test.expectedOGImgAlt {
+					t.Errorf("got %v og image alt, want %v", alt, test.expectedOGImgAlt)
+				}
+			}
+		})
+	}
+}
+
+func TestReadConfigFile_imgPerLang(t *testing.T) {
+	base := `title: The thing
+description:
+  en: A blog
+  pt-BR: Um blog
+url: https://foo.bar
+author:
+  name: John Doe
+langs:
+  - tag: en
+    name: English
+    default: true
+  - tag: pt-BR
+    name: Português
+`
+
+	tests := []struct {
+		lines    string
+		expected map[string]*Img
+		err      bool
+	}{
+		{
+			"img: /img.png\nimgAlt:\n  en: Img\n  pt-BR: Img pt-BR",
+			map[string]*Img{
+				"en":    {Path: "/img.png", Alt: "Img"},
+				"pt-BR": {Path: "/img.png", Alt: "Img pt-BR"},
+			},
+			false,
+		},
+		{
+			"img:\n  en: /img.png\nimgAlt:\n  en: Img",
+			map[string]*Img{
+				"en": {Path: "/img.png", Alt: "Img"},
+			},
+			false,
+		},
+		{
+			"img:\n  en: /img.png\n  pt-BR: /img-pt-BR.png\nimgAlt:\n  en: Img\n  pt-BR: Img pt-BR",
+			map[string]*Img{
+				"en":    {Path: "/img.png", Alt: "Img"},
+				"pt-BR": {Path: "/img-pt-BR.png", Alt: "Img pt-BR"},
+			},
+			false,
+		},
+		{
+			"",
+			map[string]*Img{},
+			false,
+		},
+		{"img: /img.png\nimgAlt:\n  en: Img", nil, true},
+		{"img:\n  pt-BR: /img.png\nimgAlt:\n  en: Img", nil, true},
+		{"img:\n  - /img.png", nil, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.lines, func(t *testing.T) {
+			dir := t.TempDir()
+
+			if err := os.WriteFile(path.Join(dir, configFilename), []byte(base+test.lines), 0644); err != nil {
+				t.Fatalf("unexpected err: %v", err)
+			}
+
+			c, err := readConfigFile(dir, logs.New())
+			if test.err {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected err: %v", err)
+			}
+
+			if !reflect.DeepEqual(c.defaultImgByLangTag, test.expected) {
+				t.Errorf("got %v, want %v", c.defaultImgByLangTag, test.expected)
+			}
+		})
+	}
+}
+
+func TestReadConfigFile_updateThreshold(t *testing.T) {
+	tests := []struct {
+		value    string
+		expected time.Duration
+		err      bool
+	}{
+		{"", 0, false},
+		{"updateThreshold: 24h", 24 * time.Hour, false},
+		{"updateThreshold: 90m", 90 * time.Minute, false},
+		{"updateThreshold: -1h", 0, true},
+		{"updateThreshold: a day", 0, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.value, func(t *testing.T) {
+			dir := writeTestConfigFile(t, "[425]", "100vw")
+
+			appendTestConfigLines(t, path.Join(dir, configFilename), test.value)
+
+			c, err := readConfigFile(dir, logs.New())
+			if test.err {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected err: %v", err)
+			}
+
+			if c.updateThreshold != test.expected {
+				t.Errorf("got %v, want %v", c.updateThreshold, test.expected)
+			}
+		})
+	}
+}
+
+func TestReadConfigFile_timezone(t *testing.T) {
+	tests := []struct {
+		value    string
+		expected string
+		err      bool
+	}{
+		{"", "", false},
+		{"timezone: America/Sao_Paulo", "America/Sao_Paulo", false},
+		{"timezone: UTC", "UTC", false},
+		{"timezone: Mars/Olympus_Mons", "", true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.value, func(t *testing.T) {
+			dir := writeTestConfigFile(t, "[425]", "100vw")
+
+			appendTestConfigLines(t, path.Join(dir, configFilename), test.value)
+
+			c, err := readConfigFile(dir, logs.New())
+			if test.err {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected err: %v", err)
+			}
+
+			if test.expected == "" {
+				if c.location != nil {
+					t.Errorf("got %v, want no location", c.location)
+				}
+
+				return
+			}
+
+			if c.location == nil || c.location.String() != test.expected {
+				t.Errorf("got %v, want %v", c.location, test.expected)
+			}
+		})
+	}
+}
+
+func TestReadConfigFile_homeFile(t *testing.T) {
+	tests := []struct {
+		value    string
+		expected string
+		err      bool
+	}{
+		{"", "index.html", false},
+		{"homeFile: home.html", "home.html", false},
+		{"homeFile: home", "", true},
+		{"homeFile: en/home.html", "", true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.value, func(t *testing.T) {
+			dir := writeTestConfigFile(t, "[425]", "100vw")
+
+			appendTestConfigLines(t, path.Join(dir, configFilename), test.value)
+
+			c, err := readConfigFile(dir, logs.New())
+			if test.err {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected err: %v", err)
+			}
+
+			if c.HomeFile != test.expected {
+				t.Errorf("got %v, want %v", c.HomeFile, test.expected)
+			}
+		})
+	}
+}
+
+func TestNormalizeOrigin(t *testing.T) {
+	tests := []struct {
+		origin, expected string
+		err              bool
+	}{
+		{"https://fonts.gstatic.com", "https://fonts.gstatic.com", false},
+		{"https://fonts.gstatic.com/", "https://fonts.gstatic.com", false},
+		{"HTTP://localhost:8080", "http://localhost:8080", false},
+		{"fonts.gstatic.com", "", true},
+		{"//fonts.gstatic.com", "", true},
+		{"ftp://foo.bar", "", true},
+		{"https://foo.bar/fonts", "", true},
+		{"https://foo.bar?a=b", "", true},
+		{"https://foo.bar#a", "", true},
+		{"https://user@foo.bar", "", true},
+		{"", "", true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.origin, func(t *testing.T) {
+			got, err := normalizeOrigin(test.origin)
+			if test.err {
+				if err == nil {
+					t.Fatalf("expected an error, got %v", got)
+				}
+
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected err: %v", err)
+			}
+
+			if got != test.expected {
+				t.Errorf("got %v, want %v", got, test.expected)
+			}
+		})
+	}
+}
+
+func TestNormalizeMinifyAssets(t *testing.T) {
+	tests := []struct {
+		minifyAssets map[string]string
+		expected     map[string]string
+		err          bool
+	}{
+		{nil, nil, false},
+		{map[string]string{".json": "json", ".SVG": "svg"}, map[string]string{".json": "json", ".svg": "svg"}, false},
+		{map[string]string{".svg": "svg", ".SVG": "svg"}, map[string]string{".svg": "svg"}, false},
+		{map[string]string{".svg": "svg", ".SVG": "xml"}, nil, true},
+		{map[string]string{"json": "json"}, nil, true},
+		{map[string]string{".": "json"}, nil, true},
+		{map[string]string{".min.js": "json"}, nil, true},
+		{map[string]string{".js": "uglify"}, nil, true},
+	}
+
+	for i, test := range tests {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			got, err := normalizeMinifyAssets(test.minifyAssets)
+			if test.err {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected err: %v", err)
+			}
+
+			if !reflect.DeepEqual(got, test.expected) {
+				t.Errorf("got %v, want %v", got, test.expected)
+			}
+		})
+	}
+}
+
+func TestNormalizeSections(t *testing.T) {
+	tests := []struct {
+		sections []*Section
+		expected []*Section
+		err      bool
+	}{
+		{
+			nil,
+			[]*Section{{Name: "posts", Path: "posts", Template: "post", URLPrefix: "blog"}},
+			false,
+		},
+		{
+			[]*Section{{Name: "posts"}, {Name: "notes", Path: "content/notes/", Template: "note"}},
+			[]*Section{
+				{Name: "posts", Path: "posts", Template: "post", URLPrefix: "posts"},
+				{Name: "notes", Path: "content/notes", Template: "note", URLPrefix: "content/notes"},
+			},
+			false,
+		},
+		{
+			[]*Section{{Name: "notes", URLPrefix: "n"}},
+			[]*Section{{Name: "notes", Path: "notes", Template: "post", URLPrefix: "n"}},
+			false,
+		},
+		{[]*Section{nil}, nil, true},
+		{[]*Section{{Path: "notes"}}, nil, true},
+		{[]*Section{{Name: "notes"}, {Name: "notes", Path: "other"}}, nil, true},
+		{[]*Section{{Name: "notes", Path: "../notes"}}, nil, true},
+		{[]*Section{{Name: "notes", Template: "note.html"}}, nil, true},
+		{[]*Section{{Name: "notes", URLPrefix: "."}}, nil, true},
+		{[]*Section{{Name: "notes", URLPrefix: "./"}}, nil, true},
+		{[]*Section{{Name: "notes", URLPrefix: "assets"}}, nil, true},
+		{[]*Section{{Name: "notes", URLPrefix: "assets/notes"}}, nil, true},
+		{[]*Section{{Name: "assets"}}, nil, true},
+		{[]*Section{{Name: "notes", URLPrefix: "pt-BR"}}, nil, true},
+		{[]*Section{{Name: "notes", URLPrefix: "en/notes"}}, nil, true},
+		{[]*Section{{Name: "posts"}, {Name: "notes", URLPrefix: "pt-BR/notes"}}, nil, true},
+	}
+
+	langs := []*Lang{{Tag: "en", Default: true}, {Tag: "pt-BR"}}
+
+	for i, test := range tests {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			sections, err := normalizeSections(test.sections, "blog", "assets", langs)
+			if test.err {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected err: %v", err)
+			}
+
+			if !reflect.DeepEqual(sections, test.expected) {
+				t.Errorf("got %+v, want %+v", sections, test.expected)
+			}
+		})
+	}
+}
+
+func TestReadConfigFile_sectionsURLPrefix(t *testing.T) {
+	tests := []string{
+		"sections:\n  - name: posts\n  - name: notes\n    urlPrefix: .",
+		"sections:\n  - name: posts\n  - name: notes\n    urlPrefix: assets/notes",
+		"assetsDir: static/assets\nsections:\n  - name: posts\n  - name: notes\n    urlPrefix: static",
+		"sections:\n  - name: posts\n  - name: notes\n    urlPrefix: en",
+	}
+
+	for _, lines := range tests {
+		t.Run(lines, func(t *testing.T) {
+			dir := writeTestConfigFile(t, "[425]", "100vw")
+
+			appendTestConfigLines(t, path.Join(dir, configFilename), lines)
+
+			_, err := readConfigFile(dir, logs.New())
+			if err == nil || !strings.Contains(err.Error(), "sections[1].urlPrefix") {
+				t.Errorf("got %v, want an error about sections[1].urlPrefix", err)
+			}
+		})
+	}
+}
+
+func TestReadConfigFile_imageQuality(t *testing.T) {
+	tests := []struct {
+		value string
+		err   bool
+	}{
+		{"", false},
+		{"imageQuality: fast", false},
+		{"imageQuality: balanced", false},
+		{"imageQuality: best", false},
+		{"imageQuality: lanczos3", true},
+		{"imageQuality: Best", true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.value, func(t *testing.T) {
+			dir := writeTestConfigFile(t, "[425]", "100vw")
+
+			appendTestConfigLines(t, path.Join(dir, configFilename), test.value)
+
+			_, err := readConfigFile(dir, logs.New())
+			if test.err && err == nil {
+				t.Error("expected an error")
+			} else if !test.err && err != nil {
+				t.Errorf("unexpected err: %v", err)
+			}
+		})
+	}
+}
+
+func TestNormalizeContentExtensions(t *testing.T) {
+	tests := []struct {
+		name     string
+		exts     []string
+		expected []string
+		err      bool
+	}{
+		{"empty", nil, []string{".md"}, false},
+		{"ok", []string{".markdown", ".md"}, []string{".markdown", ".md"}, false},
+		{"no dot", []string{"md"}, nil, true},
+		{"only dot", []string{"."}, nil, true},
+		{"slash", []string{".md/"}, nil, true},
+		{"repeated", []string{".md", ".markdown", ".md"}, nil, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := normalizeContentExtensions(test.exts)
+			if test.err {
+				if err == nil {
+					t.Fatalf("expected an error, got %v", got)
+				}
+
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected err: %v", err)
+			}
+
+			if !reflect.DeepEqual(got, test.expected) {
+				t.Errorf("got %v, want %v", got, test.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,58 @@
+package egen
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+var dataFilenameRegExp = regexp.MustCompile(`^.+\.(yaml|yml|json)$`)
+
+// readDataDir reads every YAML or JSON file in dataPath into a map whose keys are
+// the files' names without their extensions. If dataPath doesn't exist, an empty
+// map is returned.
+func readDataDir(dataPath string) (map[string]interface{}, error) {
+	data := make(map[string]interface{})
+
+	fileInfos, err := os.ReadDir(dataPath)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return data, nil
+		}
+
+		return nil, err
+	}
+
+	for _, fileInfo := range fileInfos {
+		if fileInfo.IsDir() || !dataFilenameRegExp.MatchString(fileInfo.Name()) {
+			continue
+		}
+
+		key := strings.TrimSuffix(fileInfo.Name(), filepath.Ext(fileInfo.Name()))
+		if mapContains(data, key) {
+			return nil, fmt.Errorf("there's more than one data file named %v", key)
+		}
+
+		content, err := os.ReadFile(path.Join(dataPath, fileInfo.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		// JSON is valid YAML, so both are parsed the same way.
+		var value interface{}
+		if err := yaml.Unmarshal(content, &value); err != nil {
+			return nil, fmt.Errorf("parsing %v data file: %v", fileInfo.Name(), err)
+		}
+
+		data[key] = value
+	}
+
+	return data, nil
+}
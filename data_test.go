@@ -0,0 +1,43 @@
+package egen
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestReadDataDir(t *testing.T) {
+	data, err := readDataDir("testdata/data/ok")
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	expected := map[string]interface{}{
+		"nav": []interface{}{
+			map[interface{}]interface{}{"name": "Home", "url": "/"},
+			map[interface{}]interface{}{"name": "About", "url": "/posts/about"},
+		},
+		"social": map[interface{}]interface{}{"twitter": "johndoe"},
+	}
+
+	if !reflect.DeepEqual(data, expected) {
+		t.Errorf("got %v, want %v", data, expected)
+	}
+}
+
+func TestReadDataDir_notFound(t *testing.T) {
+	data, err := readDataDir("testdata/data/not-found")
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	if len(data) != 0 {
+		t.Errorf("got %v, want an empty map", data)
+	}
+}
+
+func TestReadDataDir_err(t *testing.T) {
+	_, err := readDataDir("testdata/data/err")
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+}
@@ -0,0 +1,55 @@
+package egen
+
+import (
+	"fmt"
+	"strings"
+)
+
+// MissingTranslationError is the error returned when a post doesn't have the content file
+// of one of the langs in the config file.
+type MissingTranslationError struct {
+	Slug, Lang string
+	// Filenames are the names of the content files that were tried, one for each content
+	// extension, e.g. content_en.md and content_en.markdown.
+	Filenames []string
+}
+
+func (e *MissingTranslationError) Error() string {
+	switch len(e.Filenames) {
+	case 0:
+		return fmt.Sprintf("content_%v.md for %v post doesn't exist", e.Lang, e.Slug)
+	case 1:
+		return fmt.Sprintf("%v for %v post doesn't exist", e.Filenames[0], e.Slug)
+	default:
+		return fmt.Sprintf("none of %v for %v post exists", strings.Join(e.Filenames, ", "), e.Slug)
+	}
+}
+
+// InvalidDateError is the error returned when a date in the data.yaml file of a post
+// is neither a valid RFC 3339 date nor a date without a time, i.e. 2006-01-02.
+type InvalidDateError struct {
+	Slug string
+	// Field is the field of the date, i.e. date or lastUpdateDate.
+	Field string
+	Err   error
+}
+
+func (e *InvalidDateError) Error() string {
+	return fmt.Sprintf("parsing %v data.yaml %v: %v", e.Slug, e.Field, e.Err)
+}
+
+func (e *InvalidDateError) Unwrap() error {
+	return e.Err
+}
+
+// EmptyFieldError is the error returned when a required field of the frontmatter of the
+// content file of a post is empty.
+type EmptyFieldError struct {
+	Slug, Lang string
+	// Field is the empty field, e.g. title.
+	Field string
+}
+
+func (e *EmptyFieldError) Error() string {
+	return fmt.Sprintf("%v field in %v post frontmatter in %v cannot be empty", e.Field, e.Slug, e.Lang)
+}
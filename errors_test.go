@@ -0,0 +1,139 @@
+package egen
+
+import (
+	"errors"
+	"os"
+	"path"
+	"strings"
+	"testing"
+	"time"
+)
+
+// buildTestInPathWithHelloPost copies testdata/build/ok/4/in, calls modify with the path of
+// its hello post and builds it, returning the error of the build.
+func buildTestInPathWithHelloPost(t *testing.T, modify func(postPath string)) error {
+	t.Helper()
+
+	latexGenerator = &latexTestGenerator{}
+
+	inPath := copyTestBuildInPath(t, "")
+	modify(path.Join(inPath, "posts", "hello"))
+
+	return Build(BuildConfig{InPath: inPath, OutPath: path.Join(t.TempDir(), "out")})
+}
+
+func TestMissingTranslationError(t *testing.T) {
+	err := buildTestInPathWithHelloPost(t, func(postPath string) {
+		if err := os.Remove(path.Join(postPath, "content_pt-BR.md")); err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+	})
+
+	var mtErr *MissingTranslationError
+	if !errors.As(err, &mtErr) {
+		t.Fatalf("got %v, want a *MissingTranslationError", err)
+	}
+
+	if mtErr.Slug != "hello" || mtErr.Lang != "pt-BR" {
+		t.Errorf("got %+v, want hello post in pt-BR", mtErr)
+	}
+
+	if expected := "content_pt-BR.md for hello post doesn't exist"; err.Error() != expected {
+		t.Errorf("got %q, want %q", err.Error(), expected)
+	}
+}
+
+func TestMissingTranslationError_contentExtensions(t *testing.T) {
+	inPath := copyTestBuildInPath(t, "contentExtensions: [.md, .markdown, .mdown]\n")
+
+	if err := os.Remove(path.Join(inPath, "posts", "hello", "content_pt-BR.md")); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	err := Build(BuildConfig{InPath: inPath, OutPath: path.Join(t.TempDir(), "out")})
+
+	var mtErr *MissingTranslationError
+	if !errors.As(err, &mtErr) {
+		t.Fatalf("got %v, want a *MissingTranslationError", err)
+	}
+
+	if expected := "none of content_pt-BR.md, content_pt-BR.markdown, content_pt-BR.mdown for hello post exists"; err.Error() != expected {
+		t.Errorf("got %q, want %q", err.Error(), expected)
+	}
+}
+
+func TestInvalidDateError(t *testing.T) {
+	tests := []struct {
+		dataYAML, field string
+	}{
+		{"date: 01/01/2024\n", "date"},
+		{"date: 2024-01-01T00:00:00Z\nlastUpdateDate: yesterday\n", "lastUpdateDate"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.field, func(t *testing.T) {
+			err := buildTestInPathWithHelloPost(t, func(postPath string) {
+				if err := os.WriteFile(path.Join(postPath, "data.yaml"), []byte(test.dataYAML), 0644); err != nil {
+					t.Fatalf("unexpected err: %v", err)
+				}
+			})
+
+			var idErr *InvalidDateError
+			if !errors.As(err, &idErr) {
+				t.Fatalf("got %v, want an *InvalidDateError", err)
+			}
+
+			if idErr.Slug != "hello" || idErr.Field != test.field {
+				t.Errorf("got %+v, want %v of hello post", idErr, test.field)
+			}
+
+			var parseErr *time.ParseError
+			if !errors.As(err, &parseErr) {
+				t.Errorf("got %v, want it to wrap a *time.ParseError", err)
+			}
+
+			if prefix := "parsing hello data.yaml " + test.field + ": "; !strings.HasPrefix(err.Error(), prefix) {
+				t.Errorf("got %q, want it to start with %q", err.Error(), prefix)
+			}
+		})
+	}
+}
+
+func TestEmptyFieldError(t *testing.T) {
+	for _, field := range []string{"title", "excerpt"} {
+		t.Run(field, func(t *testing.T) {
+			err := buildTestInPathWithHelloPost(t, func(postPath string) {
+				contentPath := path.Join(postPath, "content_pt-BR.md")
+
+				content, err := os.ReadFile(contentPath)
+				if err != nil {
+					t.Fatalf("unexpected err: %v", err)
+				}
+
+				lines := strings.Split(string(content), "\n")
+				for i, line := range lines {
+					if strings.HasPrefix(line, field+":") {
+						lines[i] = field + ": \"\""
+					}
+				}
+
+				if err := os.WriteFile(contentPath, []byte(strings.Join(lines, "\n")), 0644); err != nil {
+					t.Fatalf("unexpected err: %v", err)
+				}
+			})
+
+			var efErr *EmptyFieldError
+			if !errors.As(err, &efErr) {
+				t.Fatalf("got %v, want an *EmptyFieldError", err)
+			}
+
+			if efErr.Slug != "hello" || efErr.Lang != "pt-BR" || efErr.Field != field {
+				t.Errorf("got %+v, want %v of hello post in pt-BR", efErr, field)
+			}
+
+			if expected := field + " field in hello post frontmatter in pt-BR cannot be empty"; err.Error() != expected {
+				t.Errorf("got %q, want %q", err.Error(), expected)
+			}
+		})
+	}
+}
@@ -7,10 +7,13 @@ require (
 	github.com/nfnt/resize v0.0.0-20180221191011-83c6a9932646
 	github.com/russross/blackfriday/v2 v2.1.0
 	github.com/tdewolff/minify/v2 v2.20.9
+	golang.org/x/image v0.24.0
+	golang.org/x/net v0.35.0
 	gopkg.in/yaml.v2 v2.4.0
 )
 
 require (
 	github.com/dlclark/regexp2 v1.4.0 // indirect
 	github.com/tdewolff/parse/v2 v2.7.6 // indirect
+	golang.org/x/text v0.22.0 // indirect
 )
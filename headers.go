@@ -0,0 +1,80 @@
+package egen
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"sort"
+)
+
+var headersFilename = "_headers"
+
+const (
+	// assetsCacheControl is the Cache-Control header of assets. They can be cached
+	// indefinitely, since their names contain the md5 hash of their content.
+	assetsCacheControl = "public, max-age=31536000, immutable"
+	// htmlCacheControl is the Cache-Control header of html pages, which makes clients
+	// revalidate them before using a cached version.
+	htmlCacheControl = "no-cache"
+)
+
+// writeHeaders writes a Netlify/Cloudflare Pages _headers file to w that sets the
+// Cache-Control header of the assets in assetsDir and of the html pages. Since rules
+// can't match paths by suffix, pagesURLs, the URLs of the pages that don't end with .html,
+// get a rule each.
+func writeHeaders(w io.Writer, assetsDir string, pagesURLs []string) error {
+	if err := writeHeadersRule(w, "/"+assetsDir+"/*", assetsCacheControl); err != nil {
+		return err
+	}
+
+	for _, p := range append([]string{"/*.html"}, pagesURLs...) {
+		if err := writeHeadersRule(w, p, htmlCacheControl); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// writeHeadersRule writes a rule that sets the Cache-Control header of the paths matching
+// p to cacheControl.
+func writeHeadersRule(w io.Writer, p, cacheControl string) error {
+	_, err := fmt.Fprintf(w, "%v\n  Cache-Control: %v\n", p, cacheControl)
+
+	return err
+}
+
+// findPagesURLs returns the URLs of the index.html files in outPath, i.e. the URLs of the
+// pages that don't end with .html, sorted in ascending order. The ones other than / end
+// with / if trailingSlash is true.
+func findPagesURLs(outPath string, trailingSlash bool) ([]string, error) {
+	var urls []string
+
+	err := fs.WalkDir(os.DirFS(outPath), ".", func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if d.IsDir() || d.Name() != "index.html" {
+			return nil
+		}
+
+		u := "/"
+		if dir := path.Dir(p); dir != "." {
+			u = urlWithTrailingSlash(u+dir, trailingSlash)
+		}
+
+		urls = append(urls, u)
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Strings(urls)
+
+	return urls, nil
+}
@@ -0,0 +1,72 @@
+package egen
+
+import (
+	"bytes"
+	"os"
+	"path"
+	"reflect"
+	"testing"
+)
+
+func TestWriteHeaders(t *testing.T) {
+	var buff bytes.Buffer
+	if err := writeHeaders(&buff, "static/files", []string{"/", "/posts/foo/"}); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	expected := `/static/files/*
+  Cache-Control: public, max-age=31536000, immutable
+/*.html
+  Cache-Control: no-cache
+/
+  Cache-Control: no-cache
+/posts/foo/
+  Cache-Control: no-cache
+`
+
+	if buff.String() != expected {
+		t.Errorf("got %v, want %v", buff.String(), expected)
+	}
+}
+
+func TestFindPagesURLs(t *testing.T) {
+	outPath := t.TempDir()
+
+	for _, relPath := range []string{
+		"index.html",
+		"404.html",
+		"pt-BR/index.html",
+		"posts/foo/index.html",
+		"posts/bar.html",
+		"assets/foo-7d7a7d3d.css",
+	} {
+		filePath := path.Join(outPath, relPath)
+
+		if err := os.MkdirAll(path.Dir(filePath), os.ModeDir|os.ModePerm); err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+
+		if err := os.WriteFile(filePath, nil, 0644); err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+	}
+
+	tests := []struct {
+		trailingSlash bool
+		expected      []string
+	}{
+		{false, []string{"/", "/posts/foo", "/pt-BR"}},
+		{true, []string{"/", "/posts/foo/", "/pt-BR/"}},
+	}
+
+	for _, test := range tests {
+		urls, err := findPagesURLs(outPath, test.trailingSlash)
+		if err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+
+		if !reflect.DeepEqual(urls, test.expected) {
+			t.Errorf("got %v, want %v", urls, test.expected)
+		}
+	}
+}
@@ -4,18 +4,101 @@ import (
 	"bytes"
 	"fmt"
 	"image"
+	"image/color"
 	"image/jpeg"
 	"image/png"
 	"os"
+	"strings"
 
 	"github.com/nfnt/resize"
+	// registers the webp decoder, so that the dimensions of webp imgs can be read and they
+	// can be decoded. They're encoded by encodeWebP.
+	_ "golang.org/x/image/webp"
 )
 
+// Img formats. originalImgFormat is the format of the img being processed.
+const (
+	originalImgFormat = "original"
+	jpegImgFormat     = "jpeg"
+	pngImgFormat      = "png"
+	webpImgFormat     = "webp"
+)
+
+// imgFormatExts maps the formats imgs can be encoded to to the extension of their files.
+var imgFormatExts = map[string]string{
+	jpegImgFormat: ".jpg",
+	pngImgFormat:  ".png",
+	webpImgFormat: ".webp",
+}
+
+// unsupportedImgFormats is the set of known img formats that can't be encoded to,
+// since there's no encoder for them.
+var unsupportedImgFormats = map[string]struct{}{
+	"avif": {},
+}
+
+// imgQuality is how imgs are resized and encoded, trading speed for quality.
+type imgQuality struct {
+	interpolation  resize.InterpolationFunction
+	jpegQuality    int
+	pngCompression png.CompressionLevel
+}
+
+// Img quality presets.
+const (
+	fastImgQuality     = "fast"
+	balancedImgQuality = "balanced"
+	bestImgQuality     = "best"
+)
+
+// imgQualityPresets maps the names of the presets of the imageQuality field in config file
+// to what they stand for.
+var imgQualityPresets = map[string]imgQuality{
+	fastImgQuality: {
+		interpolation:  resize.Bilinear,
+		jpegQuality:    60,
+		pngCompression: png.BestSpeed,
+	},
+	balancedImgQuality: {
+		interpolation:  resize.MitchellNetravali,
+		jpegQuality:    80,
+		pngCompression: png.DefaultCompression,
+	},
+	bestImgQuality: {
+		interpolation:  resize.Lanczos3,
+		jpegQuality:    95,
+		pngCompression: png.BestCompression,
+	},
+}
+
+// defaultImgQuality is the img quality used if no preset is set, which is the one imgs were
+// always resized and encoded with.
+var defaultImgQuality = imgQuality{
+	interpolation:  resize.Bilinear,
+	jpegQuality:    jpeg.DefaultQuality,
+	pngCompression: png.DefaultCompression,
+}
+
+// imgFormatFromExt returns the format of an img given the extension of its file.
+func imgFormatFromExt(ext string) string {
+	switch strings.ToLower(ext) {
+	case ".jpg", ".jpeg":
+		return jpegImgFormat
+	case ".png":
+		return pngImgFormat
+	case ".webp":
+		return webpImgFormat
+	default:
+		return ""
+	}
+}
+
 func imgDimensions(filePath string) (width, height int, err error) {
 	file, err := os.Open(filePath)
 	if err != nil {
 		return -1, -1, err
 	}
+	defer file.Close()
 
 	c, _, err := image.DecodeConfig(file)
 	if err != nil {
@@ -25,32 +108,89 @@ func imgDimensions(filePath string) (width, height int, err error) {
 	return c.Width, c.Height, nil
 }
 
-func resizeImg(width int, filePath string) ([]byte, error) {
+// resizeImg resizes the img at filePath to width and encodes it to format with quality. If
+// format is originalImgFormat, the img is encoded to its own format. If width is the img's
+// width, it's only encoded.
+func resizeImg(width int, filePath string, format string, quality imgQuality) ([]byte, error) {
 	file, err := os.Open(filePath)
 	if err != nil {
 		return nil, err
 	}
+	defer file.Close()
 
-	img, format, err := image.Decode(file)
+	img, srcFormat, err := image.Decode(file)
 	if err != nil {
 		return nil, err
 	}
 
+	// the formats' names are the ones used by the image package.
+	if format == originalImgFormat {
+		format = srcFormat
+	}
+
 	var buff bytes.Buffer
-	resizedImg := resize.Resize(uint(width), 0, img, resize.Bilinear)
+
+	resizedImg := img
+	if width != img.Bounds().Dx() {
+		resizedImg = resize.Resize(uint(width), 0, img, quality.interpolation)
+	}
 
 	switch format {
-	case "jpeg":
-		err := jpeg.Encode(&buff, resizedImg, nil)
+	case jpegImgFormat:
+		err := jpeg.Encode(&buff, resizedImg, &jpeg.Options{Quality: quality.jpegQuality})
 		if err != nil {
 			return nil, fmt.Errorf("encoding jpeg: %w", err)
 		}
-	case "png":
-		err := png.Encode(&buff, resizedImg)
+	case pngImgFormat:
+		enc := png.Encoder{CompressionLevel: quality.pngCompression}
+		err := enc.Encode(&buff, resizedImg)
 		if err != nil {
 			return nil, fmt.Errorf("encoding png: %w", err)
 		}
+	case webpImgFormat:
+		if err := encodeWebP(&buff, resizedImg); err != nil {
+			return nil, fmt.Errorf("encoding webp: %w", err)
+		}
+	default:
+		return nil, fmt.Errorf("encoding %v: unsupported format", format)
 	}
 
 	return buff.Bytes(), nil
 }
+
+// averageImgColor returns the average color of the img at filePath as a hex string, e.g.
+// #ff0000. The img is downsampled before its pixels are averaged.
+func averageImgColor(filePath string) (string, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	img, _, err := image.Decode(file)
+	if err != nil {
+		return "", err
+	}
+
+	thumbnail := resize.Thumbnail(64, 64, img, resize.Bilinear)
+
+	var r, g, b, count uint64
+
+	bounds := thumbnail.Bounds()
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			c := color.NRGBAModel.Convert(thumbnail.At(x, y)).(color.NRGBA)
+
+			r += uint64(c.R)
+			g += uint64(c.G)
+			b += uint64(c.B)
+			count++
+		}
+	}
+
+	if count == 0 {
+		return "", nil
+	}
+
+	return fmt.Sprintf("#%02x%02x%02x", r/count, g/count, b/count), nil
+}
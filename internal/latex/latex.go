@@ -28,12 +28,15 @@ const (
 	scriptFileContent = `
 	import mj from 'mathjax-node';
 
+	const mml = process.argv[4] === '--mml';
+
 	mj.start();
 	mj.typeset(
 		{
 			math: process.argv[3],
 			format: process.argv[2] === '--inline' ? 'inline-TeX' : 'TeX',
-			svg: true,
+			svg: !mml,
+			mml,
 		},
 		(data) => {
 			if (data.errors) {
@@ -41,15 +44,16 @@ const (
 				process.exit(1);
 			}
 
-			console.log(data.svg);
+			console.log(mml ? data.mml : data.svg);
 		}
 	);`
 )
 
 // ImageGenerator is a latex image generator.
 type ImageGenerator struct {
-	dirPath     string
-	initiliazed bool
+	dirPath       string
+	initiliazed   bool
+	scriptWritten bool
 }
 
 // NewImageGenerator creates a new latex image generator.
@@ -75,17 +79,27 @@ func (g *ImageGenerator) SetDirPath(dirPath string) error {
 
 // SVGBlock generates a latex block svg image from math.
 func (g *ImageGenerator) SVGBlock(math []byte) ([]byte, error) {
-	return g.svg(math, false)
+	return g.typeset(math, false, false)
 }
 
 // SVGBlock generates an inline latex svg image from math.
 func (g *ImageGenerator) SVGInline(math []byte) ([]byte, error) {
-	return g.svg(math, true)
+	return g.typeset(math, true, false)
+}
+
+// MathMLBlock generates a latex block MathML element from math.
+func (g *ImageGenerator) MathMLBlock(math []byte) ([]byte, error) {
+	return g.typeset(math, false, true)
+}
+
+// MathMLInline generates an inline latex MathML element from math.
+func (g *ImageGenerator) MathMLInline(math []byte) ([]byte, error) {
+	return g.typeset(math, true, true)
 }
 
 func (g *ImageGenerator) initDir() error {
 	if g.initiliazed {
-		return nil
+		return g.writeScript()
 	}
 
 	err := os.Mkdir(g.dirPath, os.ModeDir|0755)
@@ -98,9 +112,9 @@ func (g *ImageGenerator) initDir() error {
 		return fmt.Errorf("writing %s file: %w", packageFileName, err)
 	}
 
-	err = os.WriteFile(filepath.Join(g.dirPath, scriptFileName), []byte(scriptFileContent), 0644)
+	err = g.writeScript()
 	if err != nil {
-		return fmt.Errorf("writing %s file: %w", scriptFileName, err)
+		return err
 	}
 
 	stdout, stderr := bytes.NewBuffer(nil), bytes.NewBuffer(nil)
@@ -124,7 +138,24 @@ func (g *ImageGenerator) initDir() error {
 	return nil
 }
 
-func (g *ImageGenerator) svg(math []byte, inline bool) ([]byte, error) {
+// writeScript writes the script file once per generator, so that directories
+// initialized by older versions get the current script.
+func (g *ImageGenerator) writeScript() error {
+	if g.scriptWritten {
+		return nil
+	}
+
+	err := os.WriteFile(filepath.Join(g.dirPath, scriptFileName), []byte(scriptFileContent), 0644)
+	if err != nil {
+		return fmt.Errorf("writing %s file: %w", scriptFileName, err)
+	}
+
+	g.scriptWritten = true
+
+	return nil
+}
+
+func (g *ImageGenerator) typeset(math []byte, inline, mml bool) ([]byte, error) {
 	err := g.initDir()
 	if err != nil {
 		return nil, fmt.Errorf("init latex directory: %w", err)
@@ -142,6 +173,9 @@ func (g *ImageGenerator) svg(math []byte, inline bool) ([]byte, error) {
 	} else {
 		args[1] = "--block"
 	}
+	if mml {
+		args = append(args, "--mml")
+	}
 
 	cmd := exec.Command("node", args...)
 
@@ -0,0 +1,29 @@
+// Package limiter provides a limit on the number of tasks egen runs concurrently.
+package limiter
+
+// Limiter limits the number of tasks running at the same time. Since its slots are shared
+// by every task, a task must not wait for other ones that use the same Limiter while
+// holding a slot.
+type Limiter struct {
+	slots chan struct{}
+}
+
+// New creates a Limiter that allows n tasks to run at the same time. If n isn't positive,
+// it allows a single one.
+func New(n int) *Limiter {
+	if n < 1 {
+		n = 1
+	}
+
+	return &Limiter{slots: make(chan struct{}, n)}
+}
+
+// Acquire blocks until there's a free slot and takes it.
+func (l *Limiter) Acquire() {
+	l.slots <- struct{}{}
+}
+
+// Release frees a slot taken by Acquire.
+func (l *Limiter) Release() {
+	<-l.slots
+}
@@ -0,0 +1,121 @@
+// Package logs provides diagnostic logging for egen.
+package logs
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Output is where messages are written to.
+var Output io.Writer = os.Stderr
+
+// outputMu serializes the writes to Output, since messages can be emitted concurrently.
+var outputMu sync.Mutex
+
+// New returns a logger that writes each record with a level of at least info to Output as
+// a line made of its level, e.g. "warning: ", its message and its attrs as key=value pairs.
+func New() *slog.Logger {
+	return slog.New(&handler{})
+}
+
+// handler is the slog.Handler of the loggers returned by New.
+type handler struct {
+	// attrs are the attrs added by WithAttrs, already formatted.
+	attrs string
+	// prefix is the prefix of the keys of attrs, i.e. the groups added by WithGroup
+	// followed by a dot.
+	prefix string
+}
+
+func (h *handler) Enabled(_ context.Context, l slog.Level) bool {
+	return l >= slog.LevelInfo
+}
+
+func (h *handler) Handle(_ context.Context, r slog.Record) error {
+	var b strings.Builder
+
+	b.WriteString(levelName(r.Level))
+	b.WriteString(": ")
+	b.WriteString(r.Message)
+	b.WriteString(h.attrs)
+
+	r.Attrs(func(a slog.Attr) bool {
+		writeAttr(&b, h.prefix, a)
+		return true
+	})
+
+	b.WriteByte('\n')
+
+	outputMu.Lock()
+	defer outputMu.Unlock()
+
+	_, err := io.WriteString(Output, b.String())
+
+	return err
+}
+
+func (h *handler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	var b strings.Builder
+
+	for _, a := range attrs {
+		writeAttr(&b, h.prefix, a)
+	}
+
+	return &handler{attrs: h.attrs + b.String(), prefix: h.prefix}
+}
+
+func (h *handler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+
+	return &handler{attrs: h.attrs, prefix: h.prefix + name + "."}
+}
+
+// levelName returns the name l is written with, e.g. warning for slog.LevelWarn.
+func levelName(l slog.Level) string {
+	switch {
+	case l >= slog.LevelError:
+		return "error"
+	case l >= slog.LevelWarn:
+		return "warning"
+	case l >= slog.LevelInfo:
+		return "info"
+	default:
+		return "debug"
+	}
+}
+
+// writeAttr writes a, with its key prefixed by prefix, to b as " key=value", quoting value
+// if it has whitespace or quotes. Groups are written as one pair for each of their attrs.
+func writeAttr(b *strings.Builder, prefix string, a slog.Attr) {
+	a.Value = a.Value.Resolve()
+	if a.Equal(slog.Attr{}) {
+		return
+	}
+
+	if a.Value.Kind() == slog.KindGroup {
+		if a.Key != "" {
+			prefix += a.Key + "."
+		}
+
+		for _, ga := range a.Value.Group() {
+			writeAttr(b, prefix, ga)
+		}
+
+		return
+	}
+
+	v := a.Value.String()
+	if v == "" || strings.ContainsAny(v, " \t\n\"=") {
+		v = strconv.Quote(v)
+	}
+
+	fmt.Fprintf(b, " %v%v=%v", prefix, a.Key, v)
+}
@@ -0,0 +1,88 @@
+package egen
+
+import (
+	"encoding/json"
+	"io"
+	"sort"
+	"time"
+)
+
+var (
+	jsonIndexFilename   = "index.json"
+	searchIndexFilename = "search-index.json"
+)
+
+// sortedVisiblePosts returns the visible posts of langs sorted by date in descending order.
+// Invisible posts aren't included, since they aren't meant to be listed. Posts with the
+// same date keep the order of their langs.
+func sortedVisiblePosts(langs []*Lang, postsLists *generatePostsListsOutput) []*Post {
+	posts := make([]*Post, 0)
+
+	for _, l := range langs {
+		posts = append(posts, postsLists.visiblePostsByLangTag[l.Tag]...)
+	}
+
+	sort.SliceStable(posts, func(i, j int) bool {
+		return posts[i].Date.After(posts[j].Date)
+	})
+
+	return posts
+}
+
+type jsonIndexPost struct {
+	Title   string    `json:"title"`
+	Excerpt string    `json:"excerpt"`
+	URL     string    `json:"url"`
+	Date    time.Time `json:"date"`
+	Lang    string    `json:"lang"`
+}
+
+// writeJSONIndex writes the posts of langs returned by sortedVisiblePosts to w as indented
+// JSON.
+func writeJSONIndex(w io.Writer, c *config, langs []*Lang, postsLists *generatePostsListsOutput) error {
+	posts := sortedVisiblePosts(langs, postsLists)
+	indexPosts := make([]jsonIndexPost, 0, len(posts))
+
+	for _, p := range posts {
+		indexPosts = append(indexPosts, jsonIndexPost{
+			Title:   p.Title,
+			Excerpt: p.Excerpt,
+			URL:     relToAbsLink(c.URL, p.URL),
+			Date:    p.Date,
+			Lang:    p.Lang.Tag,
+		})
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+
+	return enc.Encode(indexPosts)
+}
+
+// searchIndexDoc is a document in the search index. Its fields follow the usual shape
+// of documents indexed by client-side search libraries such as lunr.
+type searchIndexDoc struct {
+	// ID is the absolute URL of the post.
+	ID    string `json:"id"`
+	Title string `json:"title"`
+	Lang  string `json:"lang"`
+	Body  string `json:"body"`
+}
+
+// writeSearchIndex writes the plain text of the posts of langs returned by
+// sortedVisiblePosts to w as JSON.
+func writeSearchIndex(w io.Writer, c *config, langs []*Lang, postsLists *generatePostsListsOutput) error {
+	posts := sortedVisiblePosts(langs, postsLists)
+	docs := make([]searchIndexDoc, 0, len(posts))
+
+	for _, p := range posts {
+		docs = append(docs, searchIndexDoc{
+			ID:    relToAbsLink(c.URL, p.URL),
+			Title: p.Title,
+			Lang:  p.Lang.Tag,
+			Body:  p.plainText,
+		})
+	}
+
+	return json.NewEncoder(w).Encode(docs)
+}
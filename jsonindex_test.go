@@ -0,0 +1,81 @@
+package egen
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func newTestIndexInput() (*config, *generatePostsListsOutput) {
+	en, ptBR := &Lang{Tag: "en", Default: true}, &Lang{Tag: "pt-BR"}
+	c := &config{configFileData: configFileData{URL: "https://foo.bar", Langs: []*Lang{en, ptBR}}}
+
+	postsLists := &generatePostsListsOutput{
+		visiblePostsByLangTag: map[string][]*Post{
+			en.Tag: {
+				{Title: "a", URL: "/posts/a", Date: jan1(2020), Lang: en, plainText: "a text"},
+				{Title: "b", URL: "/posts/b", Date: jan1(2022), Lang: en, plainText: "b text"},
+			},
+			ptBR.Tag: {{Title: "a-pt", URL: "/pt-BR/posts/a", Date: jan1(2022), Lang: ptBR, plainText: "texto a"}},
+		},
+		invisiblePostsByLangTag: map[string][]*Post{
+			en.Tag: {{Title: "about", URL: "/posts/about", Date: jan1(2023), Lang: en}},
+		},
+	}
+
+	return c, postsLists
+}
+
+func jan1(year int) time.Time {
+	return time.Date(year, 1, 1, 0, 0, 0, 0, time.UTC)
+}
+
+func TestWriteJSONIndex(t *testing.T) {
+	c, postsLists := newTestIndexInput()
+
+	var buff bytes.Buffer
+	if err := writeJSONIndex(&buff, c, c.Langs, postsLists); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	var got []jsonIndexPost
+	if err := json.Unmarshal(buff.Bytes(), &got); err != nil {
+		t.Fatalf("invalid json: %v", err)
+	}
+
+	expected := []jsonIndexPost{
+		{Title: "b", URL: "https://foo.bar/posts/b", Date: jan1(2022), Lang: "en"},
+		{Title: "a-pt", URL: "https://foo.bar/pt-BR/posts/a", Date: jan1(2022), Lang: "pt-BR"},
+		{Title: "a", URL: "https://foo.bar/posts/a", Date: jan1(2020), Lang: "en"},
+	}
+
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("got %+v, want %+v", got, expected)
+	}
+}
+
+func TestWriteSearchIndex(t *testing.T) {
+	c, postsLists := newTestIndexInput()
+
+	var buff bytes.Buffer
+	if err := writeSearchIndex(&buff, c, c.Langs, postsLists); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	var got []searchIndexDoc
+	if err := json.Unmarshal(buff.Bytes(), &got); err != nil {
+		t.Fatalf("invalid json: %v", err)
+	}
+
+	expected := []searchIndexDoc{
+		{ID: "https://foo.bar/posts/b", Title: "b", Lang: "en", Body: "b text"},
+		{ID: "https://foo.bar/pt-BR/posts/a", Title: "a-pt", Lang: "pt-BR", Body: "texto a"},
+		{ID: "https://foo.bar/posts/a", Title: "a", Lang: "en", Body: "a text"},
+	}
+
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("got %+v, want %+v", got, expected)
+	}
+}
@@ -1,7 +1,160 @@
 package egen
 
+import "fmt"
+
 type latexImageGenerator interface {
 	SetDirPath(string) error
 	SVGBlock([]byte) ([]byte, error)
 	SVGInline([]byte) ([]byte, error)
+	MathMLBlock([]byte) ([]byte, error)
+	MathMLInline([]byte) ([]byte, error)
+}
+
+// visuallyHiddenStyle hides an element visually while keeping it available to
+// screen readers.
+const visuallyHiddenStyle = "position: absolute; width: 1px; height: 1px; overflow: hidden; clip: rect(0 0 0 0); white-space: nowrap"
+
+// generateLatexHTML renders math as svg, MathML or both, according to output.
+// When both are rendered, the svg is hidden from screen readers and the MathML
+// is hidden visually.
+func generateLatexHTML(output string, math []byte, inline bool) ([]byte, error) {
+	svg, mathML := latexGenerator.SVGBlock, latexGenerator.MathMLBlock
+	if inline {
+		svg, mathML = latexGenerator.SVGInline, latexGenerator.MathMLInline
+	}
+
+	switch output {
+	case mathMLLatexOutput:
+		return mathML(math)
+	case bothLatexOutput:
+		svgBs, err := svg(math)
+		if err != nil {
+			return nil, err
+		}
+
+		mathMLBs, err := mathML(math)
+		if err != nil {
+			return nil, err
+		}
+
+		return fmt.Appendf(
+			nil,
+			`<span aria-hidden="true">%s</span><span style="%v">%s</span>`,
+			svgBs,
+			visuallyHiddenStyle,
+			mathMLBs,
+		), nil
+	default:
+		return svg(math)
+	}
+}
+
+type latexTokenType int
+
+const (
+	textLatexToken latexTokenType = iota
+	inlineLatexToken
+	blockLatexToken
+)
+
+// latexToken is a piece of a text node. For block tokens, caption holds
+// the text that follows the closing $$.
+type latexToken struct {
+	t       latexTokenType
+	content []byte
+	caption []byte
+}
+
+// tokenizeLatex splits s into text, inline latex ($...$) and latex block
+// ($$...$$) tokens. An escaped dollar (\$) is a literal $ outside of latex
+// and is kept as is inside of it. Empty latex ($$ and $$$$) is removed, and
+// a $ or $$ without a matching closing delimiter is kept as literal text.
+// The rest of the text after a latex block is its caption.
+func tokenizeLatex(s []byte) []latexToken {
+	var (
+		tokens []latexToken
+		text   []byte
+	)
+
+	flushText := func() {
+		if len(text) > 0 {
+			tokens = append(tokens, latexToken{t: textLatexToken, content: text})
+			text = nil
+		}
+	}
+
+	for i := 0; i < len(s); {
+		switch {
+		case s[i] == '\\' && i+1 < len(s) && s[i+1] == '$':
+			text = append(text, '$')
+			i += 2
+
+		case s[i] == '$' && i+1 < len(s) && s[i+1] == '$':
+			end := findLatexDelim(s, i+2, "$$")
+			if end == -1 {
+				text = append(text, "$$"...)
+				i += 2
+
+				continue
+			}
+
+			content := s[i+2 : end]
+			if len(content) == 0 {
+				i = end + 2
+
+				continue
+			}
+
+			flushText()
+			tokens = append(tokens, latexToken{
+				t:       blockLatexToken,
+				content: content,
+				caption: s[end+2:],
+			})
+
+			return tokens
+
+		case s[i] == '$':
+			end := findLatexDelim(s, i+1, "$")
+			if end == -1 {
+				text = append(text, '$')
+				i++
+
+				continue
+			}
+
+			if content := s[i+1 : end]; len(content) > 0 {
+				flushText()
+				tokens = append(tokens, latexToken{t: inlineLatexToken, content: content})
+			}
+
+			i = end + 1
+
+		default:
+			text = append(text, s[i])
+			i++
+		}
+	}
+
+	flushText()
+
+	return tokens
+}
+
+// findLatexDelim returns the index of the first non-escaped occurrence of delim
+// in s starting at start, or -1 if there's none.
+func findLatexDelim(s []byte, start int, delim string) int {
+	for i := start; i < len(s); i++ {
+		if s[i] == '\\' && i+1 < len(s) && s[i+1] == '$' {
+			i++
+
+			continue
+		}
+
+		if i+len(delim) <= len(s) && string(s[i:i+len(delim)]) == delim {
+			return i
+		}
+	}
+
+	return -1
 }
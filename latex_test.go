@@ -0,0 +1,125 @@
+package egen
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestTokenizeLatex(t *testing.T) {
+	text := func(s string) latexToken { return latexToken{t: textLatexToken, content: []byte(s)} }
+	inline := func(s string) latexToken { return latexToken{t: inlineLatexToken, content: []byte(s)} }
+	block := func(s, caption string) latexToken {
+		return latexToken{t: blockLatexToken, content: []byte(s), caption: []byte(caption)}
+	}
+
+	tests := []struct {
+		in       string
+		expected []latexToken
+	}{
+		{"", nil},
+		{"no latex", []latexToken{text("no latex")}},
+		{"$x$", []latexToken{inline("x")}},
+		{"a $x$ b", []latexToken{text("a "), inline("x"), text(" b")}},
+		{"$x$ and $y$", []latexToken{inline("x"), text(" and "), inline("y")}},
+		{"$a$b$", []latexToken{inline("a"), text("b$")}},
+		{"costs \\$5", []latexToken{text("costs $5")}},
+		{"\\$x\\$", []latexToken{text("$x$")}},
+		{"\\$x$y$", []latexToken{text("$x"), inline("y")}},
+		{"$a \\$ b$", []latexToken{inline("a \\$ b")}},
+		{"trailing $", []latexToken{text("trailing $")}},
+		{"$unmatched", []latexToken{text("$unmatched")}},
+		{"empty $$ inline", []latexToken{text("empty $$ inline")}},
+		{"empty $$$$ block", []latexToken{text("empty  block")}},
+		{"$$$$", nil},
+		{"$$E = mc^2$$", []latexToken{block("E = mc^2", "")}},
+		{"see $$E$$ caption $x$", []latexToken{text("see "), block("E", " caption $x$")}},
+		{"$$a \\$$ b$$", []latexToken{block("a \\$$ b", "")}},
+		{"$$unmatched", []latexToken{text("$$unmatched")}},
+		{"$$a$ b", []latexToken{text("$$a$ b")}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.in, func(t *testing.T) {
+			got := tokenizeLatex([]byte(test.in))
+
+			if !reflect.DeepEqual(got, test.expected) {
+				t.Errorf("got %q, want %q", got, test.expected)
+			}
+		})
+	}
+}
+
+func TestGenerateContent_latex(t *testing.T) {
+	latexGenerator = &latexTestGenerator{}
+
+	tests := []struct {
+		in       string
+		expected string
+	}{
+		{
+			"costs \\$5 and $x$",
+			"<p>costs $5 and <span>latex-inline(x)</span></p>\n",
+		},
+		{
+			"$a$ `$HOME` $b$",
+			"<p><span>latex-inline(a)</span> <code>$HOME</code> <span>latex-inline(b)</span></p>\n",
+		},
+		{
+			"a `$b` and $",
+			"<p>a <code>$b</code> and $</p>\n",
+		},
+		{
+			"$$E$$ mass",
+			`<figure><div style="text-align: center; font-size: 2rem">latex-block(E)</div><figcaption> mass</figcaption></figure>`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.in, func(t *testing.T) {
+			p, input := newTestPost(t)
+			input.c.Latex = true
+
+			if err := p.generateContent(input, &Lang{Tag: "en"}, []byte(test.in)); err != nil {
+				t.Fatalf("unexpected err: %v", err)
+			}
+
+			if string(p.Content) != test.expected {
+				t.Errorf("got %q, want %q", p.Content, test.expected)
+			}
+		})
+	}
+}
+
+func TestGenerateLatexHTML(t *testing.T) {
+	latexGenerator = &latexTestGenerator{}
+
+	tests := []struct {
+		output   string
+		inline   bool
+		expected string
+	}{
+		{"", false, "latex-block(x)"},
+		{svgLatexOutput, true, "latex-inline(x)"},
+		{mathMLLatexOutput, false, "latex-mathml-block(x)"},
+		{mathMLLatexOutput, true, "latex-mathml-inline(x)"},
+		{
+			bothLatexOutput,
+			true,
+			`<span aria-hidden="true">latex-inline(x)</span><span style="` + visuallyHiddenStyle + `">latex-mathml-inline(x)</span>`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(fmt.Sprintf("%v/%v", test.output, test.inline), func(t *testing.T) {
+			got, err := generateLatexHTML(test.output, []byte("x"), test.inline)
+			if err != nil {
+				t.Fatalf("unexpected err: %v", err)
+			}
+
+			if string(got) != test.expected {
+				t.Errorf("got %s, want %s", got, test.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,69 @@
+package egen
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+)
+
+var outputManifestFilename = "manifest.json"
+
+// findOutputFilesHashes returns a map of the path, relative to outPath, of each file in
+// outPath to the hex-encoded SHA-256 of its content. The output manifest, if there's one
+// at the root of outPath, isn't included.
+func findOutputFilesHashes(outPath string) (map[string]string, error) {
+	hashes := make(map[string]string)
+
+	err := fs.WalkDir(os.DirFS(outPath), ".", func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if d.IsDir() || p == outputManifestFilename {
+			return nil
+		}
+
+		hash, err := fileSHA256(path.Join(outPath, p))
+		if err != nil {
+			return err
+		}
+
+		hashes[p] = hash
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return hashes, nil
+}
+
+// fileSHA256 returns the hex-encoded SHA-256 of the content of the file at filePath.
+func fileSHA256(filePath string) (string, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, file); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// writeOutputManifest writes hashes, as returned by findOutputFilesHashes, to w as a json
+// object sorted by path.
+func writeOutputManifest(w io.Writer, hashes map[string]string) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+
+	return enc.Encode(hashes)
+}
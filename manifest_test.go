@@ -0,0 +1,44 @@
+package egen
+
+import (
+	"os"
+	"path"
+	"reflect"
+	"testing"
+)
+
+func TestFindOutputFilesHashes(t *testing.T) {
+	outPath := t.TempDir()
+
+	for relPath, content := range map[string]string{
+		"index.html":          "foo",
+		"posts/bar.html":      "",
+		"manifest.json":       "{}",
+		"posts/manifest.json": "bar",
+	} {
+		filePath := path.Join(outPath, relPath)
+
+		if err := os.MkdirAll(path.Dir(filePath), os.ModeDir|os.ModePerm); err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+
+		if err := os.WriteFile(filePath, []byte(content), 0644); err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+	}
+
+	hashes, err := findOutputFilesHashes(outPath)
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	expected := map[string]string{
+		"index.html":          "2c26b46b68ffc68ff99b453c1d30413413422d706483bfa0f98a5e886266e7ae",
+		"posts/bar.html":      "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855",
+		"posts/manifest.json": "fcde2b2edba56bf408601fb721fe9b5c338d10ee429ea04fae5511b68fbf8fb9",
+	}
+
+	if !reflect.DeepEqual(hashes, expected) {
+		t.Errorf("got %v, want %v", hashes, expected)
+	}
+}
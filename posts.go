@@ -3,11 +3,14 @@ package egen
 import (
 	"bytes"
 	"fmt"
+	"html"
 	"html/template"
+	"log/slog"
 	"os"
 	"path"
 	"regexp"
 	"slices"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -26,25 +29,113 @@ var (
 	mdCodeBlockInfoHLinesRegExp = regexp.MustCompile(`\[([0-9]{1,}),([0-9]{1,})\]`)
 	postContentRegExp           = regexp.MustCompile(`(?s)^---\n(.*?)\n---(.*)`)
 
-	nonPostAssetsRxs = []*regexp.Regexp{
-		regexp.MustCompile(`content_.+\.md`),
+	// postSlugRegExp matches the slugs of posts, which are made of lowercase letters and
+	// digits separated by hyphens.
+	postSlugRegExp = regexp.MustCompile(`^[a-z0-9]+(?:-[a-z0-9]+)*$`)
+	// postSlugInvalidCharsRegExp matches the chars replaced by a hyphen when normalizing
+	// the name of a post directory into a slug.
+	postSlugInvalidCharsRegExp = regexp.MustCompile(`[^a-z0-9]+`)
+
+	// decorativeImgTitle is the title that marks an img in a post as decorative,
+	// i.e. ![](foo.png "decorative").
+	decorativeImgTitle = "decorative"
+
+	// imgTitleSizesPrefix starts the directive that overrides the sizes attribute of
+	// an img in a post, i.e. ![Foo](foo.png "sizes=\(max-width: 40em\) 100vw, 20em; Caption").
+	// The directive ends at the first ; and the remainder is the title. Parentheses
+	// need to be escaped in inline imgs, since blackfriday ends the link at the first ).
+	imgTitleSizesPrefix = "sizes="
+
+	defaultContentExts = []string{".md"}
+)
+
+// generateNonPostAssetsRxs returns the regexps matching the names of the files in the
+// directory of a post that aren't in its PAT, i.e. its content files, whose extensions are
+// contentExts, its data.yaml file and its directories.
+func generateNonPostAssetsRxs(contentExts []string) []*regexp.Regexp {
+	rxs := make([]*regexp.Regexp, 0, len(contentExts)+2)
+
+	for _, ext := range contentExts {
+		rxs = append(rxs, regexp.MustCompile(`content_.+`+regexp.QuoteMeta(ext)))
+	}
+
+	return append(
+		rxs,
 		regexp.MustCompile(`data\.yaml`),
 		// ignore all directories
 		regexp.MustCompile(".*/$"),
+	)
+}
+
+// postContentFilenames returns the names of the content files in the lang whose tag is
+// langTag that a post can have, one for each extension in contentExts, in order.
+func postContentFilenames(langTag string, contentExts []string) []string {
+	filenames := make([]string, 0, len(contentExts))
+
+	for _, ext := range contentExts {
+		filenames = append(filenames, "content_"+langTag+ext)
 	}
-)
+
+	return filenames
+}
+
+// findPostContentFile returns the path of the first content file among the ones named
+// filenames in postDirPath that exists or an empty string if none of them does.
+func findPostContentFile(postDirPath string, filenames []string) (string, error) {
+	for _, filename := range filenames {
+		filePath := path.Join(postDirPath, filename)
+
+		_, err := os.Stat(filePath)
+		if err == nil {
+			return filePath, nil
+		}
+
+		if !os.IsNotExist(err) {
+			return "", err
+		}
+	}
+
+	return "", nil
+}
 
 type postYAMLFrontMatter struct {
 	Title   string `yaml:"title"`
 	Excerpt string `yaml:"excerpt"`
 	ImgAlt  string `yaml:"imgAlt"`
+	// OGImageAlt defaults to ImgAlt.
+	OGImageAlt string `yaml:"ogImageAlt"`
 }
 
 type postYAMLDataFileContent struct {
-	Feed           bool   `yaml:"feed"`
+	// Feed and Listed are pointers so that it's possible to know whether they were
+	// provided. See visibility.
+	Feed           *bool  `yaml:"feed"`
+	Listed         *bool  `yaml:"listed"`
 	Date           string `yaml:"date"`
 	LastUpdateDate string `yaml:"lastUpdateDate"`
 	Img            AssetRelPath
+	OGImage        AssetRelPath `yaml:"ogImage"`
+	Weight         int          `yaml:"weight"`
+	// NoFeed excludes the post from the feed, even if Feed is true.
+	NoFeed    bool `yaml:"noFeed"`
+	NoSitemap bool `yaml:"noSitemap"`
+	NoIndex   bool `yaml:"noIndex"`
+}
+
+// visibility returns whether the post is listed (i.e. present in TemplateData.Posts) and whether
+// it's present in the feed (i.e. present in TemplateData.FeedPosts). If only one of feed or
+// listed is provided, its value is used for both.
+func (d *postYAMLDataFileContent) visibility() (listed, feed bool) {
+	switch {
+	case d.Feed != nil && d.Listed != nil:
+		return *d.Listed, *d.Feed
+	case d.Feed != nil:
+		return *d.Feed, *d.Feed
+	case d.Listed != nil:
+		return *d.Listed, *d.Listed
+	}
+
+	return false, false
 }
 
 type (
@@ -53,207 +144,784 @@ type (
 		c             *config
 		gat           *assetsTreeNode
 		assetsOutPath string
+		pc            *assetsProcessingConfig
+		// socialCards is only set if social cards are enabled.
+		socialCards *socialCardGenerator
+		// langs are the langs whose pages are built. The posts in the other ones are
+		// generated, so that they can be linked to, but their content isn't rendered and
+		// they don't have social cards, so that no asset is processed for them. If it's
+		// nil, the pages of every lang are built. See BuildConfig.OnlyLangs.
+		langs []*Lang
 	}
 
 	generatePostsListsOutput struct {
-		allPostsByLangTag, visiblePostsByLangTag, invisiblePostsByLangTag map[string][]*Post
+		allPostsByLangTag, visiblePostsByLangTag, invisiblePostsByLangTag, feedPostsByLangTag map[string][]*Post
 	}
 )
 
-func generatePostsLists(input generatePostsListsInput) (*generatePostsListsOutput, error) {
-	postsInPath := path.Join(input.bc.InPath, "posts")
+// buildsLang returns whether the pages of l are built.
+func (input generatePostsListsInput) buildsLang(l *Lang) bool {
+	return input.langs == nil || slices.Contains(input.langs, l)
+}
 
-	postsFileInfos, err := os.ReadDir(postsInPath)
-	if err != nil {
+// hasPostContentFiles returns whether the post at postDirPath has a content file, with one
+// of contentExts, in at least one of langs.
+func hasPostContentFiles(postDirPath string, langs []*Lang, contentExts []string) (bool, error) {
+	for _, l := range langs {
+		filePath, err := findPostContentFile(postDirPath, postContentFilenames(l.Tag, contentExts))
+		if err != nil {
+			return false, err
+		}
+
+		if filePath != "" {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// findPostBySlug returns the first post, regardless of its language, whose slug is equal to slug.
+func (o *generatePostsListsOutput) findPostBySlug(slug string) *Post {
+	for _, posts := range o.allPostsByLangTag {
+		for _, p := range posts {
+			if p.Slug == slug {
+				return p
+			}
+		}
+	}
+
+	return nil
+}
+
+// postDir is a post directory, whose path is relative to <inPath>/posts, and the slug of
+// the post in it.
+type postDir struct {
+	path, slug string
+}
+
+// readPostDirs returns the post directories in postsInPath, sorted by path. If nesting is
+// empty, they're its subdirectories. Otherwise, they're the directories in it, at any depth,
+// with a data.yaml file, and the others are only used to organize them, e.g. posts/2024/<slug>.
+// See postSlugFromDirPath for how their slugs are generated.
+func readPostDirs(postsInPath string, normalize, strict bool, nesting string, logger *slog.Logger) ([]postDir, error) {
+	var dirs []postDir
+	dirPathsBySlug := make(map[string]string)
+
+	var readDir func(relPath string) error
+	readDir = func(relPath string) error {
+		entries, err := os.ReadDir(path.Join(postsInPath, relPath))
+		if err != nil {
+			return err
+		}
+
+		for _, entry := range entries {
+			if !entry.IsDir() {
+				continue
+			}
+
+			dirPath := path.Join(relPath, entry.Name())
+
+			if nesting != "" {
+				_, err := os.Stat(path.Join(postsInPath, dirPath, "data.yaml"))
+				if os.IsNotExist(err) {
+					if err := readDir(dirPath); err != nil {
+						return err
+					}
+
+					continue
+				}
+				if err != nil {
+					return err
+				}
+			}
+
+			slug, err := postSlugFromDirPath(dirPath, normalize, strict, nesting, logger)
+			if err != nil {
+				return err
+			}
+
+			if otherDirPath, ok := dirPathsBySlug[slug]; ok {
+				return fmt.Errorf("%q and %q post directories have the same slug: %v", otherDirPath, dirPath, slug)
+			}
+
+			dirPathsBySlug[slug] = dirPath
+			dirs = append(dirs, postDir{dirPath, slug})
+		}
+
+		return nil
+	}
+
+	if err := readDir(""); err != nil {
 		return nil, err
 	}
 
-	output := generatePostsListsOutput{
+	return dirs, nil
+}
+
+// postSlugFromDirPath returns the slug of the post whose directory is at dirPath, relative
+// to <inPath>/posts. It's the name of the directory if nesting is flatPostsNesting and
+// dirPath otherwise. If a segment of the slug isn't valid, it's normalized if normalize is
+// true. Otherwise, an error is returned if strict is true or a warning is logged to logger
+// and the slug is kept as is.
+func postSlugFromDirPath(dirPath string, normalize, strict bool, nesting string, logger *slog.Logger) (string, error) {
+	segments := strings.Split(dirPath, "/")
+	if nesting == flatPostsNesting {
+		segments = segments[len(segments)-1:]
+	}
+
+	for i, segment := range segments {
+		if postSlugRegExp.MatchString(segment) {
+			continue
+		}
+
+		if !normalize {
+			if strict {
+				return "", fmt.Errorf("name of %q post directory isn't a valid slug, i.e. lowercase letters and digits separated by hyphens; rename it or set normalizeSlugs in config file", dirPath)
+			}
+
+			logger.Warn("name of post directory isn't a valid slug, i.e. lowercase letters and digits separated by hyphens; rename it or set normalizeSlugs in config file", "dir", dirPath)
+
+			break
+		}
+
+		segments[i] = normalizePostSlug(segment)
+		if segments[i] == "" {
+			return "", fmt.Errorf("name of %q post directory can't be normalized into a slug", dirPath)
+		}
+	}
+
+	return strings.Join(segments, "/"), nil
+}
+
+// normalizePostSlug lowercases name and replaces each sequence of chars other than letters
+// and digits in it with a hyphen, removing the ones at its ends.
+func normalizePostSlug(name string) string {
+	slug := postSlugInvalidCharsRegExp.ReplaceAllString(strings.ToLower(name), "-")
+
+	return strings.Trim(slug, "-")
+}
+
+// sectionPostDir is a post directory in the directory of a section.
+type sectionPostDir struct {
+	section *Section
+	postDir
+}
+
+// readSectionsPostDirs returns the post directories of each section in c, whose directories
+// are in inPath, in the order of the sections. An error naming both directories is returned
+// if two posts, in the same section or not, have the same slug, since their slugs identify
+// them, e.g. in the paths of their pages and assets.
+func readSectionsPostDirs(inPath string, c *config, logger *slog.Logger) ([]sectionPostDir, error) {
+	var dirs []sectionPostDir
+	dirsBySlug := make(map[string]sectionPostDir)
+
+	for _, section := range c.Sections {
+		sectionDirs, err := readPostDirs(path.Join(inPath, section.Path), c.NormalizeSlugs, c.StrictSlugs, c.NestedPosts, logger)
+		if err != nil {
+			return nil, fmt.Errorf("reading posts of %v section: %w", section.Name, err)
+		}
+
+		for _, dir := range sectionDirs {
+			if other, ok := dirsBySlug[dir.slug]; ok {
+				return nil, fmt.Errorf(
+					"%q post directory in %v section and %q post directory in %v section have the same slug: %v",
+					path.Join(other.section.Path, other.path),
+					other.section.Name,
+					path.Join(section.Path, dir.path),
+					section.Name,
+					dir.slug,
+				)
+			}
+
+			sectionDir := sectionPostDir{section, dir}
+
+			dirsBySlug[dir.slug] = sectionDir
+			dirs = append(dirs, sectionDir)
+		}
+	}
+
+	return dirs, nil
+}
+
+// generatePostsLists generates the posts in dirs, as returned by readSectionsPostDirs.
+func generatePostsLists(input generatePostsListsInput, dirs []sectionPostDir) (*generatePostsListsOutput, error) {
+	output := newGeneratePostsListsOutput()
+
+	for _, dir := range dirs {
+		if err := output.generatePost(input, dir); err != nil {
+			return nil, err
+		}
+	}
+
+	output.sort()
+
+	return output, nil
+}
+
+func newGeneratePostsListsOutput() *generatePostsListsOutput {
+	return &generatePostsListsOutput{
 		allPostsByLangTag:       make(map[string][]*Post),
 		visiblePostsByLangTag:   make(map[string][]*Post),
 		invisiblePostsByLangTag: make(map[string][]*Post),
+		feedPostsByLangTag:      make(map[string][]*Post),
 	}
+}
 
-	for _, postsFileInfo := range postsFileInfos {
-		if !postsFileInfo.IsDir() {
-			continue
+// generatePostAssetsTree generates the PAT of the post in postDirPath, which is rooted at
+// its PostAssetsDir, if it's set in c. If the post doesn't have that directory, the PAT is
+// empty.
+func generatePostAssetsTree(postDirPath string, c *config) (*assetsTreeNode, error) {
+	if c.PostAssetsDir == "" {
+		return generateAssetsTreeFromPrevious(postDirPath, c.nonPostAssetsRxs, nil, c.UndecodableImagesAsFiles)
+	}
+
+	assetsPath := path.Join(postDirPath, c.PostAssetsDir)
+
+	if _, err := os.Stat(assetsPath); err != nil {
+		if !os.IsNotExist(err) {
+			return nil, err
 		}
 
-		postSlug := postsFileInfo.Name()
-		postDirPath := path.Join(postsInPath, postSlug)
+		return &assetsTreeNode{t: DIRNODE, name: "assets", path: assetsPath}, nil
+	}
 
-		pat, err := generateAssetsTree(postDirPath, nonPostAssetsRxs)
+	return generateAssetsTreeFromPrevious(assetsPath, nil, nil, c.UndecodableImagesAsFiles)
+}
+
+// generatePost generates the versions in each lang of the post in dir and adds them to o.
+// The lists in o aren't sorted afterwards.
+func (o *generatePostsListsOutput) generatePost(input generatePostsListsInput, dir sectionPostDir) error {
+	postSlug := dir.slug
+	postDirPath := path.Join(input.bc.InPath, dir.section.Path, dir.path)
+
+	if input.bc.SkipEmptyPosts {
+		hasContent, err := hasPostContentFiles(postDirPath, input.c.Langs, input.c.ContentExtensions)
 		if err != nil {
-			return nil, fmt.Errorf("generating pat for %v post: %v", postSlug, err)
+			return err
+		}
+
+		if !hasContent {
+			input.bc.Logger.Warn("skipping post, since it doesn't have any content file", "post", postSlug)
+			return nil
 		}
+	}
 
-		// this condition exists so that assetsPathOut is only created if the post
-		// has at least one asset.
-		if pat.firstChild != nil {
-			assetsPathOut := path.Join(input.assetsOutPath, postSlug)
+	pat, err := generatePostAssetsTree(postDirPath, input.c)
+	if err != nil {
+		return fmt.Errorf("generating pat for %v post: %v", postSlug, err)
+	}
 
-			// it's checked whether assetsPathOut already exists because it could've
-			// been already created when generating the global assets tree (GAT) if
-			// there's a directory in it whose name is the same as the post's slug.
-			if _, err := os.Stat(assetsPathOut); err != nil {
-				if os.IsNotExist(err) {
-					err := os.Mkdir(assetsPathOut, os.ModeDir|os.ModePerm)
-					if err != nil {
-						return nil, fmt.Errorf("creating %v: %v", assetsPathOut, err)
-					}
-				} else {
-					return nil, err
+	// this condition exists so that assetsPathOut is only created if the post
+	// has at least one asset.
+	if pat.firstChild != nil {
+		assetsPathOut := path.Join(input.assetsOutPath, postSlug)
+
+		// it's checked whether assetsPathOut already exists because it could've
+		// been already created when generating the global assets tree (GAT) if
+		// there's a directory in it whose name is the same as the post's slug.
+		// The slugs of nested posts have more than one segment, hence MkdirAll.
+		if _, err := os.Stat(assetsPathOut); err != nil {
+			if os.IsNotExist(err) {
+				err := os.MkdirAll(assetsPathOut, input.pc.outputPerms().dir)
+				if err != nil {
+					return fmt.Errorf("creating %v: %v", assetsPathOut, err)
 				}
+			} else {
+				return err
 			}
+		}
 
-			if err = pat.process(assetsPathOut, false); err != nil {
-				return nil, fmt.Errorf("processing pat: %v", err)
-			}
+		if err = pat.process(assetsPathOut, false, input.pc); err != nil {
+			return fmt.Errorf("processing pat: %v", err)
 		}
+	}
 
-		// data.yaml file
-		postYAMLDataFile, err := os.Open(path.Join(postDirPath, "data.yaml"))
+	// data.yaml file
+	postYAMLDataFile, err := os.Open(path.Join(postDirPath, "data.yaml"))
+	if err != nil {
+		return fmt.Errorf("opening %v data.yaml: %v", postSlug, err)
+	}
+
+	var postYAMLData postYAMLDataFileContent
+	err = yaml.NewDecoder(postYAMLDataFile).Decode(&postYAMLData)
+	if err != nil {
+		return fmt.Errorf("decoding %v data.yaml: %v", postSlug, err)
+	}
+
+	postDate, err := parsePostDate(postYAMLData.Date, input.c.location)
+	if err != nil {
+		return &InvalidDateError{Slug: postSlug, Field: "date", Err: err}
+	}
+
+	var postLastUpdateDate time.Time
+
+	if postYAMLData.LastUpdateDate != "" {
+		postLastUpdateDate, err = parsePostDate(postYAMLData.LastUpdateDate, input.c.location)
 		if err != nil {
-			return nil, fmt.Errorf("opening %v data.yaml: %v", postSlug, err)
+			return &InvalidDateError{Slug: postSlug, Field: "lastUpdateDate", Err: err}
+		}
+	}
+
+	if input.c.location != nil {
+		postDate = postDate.In(input.c.location)
+		if !postLastUpdateDate.IsZero() {
+			postLastUpdateDate = postLastUpdateDate.In(input.c.location)
+		}
+	}
+
+	// content files
+	for _, l := range input.c.Langs {
+		p := Post{
+			Slug:           postSlug,
+			Date:           postDate,
+			LastUpdateDate: postLastUpdateDate,
+			WasUpdated:     wasUpdated(postDate, postLastUpdateDate, input.c.updateThreshold),
+			Weight:         postYAMLData.Weight,
+			NoSitemap:      postYAMLData.NoSitemap,
+			NoIndex:        postYAMLData.NoIndex,
+			Lang:           l,
+			URL:            input.c.urlStyle().pageRelURL(path.Join(dir.section.URLPrefix, postSlug), l),
+			Section:        dir.section,
+			pat:            pat,
 		}
 
-		var postYAMLData postYAMLDataFileContent
-		err = yaml.NewDecoder(postYAMLDataFile).Decode(&postYAMLData)
+		postContentFilenames := postContentFilenames(l.Tag, input.c.ContentExtensions)
+		postContentFilePath, err := findPostContentFile(postDirPath, postContentFilenames)
 		if err != nil {
-			return nil, fmt.Errorf("decoding %v data.yaml: %v", postSlug, err)
+			return err
 		}
 
-		postDate, err := time.Parse(time.RFC3339, postYAMLData.Date)
+		if postContentFilePath == "" {
+			return &MissingTranslationError{Slug: postSlug, Lang: l.Tag, Filenames: postContentFilenames}
+		}
+
+		postContent, err := os.ReadFile(postContentFilePath)
 		if err != nil {
-			return nil, fmt.Errorf("parsing %v data.yaml date: %v", postSlug, err)
+			return err
+		}
+		if !postContentRegExp.Match(postContent) {
+			return fmt.Errorf("post content at %v is invalid", postContentFilePath)
 		}
 
-		var postLastUpdateDate time.Time
+		matchesIndexes := postContentRegExp.FindSubmatchIndex(postContent)
+		postContentYAML := postContent[matchesIndexes[2]:matchesIndexes[3]]
+		postContentMD := postContent[matchesIndexes[4]:matchesIndexes[5]]
 
-		if postYAMLData.LastUpdateDate != "" {
-			postLastUpdateDate, err = time.Parse(time.RFC3339, postYAMLData.LastUpdateDate)
-			if err != nil {
-				return nil, fmt.Errorf("parsing %v data.yaml lastUpdateDate: %v", postSlug, err)
+		if input.buildsLang(l) {
+			if err := p.generateContent(input, l, postContentMD); err != nil {
+				return err
 			}
 		}
 
-		// content_*.md files
-		for _, l := range input.c.Langs {
-			var postURL string
+		// yaml
+		var yamlData postYAMLFrontMatter
+		err = yaml.Unmarshal(postContentYAML, &yamlData)
+		if err != nil {
+			return fmt.Errorf("parsing YAML content of %v: %v", postContentFilePath, err)
+		}
 
-			if l.Default {
-				postURL = fmt.Sprintf("/posts/%v", postSlug)
-			} else {
-				postURL = fmt.Sprintf("/%v/posts/%v", l.Tag, postSlug)
+		if yamlData.Title == "" {
+			return &EmptyFieldError{Slug: p.Slug, Lang: l.Tag, Field: "title"}
+		}
+
+		if yamlData.Excerpt == "" {
+			return &EmptyFieldError{Slug: p.Slug, Lang: l.Tag, Field: "excerpt"}
+		}
+
+		p.Title = yamlData.Title
+		p.Excerpt = truncateWords(yamlData.Excerpt, input.c.ExcerptWords)
+
+		defaultImgAlt := input.c.DefaultImgAlt[l.Tag]
+
+		if postYAMLData.Img != "" {
+			alt := firstNonEmpty(yamlData.ImgAlt, defaultImgAlt)
+			if alt == "" {
+				return fmt.Errorf("img alt in %v for %v post not provided", l.Tag, p.Slug)
 			}
 
-			p := Post{
-				Slug:           postSlug,
-				Date:           postDate,
-				LastUpdateDate: postLastUpdateDate,
-				Lang:           l,
-				URL:            postURL,
-				pat:            pat,
+			p.Img = &Img{
+				Path: postYAMLData.Img,
+				Alt:  alt,
 			}
+		}
 
-			postContentFilename := "content_" + l.Tag + ".md"
-			postContentFilePath := path.Join(postDirPath, postContentFilename)
-			postContent, err := os.ReadFile(postContentFilePath)
+		if postYAMLData.OGImage != "" {
+			alt := firstNonEmpty(yamlData.OGImageAlt, yamlData.ImgAlt, defaultImgAlt)
+			if alt == "" {
+				return fmt.Errorf("og image alt in %v for %v post not provided", l.Tag, p.Slug)
+			}
+
+			p.OGImage = &Img{
+				Path: postYAMLData.OGImage,
+				Alt:  alt,
+			}
+		}
+
+		// posts with an ogImage don't have a social card.
+		if p.OGImage == nil && input.socialCards != nil && input.buildsLang(l) {
+			card, err := input.socialCards.generate(p.Title)
 			if err != nil {
-				if os.IsNotExist(err) {
-					return nil, fmt.Errorf("%v for %v post doesn't exist", postContentFilename, postSlug)
-				}
+				return fmt.Errorf("generating social card in %v for %v post: %v", l.Tag, p.Slug, err)
+			}
 
-				return nil, err
+			cardNode := pat.addChild(FILENODE, socialCardNamePrefix+l.Tag+".png")
+			cardNode.setContent(card)
+
+			if err := cardNode.processFile(path.Join(input.assetsOutPath, postSlug), cardNode.name, input.pc); err != nil {
+				return fmt.Errorf("processing social card in %v for %v post: %v", l.Tag, p.Slug, err)
 			}
-			if !postContentRegExp.Match(postContent) {
-				return nil, fmt.Errorf("post content at %v is invalid", postContentFilePath)
+
+			p.OGImage = &Img{
+				Path: AssetRelPath(cardNode.name),
+				Alt:  p.Title,
 			}
+		}
 
-			matchesIndexes := postContentRegExp.FindSubmatchIndex(postContent)
-			postContentYAML := postContent[matchesIndexes[2]:matchesIndexes[3]]
-			postContentMD := postContent[matchesIndexes[4]:matchesIndexes[5]]
+		if o.allPostsByLangTag[l.Tag] == nil {
+			o.allPostsByLangTag[l.Tag] = make([]*Post, 0, 1)
+		}
 
-			p.generateContent(input, l, postContentMD)
+		o.allPostsByLangTag[l.Tag] = append(o.allPostsByLangTag[l.Tag], &p)
 
-			// yaml
-			var yamlData postYAMLFrontMatter
-			err = yaml.Unmarshal(postContentYAML, &yamlData)
-			if err != nil {
-				return nil, fmt.Errorf("parsing YAML content of %v: %v", postContentFilePath, err)
+		listed, feed := postYAMLData.visibility()
+		feed = feed && !postYAMLData.NoFeed
+
+		if feed {
+			if o.feedPostsByLangTag[l.Tag] == nil {
+				o.feedPostsByLangTag[l.Tag] = make([]*Post, 0, 1)
 			}
 
-			if yamlData.Title == "" {
-				return nil, fmt.Errorf("title field in %v post frontmatter in %v cannot be empty", p.Slug, l.Tag)
+			o.feedPostsByLangTag[l.Tag] = append(o.feedPostsByLangTag[l.Tag], &p)
+		}
+
+		if listed {
+			if o.visiblePostsByLangTag[l.Tag] == nil {
+				o.visiblePostsByLangTag[l.Tag] = make([]*Post, 0, 1)
 			}
 
-			if yamlData.Excerpt == "" {
-				return nil, fmt.Errorf("excerpt field in %v post frontmatter in %v cannot be empty", p.Slug, l.Tag)
+			o.visiblePostsByLangTag[l.Tag] = append(o.visiblePostsByLangTag[l.Tag], &p)
+		} else {
+			if o.invisiblePostsByLangTag[l.Tag] == nil {
+				o.invisiblePostsByLangTag[l.Tag] = make([]*Post, 0, 1)
 			}
 
-			p.Title = yamlData.Title
-			p.Excerpt = yamlData.Excerpt
+			o.invisiblePostsByLangTag[l.Tag] = append(o.invisiblePostsByLangTag[l.Tag], &p)
+		}
+	}
 
-			if postYAMLData.Img != "" {
-				if yamlData.ImgAlt == "" {
-					return nil, fmt.Errorf("img alt in %v for %v post not provided", l.Tag, p.Slug)
-				}
+	return nil
+}
+
+// sort sorts the lists of visible and feed posts in o by weight and date and links each
+// visible post to its chronological neighbors in the same lang and section.
+func (o *generatePostsListsOutput) sort() {
+	for langTag, posts := range o.visiblePostsByLangTag {
+		o.visiblePostsByLangTag[langTag] = sortPostsByWeightAndDateDesc(posts)
+
+		postsBySection := make(map[*Section][]*Post)
+		for _, p := range posts {
+			postsBySection[p.Section] = append(postsBySection[p.Section], p)
+		}
+
+		for _, sectionPosts := range postsBySection {
+			linkPostsByDate(sectionPosts)
+		}
+	}
+
+	for _, posts := range o.invisiblePostsByLangTag {
+		for _, p := range posts {
+			p.Prev, p.Next = nil, nil
+		}
+	}
+
+	for langTag, posts := range o.feedPostsByLangTag {
+		o.feedPostsByLangTag[langTag] = sortPostsByWeightAndDateDesc(posts)
+	}
+}
+
+// replacePost replaces the versions of the post whose slug is slug in o with the ones in
+// newLists, which may have none of them, and sorts the lists in o.
+func (o *generatePostsListsOutput) replacePost(slug string, newLists *generatePostsListsOutput) {
+	for _, lists := range []struct {
+		old, new map[string][]*Post
+	}{
+		{o.allPostsByLangTag, newLists.allPostsByLangTag},
+		{o.visiblePostsByLangTag, newLists.visiblePostsByLangTag},
+		{o.invisiblePostsByLangTag, newLists.invisiblePostsByLangTag},
+		{o.feedPostsByLangTag, newLists.feedPostsByLangTag},
+	} {
+		for langTag, posts := range lists.old {
+			lists.old[langTag] = slices.DeleteFunc(posts, func(p *Post) bool {
+				return p.Slug == slug
+			})
+		}
 
-				p.Img = &Img{
-					Path: postYAMLData.Img,
-					Alt:  yamlData.ImgAlt,
+		for langTag, posts := range lists.new {
+			lists.old[langTag] = append(lists.old[langTag], posts...)
+		}
+	}
+
+	o.sort()
+}
+
+// voidHTMLElements is the set of html elements that don't have an end tag.
+var voidHTMLElements = map[string]struct{}{
+	"area": {}, "base": {}, "br": {}, "col": {}, "embed": {}, "hr": {}, "img": {},
+	"input": {}, "link": {}, "meta": {}, "source": {}, "track": {}, "wbr": {},
+}
+
+// truncateWords returns the first n words of s followed by an ellipsis. Words are
+// only counted outside of html tags, so s is never cut inside a tag or an entity
+// (entities don't contain whitespace), and the tags left open are closed after the
+// ellipsis. If n isn't positive or s has at most n words, s is returned as is.
+func truncateWords(s string, n int) string {
+	if n <= 0 {
+		return s
+	}
+
+	var (
+		words, wordEnd int
+		inWord, inTag  bool
+		cut            = -1
+	)
+
+	for i := 0; i < len(s) && cut == -1; i++ {
+		switch c := s[i]; {
+		case inTag:
+			inTag = c != '>'
+		case c == '<':
+			inTag = true
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			inWord = false
+		default:
+			if !inWord {
+				inWord = true
+				words++
+
+				// the cut is made at the end of the nth word.
+				if words == n+1 {
+					cut = wordEnd
 				}
 			}
 
-			if output.allPostsByLangTag[l.Tag] == nil {
-				output.allPostsByLangTag[l.Tag] = make([]*Post, 0, 1)
-			}
+			wordEnd = i + 1
+		}
+	}
 
-			output.allPostsByLangTag[l.Tag] = append(output.allPostsByLangTag[l.Tag], &p)
+	if cut == -1 {
+		return s
+	}
 
-			if postYAMLData.Feed {
-				if output.visiblePostsByLangTag[l.Tag] == nil {
-					output.visiblePostsByLangTag[l.Tag] = make([]*Post, 0, 1)
-				}
+	truncated := s[:cut]
 
-				output.visiblePostsByLangTag[l.Tag] = append(output.visiblePostsByLangTag[l.Tag], &p)
-			} else {
-				if output.invisiblePostsByLangTag[l.Tag] == nil {
-					output.invisiblePostsByLangTag[l.Tag] = make([]*Post, 0, 1)
-				}
+	return truncated + "…" + closingHTMLTags(truncated)
+}
 
-				output.invisiblePostsByLangTag[l.Tag] = append(output.invisiblePostsByLangTag[l.Tag], &p)
+// closingHTMLTags returns the end tags of the elements left open in s, in the order they
+// need to be closed.
+func closingHTMLTags(s string) string {
+	var openTags []string
+
+	for {
+		start := strings.IndexByte(s, '<')
+		if start == -1 {
+			break
+		}
+
+		end := strings.IndexByte(s[start:], '>')
+		if end == -1 {
+			break
+		}
+
+		tag := s[start+1 : start+end]
+		s = s[start+end+1:]
+
+		closing := strings.HasPrefix(tag, "/")
+		name, _, _ := strings.Cut(strings.TrimPrefix(tag, "/"), " ")
+		name = strings.ToLower(strings.TrimSuffix(name, "/"))
+
+		switch {
+		case name == "" || strings.HasSuffix(tag, "/") || mapContains(voidHTMLElements, name):
+		case closing:
+			// the innermost element with the same name is the one being closed.
+			for i := len(openTags) - 1; i >= 0; i-- {
+				if openTags[i] == name {
+					openTags = openTags[:i]
+
+					break
+				}
 			}
+		default:
+			openTags = append(openTags, name)
+		}
+	}
+
+	var b strings.Builder
+	for i := len(openTags) - 1; i >= 0; i-- {
+		fmt.Fprintf(&b, "</%v>", openTags[i])
+	}
+
+	return b.String()
+}
+
+// groupPostsByYearAndMonth groups posts by the year and the month of their dates.
+// Both the groups and the posts in them are sorted by date in descending order.
+func groupPostsByYearAndMonth(posts []*Post) []YearGroup {
+	sorted := make([]*Post, len(posts))
+	copy(sorted, posts)
+
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Date.After(sorted[j].Date)
+	})
+
+	var groups []YearGroup
+
+	for _, p := range sorted {
+		year, month := p.Date.Year(), p.Date.Month()
+
+		if len(groups) == 0 || groups[len(groups)-1].Year != year {
+			groups = append(groups, YearGroup{Year: year})
+		}
+
+		yg := &groups[len(groups)-1]
+		if len(yg.Months) == 0 || yg.Months[len(yg.Months)-1].Month != month {
+			yg.Months = append(yg.Months, MonthGroup{Month: month})
+		}
+
+		mg := &yg.Months[len(yg.Months)-1]
+		mg.Posts = append(mg.Posts, p)
+	}
+
+	return groups
+}
+
+// postDateOnlyLayout is the layout of the dates of posts written without a time.
+const postDateOnlyLayout = "2006-01-02"
+
+// parsePostDate parses s, a date in the data.yaml file of a post, which is either an RFC 3339
+// date or one without a time, i.e. 2006-01-02, in which case it's midnight in loc, or in UTC
+// if loc is nil. If s is neither, the error of parsing it as an RFC 3339 date is returned.
+func parsePostDate(s string, loc *time.Location) (time.Time, error) {
+	t, err := time.Parse(time.RFC3339, s)
+	if err == nil {
+		return t, nil
+	}
+
+	if loc == nil {
+		loc = time.UTC
+	}
+
+	if t, dateOnlyErr := time.ParseInLocation(postDateOnlyLayout, s, loc); dateOnlyErr == nil {
+		return t, nil
+	}
+
+	return time.Time{}, err
+}
+
+// wasUpdated returns whether lastUpdateDate is set and more than threshold after date.
+func wasUpdated(date, lastUpdateDate time.Time, threshold time.Duration) bool {
+	return !lastUpdateDate.IsZero() && lastUpdateDate.Sub(date) > threshold
+}
+
+// linkPostsByDate sets the Prev and Next fields of each post in posts to the posts in it
+// right before and after it by date. Posts with the same date are ordered by slug.
+func linkPostsByDate(posts []*Post) {
+	sorted := make([]*Post, len(posts))
+	copy(sorted, posts)
+
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if !sorted[i].Date.Equal(sorted[j].Date) {
+			return sorted[i].Date.Before(sorted[j].Date)
+		}
+
+		return sorted[i].Slug < sorted[j].Slug
+	})
+
+	for i, p := range sorted {
+		p.Prev, p.Next = nil, nil
+
+		if i > 0 {
+			p.Prev = sorted[i-1]
+		}
+
+		if i < len(sorted)-1 {
+			p.Next = sorted[i+1]
 		}
 	}
+}
+
+// sortPostsByWeightAndDateDesc returns a copy of posts sorted by weight in descending order.
+// Posts with the same weight are sorted by date in descending order.
+func sortPostsByWeightAndDateDesc(posts []*Post) []*Post {
+	sorted := make([]*Post, len(posts))
+	copy(sorted, posts)
+
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if sorted[i].Weight != sorted[j].Weight {
+			return sorted[i].Weight > sorted[j].Weight
+		}
+
+		return sorted[i].Date.After(sorted[j].Date)
+	})
 
-	return &output, nil
+	return sorted
 }
 
 // Post is a post received by a template.
 type Post struct {
-	Title          string
-	Content        template.HTML
-	Slug           string
-	Excerpt        string
-	Img            *Img
+	Title   string
+	Content template.HTML
+	Slug    string
+	Excerpt string
+	Img     *Img
+	// OGImage is the img used in Open Graph meta tags. If it's nil, Img is used.
+	OGImage        *Img
 	Date           time.Time
 	LastUpdateDate time.Time
 	Lang           *Lang
+	// WasUpdated is whether LastUpdateDate is more than the updateThreshold in the config
+	// file after Date.
+	WasUpdated bool
+	// Weight is used to sort posts. The higher the weight, the closer a post is to the top.
+	Weight int
+	// NoSitemap is whether the post should be left out of sitemaps.
+	NoSitemap bool
+	// NoIndex is whether search engines shouldn't index the pages of the post, which have a
+	// robots meta tag with noindex.
+	NoIndex bool
 	// relative
 	URL string
+	// Section is the section the post is in.
+	Section *Section
+	// Prev and Next are the visible posts in the same lang and section published right
+	// before and right after this one. They're nil if there's none or if this post isn't visible.
+	Prev, Next *Post
+	// plainText is the text of the post's content, which is used in the search index.
+	plainText string
 	// pat is a tree composed of any files in the post's path
-	// whose name doesn't match any item in nonPostAssetsRxs.
+	// whose name doesn't match any of the regexps returned by generateNonPostAssetsRxs.
 	pat *assetsTreeNode
 }
 
 func (p *Post) generateContent(input generatePostsListsInput, l *Lang, markdown []byte) error {
-	mdProcessor := blackfriday.New(blackfriday.WithExtensions(blackfriday.CommonExtensions))
+	markdown, shortcodesPlaceholders, err := p.replaceShortcodes(input.bc.Shortcodes, l, markdown)
+	if err != nil {
+		return err
+	}
+
+	// besides the common extensions, DefinitionLists is explicitly enabled, since definition
+	// lists are rendered by the default branch in renderContentBFTree.
+	mdProcessor := blackfriday.New(blackfriday.WithExtensions(blackfriday.CommonExtensions | blackfriday.DefinitionLists))
 	rootNode := mdProcessor.Parse(markdown)
 
 	latexBlockMap, inlineLatexMap := p.processContentBFTree(input, rootNode)
 
-	err := latexGenerator.SetDirPath(input.bc.InPath)
+	if input.c.SearchIndex {
+		p.plainText = extractPlainText(rootNode, latexBlockMap, inlineLatexMap)
+	}
+
+	err = latexGenerator.SetDirPath(input.bc.InPath)
 	if err != nil {
 		return fmt.Errorf("setting latex image generator dir path: %w", err)
 	}
@@ -263,6 +931,10 @@ func (p *Post) generateContent(input generatePostsListsInput, l *Lang, markdown
 		return err
 	}
 
+	if len(shortcodesPlaceholders) > 0 {
+		p.Content = template.HTML(expandShortcodes([]byte(p.Content), shortcodesPlaceholders))
+	}
+
 	return nil
 }
 
@@ -333,117 +1005,35 @@ func (p *Post) processContentBFTree(input generatePostsListsInput, rootNode *bla
 			}
 
 		case node.Type == blackfriday.Text && entering:
+			// Code spans and code blocks hold their content in their own literal rather
+			// than in text nodes, so $ is never treated as latex inside them.
 			if input.c.Latex {
-				for i := 0; i < len(node.Literal); {
-					if node.Literal[i] == '$' {
-						if i != 0 && node.Literal[i-1] == '\\' {
-							node.Literal = slices.Delete(node.Literal, i-1, i)
-							i++
-							continue
-						}
-
-						if len(node.Literal) > i+1 && node.Literal[i+1] == '$' {
-							var (
-								found bool
-
-								start = i + 2
-								end   = start
-							)
-
-							for ; end < len(node.Literal); end++ {
-								if node.Literal[end] == '$' && node.Literal[end-1] != '\\' && len(node.Literal) > end+1 && node.Literal[end+1] == '$' {
-									found = true
-									break
-								}
-							}
-
-							if !found {
-								return blackfriday.GoToNext
-							}
-
-							content := node.Literal[start:end]
-
-							// If it's empty (i.e. $$$$), remove it.
-							if len(content) == 0 {
-								node.Literal = slices.Delete(node.Literal, start-2, end+2)
-								i++
-								continue
-							}
-
-							// If the first $ is not on the 0th position, then the current block needs to be
-							// splitted.
-							if i != 0 {
-								textNode := blackfriday.NewNode(blackfriday.Text)
-								textNode.Literal = node.Literal[:i]
-
-								node.InsertBefore(textNode)
-							}
-
-							// The content after the ending $$, if there's any, is the caption.
-							node.Title = node.Literal[end+2:]
-							node.Literal = content
-							latexBlockMap[node] = struct{}{}
-
-							return blackfriday.GoToNext
-						}
-
-						// Inline latex.
-						var (
-							found bool
-
-							start = i + 1
-							end   = start
-						)
-
-						for ; end < len(node.Literal); end++ {
-							if node.Literal[end] == '$' && node.Literal[end-1] != '\\' {
-								found = true
-								break
-							}
-						}
-
-						if !found {
-							return blackfriday.GoToNext
-						}
-
-						content := node.Literal[start:end]
-
-						// If it's empty (i.e. $$), remove it.
-						if len(content) == 0 {
-							node.Literal = slices.Delete(node.Literal, start-1, end+1)
-							i++
-							continue
-						}
-
-						// If the starting $ is not on the 0th position, then a text node needs to be inserted
-						// before the current node.
-						if i != 0 {
-							textNode := blackfriday.NewNode(blackfriday.Text)
-							textNode.Literal = node.Literal[:i]
+				tokens := tokenizeLatex(node.Literal)
+				if len(tokens) == 0 {
+					node.Literal = nil
 
-							node.InsertBefore(textNode)
-						}
+					return blackfriday.GoToNext
+				}
 
-						// If the ending $ is not on the last position, then a text node needs to be inserted
-						// after the current node.
-						if end != len(node.Literal)-1 {
-							textNode := blackfriday.NewNode(blackfriday.Text)
-							textNode.Literal = node.Literal[end+1:]
-
-							if node.Next == nil {
-								node.Parent.AppendChild(textNode)
-							} else {
-								node.Next.InsertBefore(textNode)
-							}
-						}
+				// Every token but the last one becomes a new node inserted before the
+				// current node, which holds the last token. This way, the walk doesn't
+				// visit the new nodes.
+				for i, tk := range tokens {
+					tkNode := node
+					if i != len(tokens)-1 {
+						tkNode = blackfriday.NewNode(blackfriday.Text)
+						node.InsertBefore(tkNode)
+					}
 
-						node.Literal = content
-						inlineLatexMap[node] = struct{}{}
+					tkNode.Literal = tk.content
 
-						return blackfriday.GoToNext
+					switch tk.t {
+					case blockLatexToken:
+						tkNode.Title = tk.caption
+						latexBlockMap[tkNode] = struct{}{}
+					case inlineLatexToken:
+						inlineLatexMap[tkNode] = struct{}{}
 					}
-
-					i++
 				}
 			}
 		}
@@ -454,6 +1044,46 @@ func (p *Post) processContentBFTree(input generatePostsListsInput, rootNode *bla
 	return latexBlockMap, inlineLatexMap
 }
 
+// extractPlainText returns the text in the tree rooted at rootNode with its whitespace
+// collapsed. Code blocks, html tags, latex and shortcodes are left out.
+func extractPlainText(rootNode *blackfriday.Node, latexBlockMap, inlineLatexMap map[*blackfriday.Node]struct{}) string {
+	var buff strings.Builder
+
+	rootNode.Walk(func(node *blackfriday.Node, entering bool) blackfriday.WalkStatus {
+		switch {
+		case node.Type == blackfriday.CodeBlock, node.Type == blackfriday.HTMLBlock, node.Type == blackfriday.HTMLSpan:
+			return blackfriday.SkipChildren
+		case node.Type == blackfriday.Text && (mapContains(latexBlockMap, node) || mapContains(inlineLatexMap, node)):
+			// a latex block's caption is part of the text.
+			buff.Write(node.Title)
+		case node.Type == blackfriday.Text, node.Type == blackfriday.Code:
+			buff.Write(shortcodePlaceholderRegExp.ReplaceAll(node.Literal, nil))
+		case node.Type == blackfriday.Softbreak, node.Type == blackfriday.Hardbreak:
+			buff.WriteByte(' ')
+		case !entering && isBFBlockNode(node):
+			// blocks are separated by whitespace, so that their words aren't joined.
+			buff.WriteByte(' ')
+		}
+
+		return blackfriday.GoToNext
+	})
+
+	return strings.Join(strings.Fields(buff.String()), " ")
+}
+
+// parseImgTitle splits the title of an img in a post into its sizes directive, if
+// there's any, and the remainder.
+func parseImgTitle(title string) (sizes, rest string) {
+	if !strings.HasPrefix(title, imgTitleSizesPrefix) {
+		return "", title
+	}
+
+	sizes, rest, _ = strings.Cut(strings.TrimPrefix(title, imgTitleSizesPrefix), ";")
+	sizes = strings.NewReplacer(`\(`, "(", `\)`, ")").Replace(sizes)
+
+	return strings.TrimSpace(sizes), strings.TrimSpace(rest)
+}
+
 func (p *Post) renderContentBFTree(input generatePostsListsInput, l *Lang, rootNode *blackfriday.Node, latexBlockMap, inlineLatexMap map[*blackfriday.Node]struct{}) error {
 	var (
 		traverseErr error
@@ -461,7 +1091,7 @@ func (p *Post) renderContentBFTree(input generatePostsListsInput, l *Lang, rootN
 	)
 
 	r := blackfriday.NewHTMLRenderer(blackfriday.HTMLRendererParameters{
-		Flags: blackfriday.HrefTargetBlank | blackfriday.NoreferrerLinks,
+		Flags: bfLinkFlags(input.c.linkTargetBlank()),
 	})
 
 	rootNode.Walk(func(bfNode *blackfriday.Node, entering bool) blackfriday.WalkStatus {
@@ -526,30 +1156,94 @@ func (p *Post) renderContentBFTree(input generatePostsListsInput, l *Lang, rootN
 
 			return blackfriday.GoToNext
 
+		case bfNode.Type == blackfriday.Image && entering && mediaMIMEType(string(bfNode.LinkData.Destination)) != "":
+			dest := string(bfNode.LinkData.Destination)
+
+			node, searchedInPAT := findByRelPathInGATOrPAT(input.gat, p.pat, AssetRelPath(dest))
+			if node == nil {
+				traverseErr = fmt.Errorf("%v media not found in %v post%v", dest, p.Slug, assetNotFoundHint(input.gat, p.pat, AssetRelPath(dest)))
+
+				return blackfriday.Terminate
+			}
+
+			var src string
+			if searchedInPAT {
+				src = node.assetLink(p.Slug, nil)
+			} else {
+				src = node.assetLink("", nil)
+			}
+
+			mimeType := mediaMIMEType(dest)
+			tag, _, _ := strings.Cut(mimeType, "/")
+
+			// the alt is the fallback content for browsers that don't support the tag.
+			var fallback string
+			if bfNode.FirstChild != nil {
+				fallback = html.EscapeString(string(bfNode.FirstChild.Literal))
+			}
+
+			var figcaption string
+			if len(bfNode.Title) > 0 {
+				figcaption = fmt.Sprintf("<figcaption>%s</figcaption>", renderBFInline(bfNode.Title, input.c.linkTargetBlank()))
+			}
+
+			fmt.Fprintf(
+				&htmlBuff,
+				`<figure><%v controls><source src="%v" type="%v">%v</%v>%v</figure>`,
+				tag,
+				src,
+				mimeType,
+				fallback,
+				tag,
+				figcaption,
+			)
+
+			return blackfriday.SkipChildren
+
 		case bfNode.Type == blackfriday.Image && entering:
-			if bfNode.FirstChild == nil || string(bfNode.FirstChild.Literal) == "" {
+			sizes, title := parseImgTitle(string(bfNode.Title))
+			if sizes == "" {
+				sizes = input.c.ResponsiveImgMediaQueries
+			}
+
+			// decorative imgs are the only ones allowed to not have an alt attribute.
+			decorative := title == decorativeImgTitle
+			if decorative {
+				title = ""
+			}
+
+			var alt string
+			if bfNode.FirstChild != nil {
+				alt = string(bfNode.FirstChild.Literal)
+			}
+
+			if alt == "" && !decorative {
 				traverseErr = fmt.Errorf("%v img in %v post in %v must have an alt attribute", string(bfNode.LinkData.Destination), p.Slug, l.Tag)
 
 				return blackfriday.Terminate
 			}
 
-			title := string(bfNode.Title)
-			alt := string(bfNode.FirstChild.Literal)
+			var role string
+			if decorative {
+				alt = ""
+				role = ` role="presentation"`
+			}
 
 			node, searchedInPAT := findByRelPathInGATOrPAT(input.gat, p.pat, AssetRelPath(bfNode.LinkData.Destination))
 			if node == nil {
 				traverseErr = fmt.Errorf(
-					"%v img not found in %v post",
+					"%v img not found in %v post%v",
 					string(bfNode.LinkData.Destination),
 					p.Slug,
+					assetNotFoundHint(input.gat, p.pat, AssetRelPath(bfNode.LinkData.Destination)),
 				)
 
 				return blackfriday.Terminate
 			}
 
-			node.addSizes(input.c.ResponsiveImgSizes...)
+			node.addSizes(input.pc.responsiveWidths(input.c.ResponsiveImgSizes)...)
 
-			if err := node.processSizes(); err != nil {
+			if err := node.processSizes(input.pc); err != nil {
 				traverseErr = fmt.Errorf("while processing sizes for %v img: %v", node.path, err)
 
 				return blackfriday.Terminate
@@ -557,7 +1251,7 @@ func (p *Post) renderContentBFTree(input generatePostsListsInput, l *Lang, rootN
 
 			var figcaption string
 			if title != "" {
-				figcaption = fmt.Sprintf("<figcaption>%v</figcaption>", title)
+				figcaption = fmt.Sprintf("<figcaption>%s</figcaption>", renderBFInline([]byte(title), input.c.linkTargetBlank()))
 			}
 
 			var src string
@@ -568,7 +1262,7 @@ func (p *Post) renderContentBFTree(input generatePostsListsInput, l *Lang, rootN
 			}
 
 			var img string
-			if input.c.ResponsiveImgMediaQueries != "" {
+			if sizes != "" {
 				var srcset string
 				if searchedInPAT {
 					srcset = node.generateSrcSetValue(p.Slug)
@@ -576,9 +1270,9 @@ func (p *Post) renderContentBFTree(input generatePostsListsInput, l *Lang, rootN
 					srcset = node.generateSrcSetValue("")
 				}
 
-				img = fmt.Sprintf(`<img srcset="%v" sizes="%v" src="%v" alt="%v">`, srcset, input.c.ResponsiveImgMediaQueries, src, alt)
+				img = fmt.Sprintf(`<img srcset="%v" sizes="%v" src="%v" alt="%v"%v>`, srcset, sizes, src, alt, role)
 			} else {
-				img = fmt.Sprintf(`<img src="%v" alt="%v">`, src, alt)
+				img = fmt.Sprintf(`<img src="%v" alt="%v"%v>`, src, alt, role)
 			}
 
 			htmlBuff.WriteString(
@@ -592,7 +1286,7 @@ func (p *Post) renderContentBFTree(input generatePostsListsInput, l *Lang, rootN
 				return blackfriday.GoToNext
 			}
 
-			svgBs, err := latexGenerator.SVGBlock(bfNode.Literal)
+			latexHTML, err := generateLatexHTML(input.c.LatexOutput, bfNode.Literal, false)
 			if err != nil {
 				traverseErr = fmt.Errorf("generating latex block in %v post: %w", p.Slug, err)
 
@@ -607,7 +1301,7 @@ func (p *Post) renderContentBFTree(input generatePostsListsInput, l *Lang, rootN
 			fmt.Fprintf(
 				&htmlBuff,
 				`<figure><div style="text-align: center; font-size: 2rem">%s</div>%s</figure>`,
-				svgBs,
+				latexHTML,
 				figCaption,
 			)
 
@@ -618,14 +1312,14 @@ func (p *Post) renderContentBFTree(input generatePostsListsInput, l *Lang, rootN
 				return blackfriday.GoToNext
 			}
 
-			svgBs, err := latexGenerator.SVGInline(bfNode.Literal)
+			latexHTML, err := generateLatexHTML(input.c.LatexOutput, bfNode.Literal, true)
 			if err != nil {
 				traverseErr = fmt.Errorf("generating inline latex in %v post: %w", p.Slug, err)
 
 				return blackfriday.Terminate
 			}
 
-			fmt.Fprintf(&htmlBuff, `<span>%s</span>`, svgBs)
+			fmt.Fprintf(&htmlBuff, `<span>%s</span>`, latexHTML)
 
 			return blackfriday.GoToNext
 
@@ -0,0 +1,554 @@
+package egen
+
+import (
+	"errors"
+	"io"
+	"log/slog"
+	"os"
+	"path"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alecthomas/chroma/styles"
+)
+
+func newTestPost(t *testing.T) (*Post, generatePostsListsInput) {
+	t.Helper()
+
+	pat, err := generateAssetsTree("testdata/tree/ok/1", nil)
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	if err := pat.process(t.TempDir(), false, nil); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	input := generatePostsListsInput{
+		bc: &BuildConfig{InPath: "testdata", ChromaStyle: styles.Get("swapoff")},
+		c:  &config{},
+	}
+
+	return &Post{Slug: "foo", pat: pat}, input
+}
+
+func TestGenerateContent_decorativeImg(t *testing.T) {
+	p, input := newTestPost(t)
+
+	err := p.generateContent(input, &Lang{Tag: "en"}, []byte(`![](imgs/red.png "decorative")`))
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	if !strings.Contains(string(p.Content), `alt="" role="presentation"`) {
+		t.Errorf("got %v, want a decorative img", p.Content)
+	}
+
+	if strings.Contains(string(p.Content), "figcaption") {
+		t.Errorf("got %v, want no figcaption", p.Content)
+	}
+}
+
+func TestGenerateContent_missingImgAlt(t *testing.T) {
+	tests := []string{
+		`![](imgs/red.png)`,
+		`![](imgs/red.png "some caption")`,
+	}
+
+	for _, test := range tests {
+		t.Run(test, func(t *testing.T) {
+			p, input := newTestPost(t)
+
+			err := p.generateContent(input, &Lang{Tag: "en"}, []byte(test))
+			if err == nil {
+				t.Fatal("expected an error")
+			}
+		})
+	}
+}
+
+func TestGenerateContent_plainText(t *testing.T) {
+	latexGenerator = &latexTestGenerator{}
+
+	p, input := newTestPost(t)
+	input.c.Latex = true
+	input.c.SearchIndex = true
+
+	md := "# Title\n\nSome *text* with `code`, $x$ and\na [link](https://foo.bar).\n\n" +
+		"```go\nfunc main() {}\n```\n\n- one\n- two\n\n$$E = mc^2$$ Mass\n\n<div>raw</div>"
+
+	if err := p.generateContent(input, &Lang{Tag: "en"}, []byte(md)); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	expected := "Title Some text with code, and a link. one two Mass raw"
+	if p.plainText != expected {
+		t.Errorf("got %q, want %q", p.plainText, expected)
+	}
+}
+
+func TestTruncateWords(t *testing.T) {
+	tests := []struct {
+		s        string
+		n        int
+		expected string
+	}{
+		{"one two three", 0, "one two three"},
+		{"one two three", -1, "one two three"},
+		{"one two three", 3, "one two three"},
+		{"one two three", 4, "one two three"},
+		{"one two three  ", 3, "one two three  "},
+		{"one two three", 2, "one two…"},
+		{"one  two\nthree", 1, "one…"},
+		{"one, two. three", 2, "one, two.…"},
+		{"Tom &amp; Jerry", 2, "Tom &amp;…"},
+		{`a <a href="/foo bar">link text</a> b`, 2, `a <a href="/foo bar">link…</a>`},
+		{"<em>one</em> two", 1, "<em>one…</em>"},
+		{"<em>one <strong>two</strong> three</em> four", 2, "<em>one <strong>two…</strong></em>"},
+		{"one<br> <br/>two three", 2, "one<br> <br/>two…"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.s+"/"+strconv.Itoa(test.n), func(t *testing.T) {
+			if got := truncateWords(test.s, test.n); got != test.expected {
+				t.Errorf("got %q, want %q", got, test.expected)
+			}
+		})
+	}
+}
+
+func TestParseImgTitle(t *testing.T) {
+	tests := []struct {
+		title, expectedSizes, expectedRest string
+	}{
+		{"", "", ""},
+		{"some caption", "", "some caption"},
+		{"decorative", "", "decorative"},
+		{"sizes=50vw", "50vw", ""},
+		{"sizes=(max-width: 40em) 100vw, 20em; some caption", "(max-width: 40em) 100vw, 20em", "some caption"},
+		{"sizes=20em;decorative", "20em", "decorative"},
+		{`sizes=\(max-width: 40em\) 50vw; c`, "(max-width: 40em) 50vw", "c"},
+		{"caption with sizes=20em", "", "caption with sizes=20em"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.title, func(t *testing.T) {
+			sizes, rest := parseImgTitle(test.title)
+
+			if sizes != test.expectedSizes || rest != test.expectedRest {
+				t.Errorf("got (%q, %q), want (%q, %q)", sizes, rest, test.expectedSizes, test.expectedRest)
+			}
+		})
+	}
+}
+
+func TestGenerateContent_imgSizesOverride(t *testing.T) {
+	p, input := newTestPost(t)
+	input.c.ResponsiveImgMediaQueries = "100vw"
+
+	md := "![Red](imgs/red.png \"sizes=\\(max-width: 40em\\) 50vw, 20em; Thumbnail\")\n\n![Red](imgs/red.png)"
+
+	err := p.generateContent(input, &Lang{Tag: "en"}, []byte(md))
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	content := string(p.Content)
+
+	for _, expected := range []string{
+		`sizes="(max-width: 40em) 50vw, 20em"`,
+		`<figcaption>Thumbnail</figcaption>`,
+		`sizes="100vw"`,
+	} {
+		if !strings.Contains(content, expected) {
+			t.Errorf("got %v, want it to contain %v", content, expected)
+		}
+	}
+}
+
+func TestGenerateContent_imgCaptionMarkdown(t *testing.T) {
+	p, input := newTestPost(t)
+
+	md := "![Red][red]\n\n[red]: imgs/red.png \"A *red* square from [foo](https://foo.bar) <script>\""
+
+	err := p.generateContent(input, &Lang{Tag: "en"}, []byte(md))
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	expected := `<figcaption>A <em>red</em> square from <a href="https://foo.bar" target="_blank" rel="noreferrer">foo</a> &lt;script&gt;</figcaption>`
+	if !strings.Contains(string(p.Content), expected) {
+		t.Errorf("got %v, want it to contain %v", p.Content, expected)
+	}
+}
+
+func TestGenerateContent_linkTargetBlank(t *testing.T) {
+	yes, no := true, false
+
+	tests := []struct {
+		linkTargetBlank *bool
+		expected        string
+	}{
+		{nil, `<a href="https://foo.bar" target="_blank" rel="noreferrer">foo</a>`},
+		{&yes, `<a href="https://foo.bar" target="_blank" rel="noreferrer">foo</a>`},
+		{&no, `<a href="https://foo.bar">foo</a>`},
+	}
+
+	for _, test := range tests {
+		p, input := newTestPost(t)
+		input.c.LinkTargetBlank = test.linkTargetBlank
+
+		md := "[foo](https://foo.bar)\n\n![Red][red]\n\n[red]: imgs/red.png \"From [foo](https://foo.bar)\""
+
+		err := p.generateContent(input, &Lang{Tag: "en"}, []byte(md))
+		if err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+
+		// the link in the paragraph and the one in the figcaption.
+		if count := strings.Count(string(p.Content), test.expected); count != 2 {
+			t.Errorf("got %v, want it to contain %v twice", p.Content, test.expected)
+		}
+
+		if test.linkTargetBlank != nil && !*test.linkTargetBlank && strings.Contains(string(p.Content), "target=") {
+			t.Errorf("got %v, want no target attr", p.Content)
+		}
+	}
+}
+
+func TestPostYAMLDataFileContentVisibility(t *testing.T) {
+	yes, no := true, false
+
+	tests := []struct {
+		feed, listed                 *bool
+		expectedListed, expectedFeed bool
+	}{
+		{&yes, &yes, true, true},
+		{&yes, &no, false, true},
+		{&no, &yes, true, false},
+		{&no, &no, false, false},
+		{&yes, nil, true, true},
+		{&no, nil, false, false},
+		{nil, &yes, true, true},
+		{nil, &no, false, false},
+		{nil, nil, false, false},
+	}
+
+	for i, test := range tests {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			d := postYAMLDataFileContent{
+				Feed:   test.feed,
+				Listed: test.listed,
+			}
+
+			listed, feed := d.visibility()
+
+			if listed != test.expectedListed {
+				t.Errorf("got listed = %v, want %v", listed, test.expectedListed)
+			}
+
+			if feed != test.expectedFeed {
+				t.Errorf("got feed = %v, want %v", feed, test.expectedFeed)
+			}
+		})
+	}
+}
+
+func TestSortPostsByWeightAndDateDesc(t *testing.T) {
+	pinned := &Post{Slug: "pinned", Weight: 1, Date: time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC)}
+	morePinned := &Post{Slug: "more-pinned", Weight: 2, Date: time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC)}
+	oldest := &Post{Slug: "oldest", Date: time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC)}
+	newest := &Post{Slug: "newest", Date: time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)}
+	middle := &Post{Slug: "middle", Date: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)}
+
+	posts := []*Post{oldest, pinned, newest, morePinned, middle}
+	expected := []*Post{morePinned, pinned, newest, middle, oldest}
+
+	res := sortPostsByWeightAndDateDesc(posts)
+
+	if !reflect.DeepEqual(res, expected) {
+		t.Errorf("got %v, want %v", res, expected)
+	}
+
+	if posts[0] != oldest {
+		t.Error("the original slice should not be modified")
+	}
+}
+
+func TestGroupPostsByYearAndMonth(t *testing.T) {
+	date := func(year int, month time.Month, day int) time.Time {
+		return time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+	}
+
+	a := &Post{Slug: "a", Date: date(2023, time.March, 1)}
+	b := &Post{Slug: "b", Date: date(2024, time.January, 10)}
+	c := &Post{Slug: "c", Date: date(2023, time.March, 20)}
+	d := &Post{Slug: "d", Date: date(2024, time.February, 1)}
+	e := &Post{Slug: "e", Date: date(2023, time.December, 1)}
+
+	expected := []YearGroup{
+		{Year: 2024, Months: []MonthGroup{
+			{Month: time.February, Posts: []*Post{d}},
+			{Month: time.January, Posts: []*Post{b}},
+		}},
+		{Year: 2023, Months: []MonthGroup{
+			{Month: time.December, Posts: []*Post{e}},
+			{Month: time.March, Posts: []*Post{c, a}},
+		}},
+	}
+
+	got := groupPostsByYearAndMonth([]*Post{a, b, c, d, e})
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("got %+v, want %+v", got, expected)
+	}
+
+	if got := groupPostsByYearAndMonth(nil); got != nil {
+		t.Errorf("got %+v, want nil", got)
+	}
+}
+
+func TestGeneratePostsListsOutputSort_prevNext(t *testing.T) {
+	date := func(year int) time.Time {
+		return time.Date(year, 1, 1, 0, 0, 0, 0, time.UTC)
+	}
+
+	first := &Post{Slug: "first", Date: date(2020)}
+	middle := &Post{Slug: "middle", Weight: 1, Date: date(2022)}
+	last := &Post{Slug: "last", Date: date(2024)}
+	invisible := &Post{Slug: "invisible", Date: date(2023)}
+	other := &Post{Slug: "other", Date: date(2021)}
+
+	o := newGeneratePostsListsOutput()
+	o.visiblePostsByLangTag["en"] = []*Post{last, first, middle}
+	o.invisiblePostsByLangTag["en"] = []*Post{invisible}
+	o.visiblePostsByLangTag["pt-BR"] = []*Post{other}
+
+	o.sort()
+
+	tests := []struct {
+		p                          *Post
+		expectedPrev, expectedNext *Post
+	}{
+		{first, nil, middle},
+		{middle, first, last},
+		{last, middle, nil},
+		{invisible, nil, nil},
+		{other, nil, nil},
+	}
+
+	for _, test := range tests {
+		if test.p.Prev != test.expectedPrev {
+			t.Errorf("got %v as prev of %v, want %v", test.p.Prev, test.p.Slug, test.expectedPrev)
+		}
+
+		if test.p.Next != test.expectedNext {
+			t.Errorf("got %v as next of %v, want %v", test.p.Next, test.p.Slug, test.expectedNext)
+		}
+	}
+}
+
+func TestWasUpdated(t *testing.T) {
+	date := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		lastUpdateDate time.Time
+		threshold      time.Duration
+		expected       bool
+	}{
+		{time.Time{}, 0, false},
+		{date, 0, false},
+		{date.Add(time.Minute), 0, true},
+		{date.Add(time.Minute), time.Hour, false},
+		{date.Add(time.Hour), time.Hour, false},
+		{date.Add(time.Hour + time.Second), time.Hour, true},
+		{date.Add(-time.Hour), 0, false},
+	}
+
+	for _, test := range tests {
+		if res := wasUpdated(date, test.lastUpdateDate, test.threshold); res != test.expected {
+			t.Errorf("got %v for %v with a threshold of %v, want %v", res, test.lastUpdateDate, test.threshold, test.expected)
+		}
+	}
+}
+
+func TestParsePostDate(t *testing.T) {
+	tokyo, err := time.LoadLocation("Asia/Tokyo")
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	tests := []struct {
+		s        string
+		loc      *time.Location
+		expected string
+		err      bool
+	}{
+		{"2024-01-15T10:30:00-03:00", nil, "2024-01-15T10:30:00-03:00", false},
+		{"2024-01-15T10:30:00-03:00", tokyo, "2024-01-15T10:30:00-03:00", false},
+		{"2024-01-15", nil, "2024-01-15T00:00:00Z", false},
+		{"2024-01-15", tokyo, "2024-01-15T00:00:00+09:00", false},
+		{"2024-01-15 10:30", nil, "", true},
+		{"2024-13-01", nil, "", true},
+		{"15/01/2024", tokyo, "", true},
+		{"", nil, "", true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.s, func(t *testing.T) {
+			res, err := parsePostDate(test.s, test.loc)
+			if test.err {
+				if err == nil {
+					t.Fatalf("expected an error, got %v", res)
+				}
+
+				var parseErr *time.ParseError
+				if !errors.As(err, &parseErr) || parseErr.Layout != time.RFC3339 {
+					t.Errorf("got %v, want the error of parsing it as an RFC 3339 date", err)
+				}
+
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected err: %v", err)
+			}
+
+			if got := res.Format(time.RFC3339); got != test.expected {
+				t.Errorf("got %v, want %v", got, test.expected)
+			}
+		})
+	}
+}
+
+func TestReadPostDirs(t *testing.T) {
+	tests := []struct {
+		names     []string
+		normalize bool
+		strict    bool
+		expected  []postDir
+		err       bool
+	}{
+		{
+			[]string{"hello", "a-b-2"},
+			false,
+			true,
+			[]postDir{{"a-b-2", "a-b-2"}, {"hello", "hello"}},
+			false,
+		},
+		{[]string{"Hello World"}, false, false, []postDir{{"Hello World", "Hello World"}}, false},
+		{[]string{"Hello World"}, false, true, nil, true},
+		{[]string{"hello--world"}, false, true, nil, true},
+		{
+			[]string{"Hello World", " The_Thing! ", "ok"},
+			true,
+			true,
+			[]postDir{{" The_Thing! ", "the-thing"}, {"Hello World", "hello-world"}, {"ok", "ok"}},
+			false,
+		},
+		{[]string{"Hello", "hello"}, true, false, nil, true},
+		{[]string{"!!"}, true, false, nil, true},
+	}
+
+	for _, test := range tests {
+		t.Run(strings.Join(test.names, ","), func(t *testing.T) {
+			dir := t.TempDir()
+
+			for _, name := range test.names {
+				if err := os.Mkdir(path.Join(dir, name), 0755); err != nil {
+					t.Fatalf("unexpected err: %v", err)
+				}
+			}
+
+			// files are ignored.
+			if err := os.WriteFile(path.Join(dir, "Not A Post.txt"), nil, 0644); err != nil {
+				t.Fatalf("unexpected err: %v", err)
+			}
+
+			dirs, err := readPostDirs(dir, test.normalize, test.strict, "", slog.New(slog.NewTextHandler(io.Discard, nil)))
+			if test.err {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected err: %v", err)
+			}
+
+			if !reflect.DeepEqual(dirs, test.expected) {
+				t.Errorf("got %v, want %v", dirs, test.expected)
+			}
+		})
+	}
+}
+
+func TestReadPostDirs_nesting(t *testing.T) {
+	tests := []struct {
+		nesting  string
+		dirs     []string
+		expected []postDir
+		err      bool
+	}{
+		{
+			"",
+			[]string{"2024/hello", "foo"},
+			[]postDir{{"2024", "2024"}, {"foo", "foo"}},
+			false,
+		},
+		{
+			flatPostsNesting,
+			[]string{"2024/hello", "2024/02/bar", "foo", "empty/"},
+			[]postDir{{"2024/02/bar", "bar"}, {"2024/hello", "hello"}, {"foo", "foo"}},
+			false,
+		},
+		{
+			nestedPostsNesting,
+			[]string{"2024/hello", "2024/02/bar", "foo", "empty/"},
+			[]postDir{{"2024/02/bar", "2024/02/bar"}, {"2024/hello", "2024/hello"}, {"foo", "foo"}},
+			false,
+		},
+		{flatPostsNesting, []string{"2023/hello", "2024/hello"}, nil, true},
+		{nestedPostsNesting, []string{"2023/hello", "2024/hello"}, []postDir{{"2023/hello", "2023/hello"}, {"2024/hello", "2024/hello"}}, false},
+		{nestedPostsNesting, []string{"Old Posts/hello"}, nil, true},
+		{flatPostsNesting, []string{"Old Posts/hello"}, []postDir{{"Old Posts/hello", "hello"}}, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.nesting+" "+strings.Join(test.dirs, ","), func(t *testing.T) {
+			dir := t.TempDir()
+
+			// the directories that don't end with / are post directories, i.e. they have
+			// a data.yaml file.
+			for _, d := range test.dirs {
+				if err := os.MkdirAll(path.Join(dir, d), 0755); err != nil {
+					t.Fatalf("unexpected err: %v", err)
+				}
+
+				if !strings.HasSuffix(d, "/") {
+					if err := os.WriteFile(path.Join(dir, d, "data.yaml"), nil, 0644); err != nil {
+						t.Fatalf("unexpected err: %v", err)
+					}
+				}
+			}
+
+			dirs, err := readPostDirs(dir, false, true, test.nesting, slog.New(slog.NewTextHandler(io.Discard, nil)))
+			if test.err {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected err: %v", err)
+			}
+
+			if !reflect.DeepEqual(dirs, test.expected) {
+				t.Errorf("got %v, want %v", dirs, test.expected)
+			}
+		})
+	}
+}
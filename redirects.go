@@ -0,0 +1,133 @@
+package egen
+
+import (
+	"fmt"
+	"io"
+	"net/url"
+	"path"
+	"strings"
+)
+
+var redirectsFilename = "_redirects"
+
+// defaultRedirectStatus is the status of redirects that don't set one.
+const defaultRedirectStatus = 301
+
+var redirectStatuses = map[int]struct{}{
+	200: {},
+	301: {},
+	302: {},
+	303: {},
+	307: {},
+	308: {},
+	404: {},
+	410: {},
+}
+
+// Redirect represents a redirect in a Netlify-style _redirects file.
+type Redirect struct {
+	// From is the path that's redirected.
+	From string
+	// To is the path or the absolute URL From is redirected to.
+	To string
+	// Status is the HTTP status of the redirect. It defaults to 301.
+	Status int
+	// Post is whether From and To are slugs of posts, in which case a redirect from the
+	// URL of the former to the one of the latter is generated for each lang. To must be the
+	// slug of a post, and the URLs are in the section of each post, with From, usually the
+	// former slug of To, being in the section of To unless it's also the slug of a post.
+	Post bool
+}
+
+// validate checks whether r, the redirect at index i of redirects in the config file, is
+// well-formed, setting its status to defaultRedirectStatus if it's not set.
+func (r *Redirect) validate(i int) error {
+	if r.Status == 0 {
+		r.Status = defaultRedirectStatus
+	}
+
+	if !mapContains(redirectStatuses, r.Status) {
+		return fmt.Errorf("status of redirects[%v] in config file isn't a supported status: %v", i, r.Status)
+	}
+
+	if r.Post {
+		for _, slug := range []string{r.From, r.To} {
+			if !isRedirectPostSlug(slug) {
+				return fmt.Errorf("from and to of redirects[%v] in config file must be post slugs, got %q", i, slug)
+			}
+		}
+
+		return nil
+	}
+
+	if !isRedirectPath(r.From) {
+		return fmt.Errorf("from of redirects[%v] in config file must be a path starting with /, got %q", i, r.From)
+	}
+
+	if !isRedirectPath(r.To) {
+		u, err := url.Parse(r.To)
+		if err != nil || !u.IsAbs() || u.Host == "" || strings.ContainsAny(r.To, " \t\n") {
+			return fmt.Errorf("to of redirects[%v] in config file must be a path starting with / or an absolute URL, got %q", i, r.To)
+		}
+	}
+
+	return nil
+}
+
+// isRedirectPath returns whether p can be used as a path in a _redirects file, i.e. whether
+// it starts with / and doesn't have any whitespace, which separates the fields of a redirect.
+func isRedirectPath(p string) bool {
+	return strings.HasPrefix(p, "/") && !strings.ContainsAny(p, " \t\n")
+}
+
+// isRedirectPostSlug returns whether slug can be the slug of a post in a redirect, i.e.
+// whether it's made of non-empty segments separated by /, as the slugs of nested posts, e.g.
+// 2024/hello, without any whitespace.
+func isRedirectPostSlug(slug string) bool {
+	if strings.ContainsAny(slug, " \t\n") {
+		return false
+	}
+
+	for _, segment := range strings.Split(slug, "/") {
+		if segment == "" || segment == "." || segment == ".." {
+			return false
+		}
+	}
+
+	return true
+}
+
+// writeRedirects writes the redirects in c to w in the format of Netlify's _redirects
+// file. The URLs of posts, which are in postsLists, are generated according to style.
+func writeRedirects(w io.Writer, c *config, style urlStyle, postsLists *generatePostsListsOutput) error {
+	for i, r := range c.Redirects {
+		if !r.Post {
+			if _, err := fmt.Fprintf(w, "%v %v %v\n", r.From, r.To, r.Status); err != nil {
+				return err
+			}
+
+			continue
+		}
+
+		toPost := postsLists.findPostBySlug(r.To)
+		if toPost == nil {
+			return fmt.Errorf("to of redirects[%v] in config file isn't the slug of a post: %v", i, r.To)
+		}
+
+		fromSection := toPost.Section
+		if fromPost := postsLists.findPostBySlug(r.From); fromPost != nil {
+			fromSection = fromPost.Section
+		}
+
+		for _, l := range c.Langs {
+			from := style.pageRelURL(path.Join(fromSection.URLPrefix, r.From), l)
+			to := style.pageRelURL(path.Join(toPost.Section.URLPrefix, r.To), l)
+
+			if _, err := fmt.Fprintf(w, "%v %v %v\n", from, to, r.Status); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,135 @@
+package egen
+
+import (
+	"bytes"
+	"strconv"
+	"testing"
+)
+
+func TestRedirect_validate(t *testing.T) {
+	tests := []struct {
+		r              Redirect
+		expectedStatus int
+		err            bool
+	}{
+		{Redirect{From: "/old", To: "/new"}, 301, false},
+		{Redirect{From: "/old/*", To: "/new/:splat", Status: 302}, 302, false},
+		{Redirect{From: "/old", To: "https://foo.bar/new"}, 301, false},
+		{Redirect{From: "old-slug", To: "new-slug", Post: true}, 301, false},
+		{Redirect{From: "old", To: "/new"}, 0, true},
+		{Redirect{From: "/old", To: "new"}, 0, true},
+		{Redirect{From: "/old path", To: "/new"}, 0, true},
+		{Redirect{From: "/old", To: "https://foo.bar/new path"}, 0, true},
+		{Redirect{From: "/old", To: "/new", Status: 999}, 0, true},
+		{Redirect{From: "/old", To: "new-slug", Post: true}, 0, true},
+		{Redirect{From: "old-slug", To: "", Post: true}, 0, true},
+		{Redirect{From: "2023/old-slug", To: "2024/new-slug", Post: true}, 301, false},
+		{Redirect{From: "2023//old-slug", To: "new-slug", Post: true}, 0, true},
+		{Redirect{From: "old-slug/", To: "new-slug", Post: true}, 0, true},
+		{Redirect{From: "../old-slug", To: "new-slug", Post: true}, 0, true},
+		{Redirect{From: "old slug", To: "new-slug", Post: true}, 0, true},
+	}
+
+	for i, test := range tests {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			err := test.r.validate(0)
+			if test.err {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected err: %v", err)
+			}
+
+			if test.r.Status != test.expectedStatus {
+				t.Errorf("got %v status, want %v", test.r.Status, test.expectedStatus)
+			}
+		})
+	}
+}
+
+func TestWriteRedirects(t *testing.T) {
+	en := &Lang{Tag: "en", Default: true}
+	ptBR := &Lang{Tag: "pt-BR"}
+
+	postsSection := &Section{Name: "posts", URLPrefix: "posts"}
+	notesSection := &Section{Name: "notes", URLPrefix: "notes"}
+
+	postsLists := newGeneratePostsListsOutput()
+	postsLists.allPostsByLangTag[en.Tag] = []*Post{
+		{Slug: "new-slug", Section: postsSection},
+		{Slug: "new-note", Section: notesSection},
+		{Slug: "moved", Section: notesSection},
+		{Slug: "2024/nested", Section: postsSection},
+	}
+
+	c := &config{
+		configFileData: configFileData{
+			Langs:     []*Lang{en, ptBR},
+			PostsPath: "posts",
+			Redirects: []*Redirect{
+				{From: "/old", To: "/new", Status: 301},
+				{From: "old-slug", To: "new-slug", Status: 302, Post: true},
+				// from isn't a post, so it's in the section of to.
+				{From: "old-note", To: "new-note", Status: 301, Post: true},
+				// from is a post, so it's in its own section.
+				{From: "moved", To: "new-slug", Status: 301, Post: true},
+				// the slugs of nested posts have slashes.
+				{From: "2023/nested", To: "2024/nested", Status: 301, Post: true},
+			},
+		},
+	}
+
+	tests := []struct {
+		style    urlStyle
+		expected string
+	}{
+		{
+			urlStyle{},
+			"/old /new 301\n" +
+				"/posts/old-slug /posts/new-slug 302\n" +
+				"/pt-BR/posts/old-slug /pt-BR/posts/new-slug 302\n" +
+				"/notes/old-note /notes/new-note 301\n" +
+				"/pt-BR/notes/old-note /pt-BR/notes/new-note 301\n" +
+				"/notes/moved /posts/new-slug 301\n" +
+				"/pt-BR/notes/moved /pt-BR/posts/new-slug 301\n" +
+				"/posts/2023/nested /posts/2024/nested 301\n" +
+				"/pt-BR/posts/2023/nested /pt-BR/posts/2024/nested 301\n",
+		},
+		{
+			urlStyle{uglyURLs: true},
+			"/old /new 301\n" +
+				"/posts/old-slug.html /posts/new-slug.html 302\n" +
+				"/pt-BR/posts/old-slug.html /pt-BR/posts/new-slug.html 302\n" +
+				"/notes/old-note.html /notes/new-note.html 301\n" +
+				"/pt-BR/notes/old-note.html /pt-BR/notes/new-note.html 301\n" +
+				"/notes/moved.html /posts/new-slug.html 301\n" +
+				"/pt-BR/notes/moved.html /pt-BR/posts/new-slug.html 301\n" +
+				"/posts/2023/nested.html /posts/2024/nested.html 301\n" +
+				"/pt-BR/posts/2023/nested.html /pt-BR/posts/2024/nested.html 301\n",
+		},
+	}
+
+	for i, test := range tests {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			var buff bytes.Buffer
+			if err := writeRedirects(&buff, c, test.style, postsLists); err != nil {
+				t.Fatalf("unexpected err: %v", err)
+			}
+
+			if buff.String() != test.expected {
+				t.Errorf("got %q, want %q", buff.String(), test.expected)
+			}
+		})
+	}
+
+	c.Redirects = []*Redirect{{From: "old-slug", To: "missing", Status: 301, Post: true}}
+
+	var buff bytes.Buffer
+	if err := writeRedirects(&buff, c, urlStyle{}, postsLists); err == nil {
+		t.Error("expected an error for a redirect to a post that doesn't exist")
+	}
+}
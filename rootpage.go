@@ -0,0 +1,99 @@
+package egen
+
+import (
+	"html/template"
+	"io"
+	"strings"
+)
+
+const (
+	// defaultRootStrategy places the home page of the default lang at the root of the site.
+	defaultRootStrategy = "default"
+	// redirectRootStrategy places a page at the root of the site that redirects to the home
+	// page of the lang of the browser, or of the default lang if the site isn't in it.
+	redirectRootStrategy = "redirect"
+	// pickerRootStrategy places a page at the root of the site that links to the home page of
+	// each lang.
+	pickerRootStrategy = "picker"
+)
+
+// rootPageName is the name the root page is passed to BuildConfig.PostProcessHTML with, as
+// TemplateData.Page is for the other pages.
+const rootPageName = "root"
+
+// rootPageTemplate is the template of the page placed at the root of the site if
+// RootStrategy is redirect or picker.
+var rootPageTemplate = template.Must(template.New("root").Parse(`<!DOCTYPE html>
+<html lang="{{ .Lang.Tag }}">
+<head>
+  <meta charset="UTF-8">
+  <meta name="viewport" content="width=device-width, initial-scale=1">
+  <title>{{ .Title }}</title>
+  {{ if .Redirect }}
+  <script>
+    (function() {
+      var homes = {{ .HomesByTag }};
+      var tags = navigator.languages || [navigator.language];
+      for (var i = 0; i < tags.length; i++) {
+        var tag = (tags[i] || "").toLowerCase();
+        var home = homes[tag] || homes[tag.split("-")[0]];
+        if (home) {
+          location.replace(home);
+          return;
+        }
+      }
+      location.replace({{ .DefaultHome }});
+    })();
+  </script>
+  <noscript><meta http-equiv="refresh" content="0; url={{ .DefaultHome }}"></noscript>
+  {{ end }}
+</head>
+<body>
+  <ul>
+    {{ range .Links }}<li><a href="{{ .URL }}" hreflang="{{ .Lang.Tag }}" lang="{{ .Lang.Tag }}">{{ or .Lang.Name .Lang.Tag }}</a></li>{{ end }}
+  </ul>
+</body>
+</html>
+`))
+
+type rootPageTemplateData struct {
+	Title string
+	// Lang is the default lang.
+	Lang *Lang
+	// Links are the links to the home page of each lang, with the default lang first.
+	Links    []*AlternateLink
+	Redirect bool
+	// HomesByTag maps the lowercased tag of each lang, as well as its primary subtag, e.g.
+	// pt for pt-BR, to the URL of its home page. A primary subtag is mapped to the first
+	// lang in Links with it.
+	HomesByTag  map[string]string
+	DefaultHome string
+}
+
+// writeRootPage writes the page placed at the root of the site if the root strategy in c
+// is redirect or picker to w. The URLs of home pages are generated according to style.
+func writeRootPage(w io.Writer, c *config, langs []*Lang, style urlStyle) error {
+	links := generateAlternateLinks(nil, nil, homePageKind, langs, style)
+
+	tData := rootPageTemplateData{
+		Title:       c.Title,
+		Lang:        c.defaultLang,
+		Links:       links,
+		Redirect:    c.RootStrategy == redirectRootStrategy,
+		HomesByTag:  make(map[string]string, 2*len(links)),
+		DefaultHome: style.pageRelURL("", c.defaultLang),
+	}
+
+	for _, link := range links {
+		tData.HomesByTag[strings.ToLower(link.Lang.Tag)] = link.URL
+	}
+
+	for _, link := range links {
+		primary, _, _ := strings.Cut(strings.ToLower(link.Lang.Tag), "-")
+		if _, ok := tData.HomesByTag[primary]; !ok {
+			tData.HomesByTag[primary] = link.URL
+		}
+	}
+
+	return rootPageTemplate.Execute(w, tData)
+}
@@ -0,0 +1,190 @@
+package egen
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"regexp"
+)
+
+var (
+	shortcodeRegExp     = regexp.MustCompile(`\{\{<\s*([a-zA-Z0-9_-]+)((?:\s+[a-zA-Z0-9_-]+="[^"]*")*)\s*>\}\}`)
+	shortcodeArgsRegExp = regexp.MustCompile(`([a-zA-Z0-9_-]+)="([^"]*)"`)
+	// shortcodePlaceholderRegExp matches the placeholders created by replaceShortcodes.
+	shortcodePlaceholderRegExp = regexp.MustCompile(`EGENSHORTCODE[0-9]+EGEN`)
+)
+
+// Shortcode generates the HTML of a shortcode used in a post's content, e.g.
+// {{< youtube id="abc" >}}, given its arguments.
+type Shortcode func(args map[string]string) (template.HTML, error)
+
+// replaceShortcodes replaces each shortcode in markdown with a placeholder and executes it. Shortcodes
+// are replaced by placeholders before the markdown is rendered, so that their output isn't processed
+// as markdown, and the placeholders are replaced by the shortcodes' output after it's rendered through
+// expandShortcodes. Shortcodes in code spans and fenced code blocks are kept as is, so that they can
+// be documented in posts.
+func (p *Post) replaceShortcodes(shortcodes map[string]Shortcode, l *Lang, markdown []byte) ([]byte, map[string]template.HTML, error) {
+	var (
+		res          []byte
+		last         int
+		placeholders = make(map[string]template.HTML)
+		codeRanges   = markdownCodeRanges(markdown)
+	)
+
+	for _, loc := range shortcodeRegExp.FindAllSubmatchIndex(markdown, -1) {
+		if inRanges(codeRanges, loc[0]) {
+			continue
+		}
+
+		name := string(markdown[loc[2]:loc[3]])
+
+		shortcode, ok := shortcodes[name]
+		if !ok {
+			return nil, nil, fmt.Errorf("unknown %v shortcode in %v post (%v)", name, p.Slug, l.Tag)
+		}
+
+		args := make(map[string]string)
+		for _, argMatch := range shortcodeArgsRegExp.FindAllSubmatch(markdown[loc[4]:loc[5]], -1) {
+			args[string(argMatch[1])] = string(argMatch[2])
+		}
+
+		html, err := shortcode(args)
+		if err != nil {
+			return nil, nil, fmt.Errorf("executing %v shortcode in %v post (%v): %w", name, p.Slug, l.Tag, err)
+		}
+
+		placeholder := fmt.Sprintf("EGENSHORTCODE%vEGEN", len(placeholders))
+		placeholders[placeholder] = html
+
+		res = append(res, markdown[last:loc[0]]...)
+		res = append(res, placeholder...)
+		last = loc[1]
+	}
+
+	return append(res, markdown[last:]...), placeholders, nil
+}
+
+// markdownFenceRegExp matches the opening line of a fenced code block.
+var markdownFenceRegExp = regexp.MustCompile("^ {0,3}(`{3,}|~{3,})")
+
+// markdownCodeRanges returns the ranges, as [start, end) offsets, of the fenced code blocks and
+// of the code spans in markdown, in order. A fenced code block that isn't closed ends with
+// markdown, while a backtick string without a matching one doesn't start a code span.
+func markdownCodeRanges(markdown []byte) [][2]int {
+	var (
+		ranges    [][2]int
+		fence     []byte
+		lineStart int
+		textStart int
+	)
+
+	for lineStart < len(markdown) {
+		lineEnd := len(markdown)
+		if i := bytes.IndexByte(markdown[lineStart:], '\n'); i != -1 {
+			lineEnd = lineStart + i + 1
+		}
+
+		line := markdown[lineStart:lineEnd]
+
+		if fence == nil {
+			if m := markdownFenceRegExp.FindSubmatch(line); m != nil && !(m[1][0] == '`' && bytes.ContainsRune(line[len(m[0]):], '`')) {
+				ranges = append(ranges, markdownCodeSpanRanges(markdown[:lineStart], textStart)...)
+				fence = m[1]
+				ranges = append(ranges, [2]int{lineStart, len(markdown)})
+			}
+		} else {
+			trimmed := bytes.TrimSpace(line)
+			if len(trimmed) >= len(fence) && len(bytes.Trim(trimmed, string(fence[:1]))) == 0 && len(line)-len(bytes.TrimLeft(line, " ")) <= 3 {
+				fence = nil
+				ranges[len(ranges)-1][1] = lineEnd
+				textStart = lineEnd
+			}
+		}
+
+		lineStart = lineEnd
+	}
+
+	if fence == nil {
+		ranges = append(ranges, markdownCodeSpanRanges(markdown, textStart)...)
+	}
+
+	return ranges
+}
+
+// markdownCodeSpanRanges returns the ranges of the code spans in markdown[start:], whose
+// offsets are relative to markdown. A code span starts with a backtick string and ends with
+// the next backtick string of the same length.
+func markdownCodeSpanRanges(markdown []byte, start int) [][2]int {
+	var ranges [][2]int
+
+	for i := start; i < len(markdown); {
+		if markdown[i] != '`' {
+			i++
+
+			continue
+		}
+
+		n := backtickStringLen(markdown[i:])
+
+		end := -1
+		for j := i + n; j < len(markdown); {
+			if markdown[j] != '`' {
+				j++
+
+				continue
+			}
+
+			m := backtickStringLen(markdown[j:])
+			if m == n {
+				end = j + m
+
+				break
+			}
+
+			j += m
+		}
+
+		if end == -1 {
+			i += n
+
+			continue
+		}
+
+		ranges = append(ranges, [2]int{i, end})
+		i = end
+	}
+
+	return ranges
+}
+
+// backtickStringLen returns the number of backticks at the start of b.
+func backtickStringLen(b []byte) int {
+	n := 0
+	for n < len(b) && b[n] == '`' {
+		n++
+	}
+
+	return n
+}
+
+// inRanges reports whether i is in one of ranges.
+func inRanges(ranges [][2]int, i int) bool {
+	for _, r := range ranges {
+		if i >= r[0] && i < r[1] {
+			return true
+		}
+	}
+
+	return false
+}
+
+// expandShortcodes replaces each placeholder in content with the output of its shortcode. If a
+// placeholder is the only content of a paragraph, the whole paragraph is replaced.
+func expandShortcodes(content []byte, placeholders map[string]template.HTML) []byte {
+	for placeholder, html := range placeholders {
+		content = bytes.ReplaceAll(content, []byte("<p>"+placeholder+"</p>"), []byte(html))
+		content = bytes.ReplaceAll(content, []byte(placeholder), []byte(html))
+	}
+
+	return content
+}
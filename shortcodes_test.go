@@ -0,0 +1,115 @@
+package egen
+
+import (
+	"errors"
+	"fmt"
+	"html/template"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestGenerateContent_shortcodes(t *testing.T) {
+	p, input := newTestPost(t)
+	input.bc.Shortcodes = map[string]Shortcode{
+		"youtube": func(args map[string]string) (template.HTML, error) {
+			return template.HTML(fmt.Sprintf(`<iframe src="https://www.youtube.com/embed/%v"></iframe>`, args["id"])), nil
+		},
+		"kbd": func(args map[string]string) (template.HTML, error) {
+			return template.HTML(fmt.Sprintf(`<kbd>%v</kbd>`, template.HTMLEscapeString(args["key"]))), nil
+		},
+	}
+
+	md := "Intro.\n\n{{< youtube id=\"abc\" >}}\n\nPress {{< kbd key=\"*\" >}} now."
+
+	err := p.generateContent(input, &Lang{Tag: "en"}, []byte(md))
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	expected := "<p>Intro.</p>\n\n" +
+		`<iframe src="https://www.youtube.com/embed/abc"></iframe>` +
+		"\n\n<p>Press <kbd>*</kbd> now.</p>\n"
+
+	if string(p.Content) != expected {
+		t.Errorf("got %q, want %q", p.Content, expected)
+	}
+}
+
+func TestGenerateContent_shortcodesErr(t *testing.T) {
+	someErr := errors.New("some")
+
+	p, input := newTestPost(t)
+	input.bc.Shortcodes = map[string]Shortcode{
+		"failing": func(args map[string]string) (template.HTML, error) {
+			return "", someErr
+		},
+	}
+
+	err := p.generateContent(input, &Lang{Tag: "en"}, []byte(`{{< unknown id="abc" >}}`))
+	if err == nil || !strings.Contains(err.Error(), "unknown") || !strings.Contains(err.Error(), p.Slug) {
+		t.Errorf("got %v, want an error about an unknown shortcode in %v post", err, p.Slug)
+	}
+
+	err = p.generateContent(input, &Lang{Tag: "en"}, []byte(`{{< failing >}}`))
+	if !errors.Is(err, someErr) {
+		t.Errorf("got %v, want %v", err, someErr)
+	}
+}
+
+func TestGenerateContent_shortcodesInCode(t *testing.T) {
+	p, input := newTestPost(t)
+	input.bc.Shortcodes = map[string]Shortcode{
+		"kbd": func(args map[string]string) (template.HTML, error) {
+			return template.HTML(fmt.Sprintf(`<kbd>%v</kbd>`, template.HTMLEscapeString(args["key"]))), nil
+		},
+	}
+
+	md := "Use `{{< kbd key=\"a\" >}}` or ``{{< kbd key=\"b\" >}}`` for {{< kbd key=\"c\" >}}.\n\n" +
+		"```\n{{< kbd key=\"d\" >}}\n```\n\n" +
+		"~~~~go\n{{< kbd key=\"e\" >}}\n~~~\n~~~~\n\n" +
+		"A ` backtick and {{< kbd key=\"f\" >}}.\n"
+
+	err := p.generateContent(input, &Lang{Tag: "en"}, []byte(md))
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	for _, key := range []string{"a", "b", "d", "e"} {
+		if strings.Contains(string(p.Content), "<kbd>"+key+"</kbd>") {
+			t.Errorf("got %v shortcode expanded in code in %q", key, p.Content)
+		}
+	}
+
+	for _, key := range []string{"c", "f"} {
+		if !strings.Contains(string(p.Content), "<kbd>"+key+"</kbd>") {
+			t.Errorf("got %v shortcode not expanded in %q", key, p.Content)
+		}
+	}
+}
+
+func TestMarkdownCodeRanges(t *testing.T) {
+	tests := []struct {
+		md       string
+		expected [][2]int
+	}{
+		{"no code", nil},
+		{"a `b` c", [][2]int{{2, 5}}},
+		{"a ``b ` c`` d", [][2]int{{2, 11}}},
+		{"a ` b", nil},
+		{"a\n```\nb\n```\nc `d`", [][2]int{{2, 12}, {14, 17}}},
+		{"```\nb\n````\nc", [][2]int{{0, 11}}},
+		{"```\nb\n``\n", [][2]int{{0, 9}}},
+		{"``` `a` b\n", [][2]int{{4, 7}}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.md, func(t *testing.T) {
+			ranges := markdownCodeRanges([]byte(test.md))
+
+			if !reflect.DeepEqual(ranges, test.expected) {
+				t.Errorf("got %v, want %v", ranges, test.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,265 @@
+package egen
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/nfnt/resize"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/gofont/gobold"
+	"golang.org/x/image/font/gofont/goregular"
+	"golang.org/x/image/font/opentype"
+	"golang.org/x/image/math/fixed"
+)
+
+// Dimensions of social cards, which are the ones recommended for Open Graph imgs.
+const (
+	socialCardWidth  = 1200
+	socialCardHeight = 630
+)
+
+const (
+	socialCardMargin        = 80
+	socialCardTitleSize     = 64
+	socialCardSiteNameSize  = 32
+	socialCardMaxTitleLines = 4
+)
+
+var defaultSocialCardColor = color.RGBA{0x22, 0x22, 0x22, 0xff}
+
+// socialCardNamePrefix is the prefix of the name of the social card nodes added to PATs.
+const socialCardNamePrefix = "egen-social-card-"
+
+// socialCardGenerator generates the social cards of posts, which are imgs with the post's
+// title and the site's name drawn over a background img or color.
+type socialCardGenerator struct {
+	siteName      string
+	bg            image.Image
+	bgColor       color.Color
+	textColor     color.Color
+	titleFace     font.Face
+	siteNameFace  font.Face
+	titleLineSize int
+}
+
+// newSocialCardGenerator creates a socialCardGenerator from the social card fields in c.
+// bgImgPath is the path of the background img, which can be empty.
+func newSocialCardGenerator(c *config, bgImgPath string) (*socialCardGenerator, error) {
+	g := socialCardGenerator{
+		siteName:      c.Title,
+		bgColor:       defaultSocialCardColor,
+		titleLineSize: socialCardTitleSize * 6 / 5,
+	}
+
+	switch {
+	case c.SocialCardColor != "":
+		bgColor, err := parseHexColor(c.SocialCardColor)
+		if err != nil {
+			return nil, fmt.Errorf("parsing socialCardColor: %v", err)
+		}
+
+		g.bgColor = bgColor
+	case c.Color != "":
+		// Color isn't required to be a hex color, so the default one is kept if it's not.
+		if bgColor, err := parseHexColor(c.Color); err == nil {
+			g.bgColor = bgColor
+		}
+	}
+
+	if bgImgPath != "" {
+		file, err := os.Open(bgImgPath)
+		if err != nil {
+			return nil, err
+		}
+		defer file.Close()
+
+		bg, _, err := image.Decode(file)
+		if err != nil {
+			return nil, fmt.Errorf("decoding %v: %v", bgImgPath, err)
+		}
+
+		g.bg = coverImg(bg, socialCardWidth, socialCardHeight)
+	}
+
+	// text is drawn in white over background imgs, since they're darkened.
+	g.textColor = color.White
+	if g.bg == nil && luminance(g.bgColor) > 0.5 {
+		g.textColor = color.Black
+	}
+
+	var err error
+
+	g.titleFace, err = newFontFace(gobold.TTF, socialCardTitleSize)
+	if err != nil {
+		return nil, err
+	}
+
+	g.siteNameFace, err = newFontFace(goregular.TTF, socialCardSiteNameSize)
+	if err != nil {
+		return nil, err
+	}
+
+	return &g, nil
+}
+
+// generate returns a PNG social card with title.
+func (g *socialCardGenerator) generate(title string) ([]byte, error) {
+	img := image.NewRGBA(image.Rect(0, 0, socialCardWidth, socialCardHeight))
+
+	if g.bg != nil {
+		draw.Draw(img, img.Bounds(), g.bg, image.Point{}, draw.Src)
+
+		overlay := image.NewUniform(color.NRGBA{0, 0, 0, 0x99})
+		draw.Draw(img, img.Bounds(), overlay, image.Point{}, draw.Over)
+	} else {
+		draw.Draw(img, img.Bounds(), image.NewUniform(g.bgColor), image.Point{}, draw.Src)
+	}
+
+	d := font.Drawer{
+		Dst: img,
+		Src: image.NewUniform(g.textColor),
+	}
+
+	maxWidth := fixed.I(socialCardWidth - 2*socialCardMargin)
+
+	d.Face = g.titleFace
+	y := socialCardMargin + g.titleFace.Metrics().Ascent.Ceil()
+
+	for _, line := range wrapText(g.titleFace, title, maxWidth, socialCardMaxTitleLines) {
+		d.Dot = fixed.P(socialCardMargin, y)
+		d.DrawString(line)
+		y += g.titleLineSize
+	}
+
+	d.Face = g.siteNameFace
+	d.Dot = fixed.P(socialCardMargin, socialCardHeight-socialCardMargin)
+	d.DrawString(g.siteName)
+
+	var buff bytes.Buffer
+
+	if err := png.Encode(&buff, img); err != nil {
+		return nil, fmt.Errorf("encoding social card: %v", err)
+	}
+
+	return buff.Bytes(), nil
+}
+
+// wrapText splits s into lines that fit in maxWidth when drawn with face. If there are
+// more than maxLines lines, the last one ends with an ellipsis.
+func wrapText(face font.Face, s string, maxWidth fixed.Int26_6, maxLines int) []string {
+	var lines []string
+	var line string
+
+	for _, word := range strings.Fields(s) {
+		candidate := word
+		if line != "" {
+			candidate = line + " " + word
+		}
+
+		if line == "" || font.MeasureString(face, candidate) <= maxWidth {
+			line = candidate
+			continue
+		}
+
+		lines = append(lines, line)
+		line = word
+	}
+
+	if line != "" {
+		lines = append(lines, line)
+	}
+
+	if len(lines) <= maxLines {
+		return lines
+	}
+
+	lines = lines[:maxLines]
+	last := lines[maxLines-1]
+
+	for last != "" && font.MeasureString(face, last+"…") > maxWidth {
+		i := strings.LastIndex(last, " ")
+		if i == -1 {
+			break
+		}
+
+		last = last[:i]
+	}
+
+	lines[maxLines-1] = last + "…"
+
+	return lines
+}
+
+func newFontFace(ttf []byte, size float64) (font.Face, error) {
+	f, err := opentype.Parse(ttf)
+	if err != nil {
+		return nil, fmt.Errorf("parsing font: %v", err)
+	}
+
+	return opentype.NewFace(f, &opentype.FaceOptions{
+		Size:    size,
+		DPI:     72,
+		Hinting: font.HintingFull,
+	})
+}
+
+// coverImg scales img so that it covers a width x height area and crops it around its center.
+func coverImg(img image.Image, width, height int) image.Image {
+	bounds := img.Bounds()
+
+	// the img is scaled by its width if its aspect ratio is taller than the area's.
+	var scaled image.Image
+	if bounds.Dx()*height < bounds.Dy()*width {
+		scaled = resize.Resize(uint(width), 0, img, resize.Bilinear)
+	} else {
+		scaled = resize.Resize(0, uint(height), img, resize.Bilinear)
+	}
+
+	scaledBounds := scaled.Bounds()
+	offset := image.Pt(
+		scaledBounds.Min.X+(scaledBounds.Dx()-width)/2,
+		scaledBounds.Min.Y+(scaledBounds.Dy()-height)/2,
+	)
+
+	cropped := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(cropped, cropped.Bounds(), scaled, offset, draw.Src)
+
+	return cropped
+}
+
+// parseHexColor parses colors in the #rgb and #rrggbb formats.
+func parseHexColor(s string) (color.Color, error) {
+	hex := strings.TrimPrefix(s, "#")
+	if hex == s {
+		return nil, fmt.Errorf("%v isn't a hex color", s)
+	}
+
+	if len(hex) == 3 {
+		hex = string([]byte{hex[0], hex[0], hex[1], hex[1], hex[2], hex[2]})
+	}
+
+	if len(hex) != 6 {
+		return nil, fmt.Errorf("%v isn't a hex color", s)
+	}
+
+	v, err := strconv.ParseUint(hex, 16, 32)
+	if err != nil {
+		return nil, fmt.Errorf("%v isn't a hex color", s)
+	}
+
+	return color.RGBA{uint8(v >> 16), uint8(v >> 8), uint8(v), 0xff}, nil
+}
+
+// luminance returns the relative luminance of c, from 0 to 1.
+func luminance(c color.Color) float64 {
+	r, g, b, _ := c.RGBA()
+
+	return (0.2126*float64(r) + 0.7152*float64(g) + 0.0722*float64(b)) / 0xffff
+}
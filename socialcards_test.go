@@ -0,0 +1,130 @@
+package egen
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"reflect"
+	"strings"
+	"testing"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/gofont/goregular"
+)
+
+func TestSocialCardGenerator_generate(t *testing.T) {
+	c := &config{configFileData: configFileData{Title: "The thing", SocialCardColor: "#ffffff"}}
+
+	g, err := newSocialCardGenerator(c, "")
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	if g.textColor != color.Black {
+		t.Errorf("got %v text color, want black", g.textColor)
+	}
+
+	card, err := g.generate(strings.Repeat("A long title ", 20))
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	img, err := png.Decode(bytes.NewReader(card))
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	if !img.Bounds().Eq(image.Rect(0, 0, socialCardWidth, socialCardHeight)) {
+		t.Errorf("got %v bounds, want %vx%v", img.Bounds(), socialCardWidth, socialCardHeight)
+	}
+
+	if r, g, b, _ := img.At(0, 0).RGBA(); r != 0xffff || g != 0xffff || b != 0xffff {
+		t.Errorf("got (%v, %v, %v) background at (0, 0), want white", r, g, b)
+	}
+}
+
+func TestWrapText(t *testing.T) {
+	face, err := newFontFace(goregular.TTF, 10)
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	maxWidth := font.MeasureString(face, "foo bar…")
+
+	tests := []struct {
+		s        string
+		maxLines int
+		lines    []string
+	}{
+		{"", 2, nil},
+		{"foo", 2, []string{"foo"}},
+		{"foo bar foo bar", 2, []string{"foo bar", "foo bar"}},
+		{"foo bar foo bar foo bar", 2, []string{"foo bar", "foo bar…"}},
+		{"foo bar foo bar foo", 2, []string{"foo bar", "foo bar…"}},
+		// words longer than maxWidth get a line of their own.
+		{"foobarfoobar foo", 2, []string{"foobarfoobar", "foo"}},
+	}
+
+	for _, test := range tests {
+		lines := wrapText(face, test.s, maxWidth, test.maxLines)
+
+		if !reflect.DeepEqual(lines, test.lines) {
+			t.Errorf("%q: got %q, want %q", test.s, lines, test.lines)
+		}
+	}
+}
+
+func TestParseHexColor(t *testing.T) {
+	tests := []struct {
+		s     string
+		c     color.Color
+		valid bool
+	}{
+		{"#ff8000", color.RGBA{0xff, 0x80, 0x00, 0xff}, true},
+		{"#f80", color.RGBA{0xff, 0x88, 0x00, 0xff}, true},
+		{"ff8000", nil, false},
+		{"#ff80", nil, false},
+		{"#gg8000", nil, false},
+	}
+
+	for _, test := range tests {
+		c, err := parseHexColor(test.s)
+		if (err == nil) != test.valid {
+			t.Errorf("%v: got %v err, want valid=%v", test.s, err, test.valid)
+			continue
+		}
+
+		if test.valid && c != test.c {
+			t.Errorf("%v: got %v, want %v", test.s, c, test.c)
+		}
+	}
+}
+
+func TestCoverImg(t *testing.T) {
+	// the left and right thirds of img are red and its middle third is blue, so only
+	// the blue part is left when it's cropped to a square.
+	img := image.NewRGBA(image.Rect(0, 0, 30, 10))
+	for x := 0; x < 30; x++ {
+		for y := 0; y < 10; y++ {
+			c := color.RGBA{0xff, 0, 0, 0xff}
+			if x >= 10 && x < 20 {
+				c = color.RGBA{0, 0, 0xff, 0xff}
+			}
+
+			img.Set(x, y, c)
+		}
+	}
+
+	covered := coverImg(img, 20, 20)
+
+	if !covered.Bounds().Eq(image.Rect(0, 0, 20, 20)) {
+		t.Fatalf("got %v bounds, want 20x20", covered.Bounds())
+	}
+
+	for _, p := range []image.Point{{2, 2}, {10, 10}, {17, 17}} {
+		if r, _, b, _ := covered.At(p.X, p.Y).RGBA(); r != 0 || b != 0xffff {
+			t.Errorf("got (%v, %v) red and blue at %v, want blue", r, b, p)
+		}
+	}
+}
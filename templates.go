@@ -5,6 +5,7 @@ import (
 	"errors"
 	"fmt"
 	"html/template"
+	"io"
 	"io/fs"
 	"os"
 	"path"
@@ -24,6 +25,10 @@ var indexHTML = `
 <head>
 	<meta charset="utf-8">
 	<meta name="viewport" content="width=device-width, initial-scale=1.0">
+	{{ range preconnectOrigins }}
+		<link rel="preconnect" href="{{ . }}">
+		<link rel="dns-prefetch" href="{{ . }}">
+	{{ end }}
 	{{ if .Color }}
 		<meta name="theme-color" content="{{ .Color }}">
 	{{ end }}
@@ -41,9 +46,14 @@ var indexHTML = `
 	{{ if .Description }}
 		<meta property="og:description" content="{{ .Description }}">
 	{{ end }}
-	{{ if .Img }}
-		<meta property="og:image:url" content="{{ relToAbsLink (assetLink .Img.Path) }}">
-		<meta property="og:image:alt" content="{{ .Img.Alt }}">
+	{{ if .OGImage }}
+		<meta property="og:image:url" content="{{ relToAbsLink (assetLink .OGImage.Path) }}">
+		<meta property="og:image:alt" content="{{ .OGImage.Alt }}">
+	{{ end }}
+	{{ with .Post }}
+		{{ if .NoIndex }}
+			<meta name="robots" content="noindex">
+		{{ end }}
 	{{ end }}
 	{{ if eq .Page "post" }}
 		<meta property="article:published_time" content="{{ dateISO .Post.Date }}">
@@ -51,8 +61,8 @@ var indexHTML = `
 			<meta property="article:modified_time" content="{{ dateISO .Post.LastUpdateDate }}">
 		{{ end }}
 	{{ end }}
-	{{ if .Img }}
-		<meta property="twitter:image:alt" content="{{ .Img.Alt }}">
+	{{ if .OGImage }}
+		<meta property="twitter:image:alt" content="{{ .OGImage.Alt }}">
 	{{ end }}
 	{{ if .Author.Twitter }}
 		<meta property="twitter:site" content="@{{ .Author.Twitter }}">
@@ -67,6 +77,9 @@ var indexHTML = `
 	{{ range .AlternateLinks -}}
   	<link rel="alternate" hreflang="{{ .Lang.Tag }}" href="{{ relToAbsLink .URL }}">
 	{{- end }}
+	{{- with .AlternateLinks }}{{ with index . 0 }}{{ if .Lang.Default -}}
+  	<link rel="alternate" hreflang="x-default" href="{{ relToAbsLink .URL }}">
+	{{- end }}{{ end }}{{ end }}
 	{{ if hasAsset "/style.css" }}
 		<link rel="stylesheet" href="{{ assetLink "/style.css" }}">
 	{{ end }}
@@ -103,67 +116,83 @@ type TemplateData struct {
 	Description string
 	Author      *Author
 	Img         *Img
-	Color       string
-	// Posts is a list of posts that are visible (feed: true)
+	// OGImage is the img used in Open Graph meta tags. It defaults to Img.
+	OGImage *Img
+	Color   string
+	// Posts is a list of posts that are visible (listed: true)
 	Posts []*Post
+	// FeedPosts is a list of posts that are present in the feed (feed: true)
+	FeedPosts []*Post
 	// Post is equal to nil unless page == 'post'
 	Post *Post
 	Lang *Lang
+	// Langs is the list of all languages provided in the config file.
+	Langs []*Lang
+	// Section is the section of Post or, if page == 'posts', the section listed by the page.
+	// It's equal to nil unless page == 'post', page == 'reader' or page == 'posts'
+	Section *Section
 	// URL is a relative URL.
 	URL string
 	// AlternateLinks is a list of alternate links to be used in meta tags.
 	// It also includes the a link for the current page in the current language.
 	AlternateLinks            []*AlternateLink
 	ResponsiveImgMediaQueries string
+	// Data is the content of the files in <inPath>/data keyed by their names without extensions.
+	Data map[string]interface{}
+	// Archive is equal to nil unless page == 'archive'
+	Archive []YearGroup
+	// Env is the environment the blog is built for, as set in BuildConfig.Env.
+	Env string
+}
+
+// YearGroup is a group of posts published in the same year.
+type YearGroup struct {
+	Year   int
+	Months []MonthGroup
+}
+
+// MonthGroup is a group of posts published in the same month of a year.
+type MonthGroup struct {
+	Month time.Month
+	Posts []*Post
 }
 
+// createBaseTemplateWithIncludes creates the base template and parses the includes in
+// includesInPath into it. The funcs returned by generateBuildTemplateFuncs can't be called
+// until they're set through Funcs, since they refer to what's generated by a build.
 func createBaseTemplateWithIncludes(
 	templateFuncs template.FuncMap,
 	includesInPath string,
-	invisiblePostsByLangTag map[string][]*Post,
-	gat *assetsTreeNode,
 	url string,
-	responsiveImgSizes []int,
+	style urlStyle,
+	preconnectOrigins []string,
+	now func() time.Time,
+	env string,
 ) (*template.Template, error) {
+	if now == nil {
+		now = time.Now
+	}
+
 	// funcs
 	defaultTemplateFuncs := template.FuncMap{
 		"dateISO": func(d time.Time) string {
 			return d.Format(time.RFC3339)
 		},
-		"getInvisiblePost": func(l *Lang, slug string) *Post {
-			if posts := invisiblePostsByLangTag[l.Tag]; posts != nil {
-				for _, p := range posts {
-					if p.Slug == slug {
-						return p
-					}
-				}
-			}
-
-			return nil
-		},
-		"assetLink":   generateAssetsLinkFn(gat, nil, ""),
-		"srcSetValue": generateSrcSetValueFn(gat, nil, "", responsiveImgSizes),
-		"hasAsset":    generateHasAsset(gat, nil, ""),
-		"postLinkBySlugAndLang": func(slug string, l *Lang) string {
-			if l.Default {
-				return fmt.Sprintf("/posts/%v", slug)
-			}
-
-			return fmt.Sprintf("/%v/posts/%v", l.Tag, slug)
+		"now": now,
+		"currentYear": func() int {
+			return now().Year()
 		},
 		"homeLinkByLang": func(l *Lang) string {
-			if l.Default {
-				return "/"
-			}
-
-			return fmt.Sprintf("/%v", l.Tag)
+			return style.pageRelURL("", l)
 		},
 		"relToAbsLink": func(link string) string {
-			if link == "/" {
-				return url
-			}
-
-			return url + link
+			return relToAbsLink(url, link)
+		},
+		"relURL": func(p string, l *Lang) string {
+			return style.pageRelURL(p, l)
+		},
+		"absURL": func(p string, l *Lang) string {
+			return relToAbsLink(url, style.pageRelURL(p, l))
 		},
 		"sortPostsByDateDesc": func(posts []*Post) []*Post {
 			sorted := make([]*Post, len(posts))
@@ -175,6 +204,26 @@ func createBaseTemplateWithIncludes(
 
 			return sorted
 		},
+		"sortPostsByWeightAndDateDesc": sortPostsByWeightAndDateDesc,
+		"preconnectOrigins": func() []string {
+			return preconnectOrigins
+		},
+		"plainify": func(v any) (string, error) {
+			s, err := templateText(v)
+			if err != nil {
+				return "", err
+			}
+
+			return plainify(s), nil
+		},
+		"truncate": truncate,
+		"isProd": func() bool {
+			return env == productionEnv
+		},
+	}
+
+	for name, fn := range generateBuildTemplateFuncs(nil, nil, nil, nil, style) {
+		defaultTemplateFuncs[name] = fn
 	}
 
 	baseTemplate := template.Must(
@@ -187,6 +236,8 @@ func createBaseTemplateWithIncludes(
 		return nil, err
 	}
 
+	var includesErrs []error
+
 	for _, includesFileInfo := range includesFileInfos {
 		if includesFileInfo.IsDir() || !htmlFilenameRegExp.MatchString(includesFileInfo.Name()) {
 			continue
@@ -197,18 +248,34 @@ func createBaseTemplateWithIncludes(
 			return nil, err
 		}
 
-		baseTemplate, err = baseTemplate.Parse(
-			fmt.Sprintf(
-				`{{ define "%v" }}%v{{ end }}`,
-				strings.TrimRight(includesFileInfo.Name(), ".html"),
-				string(includeFileContent),
-			),
+		includeTemplateContent := fmt.Sprintf(
+			`{{ define "%v" }}%v{{ end }}`,
+			strings.TrimSuffix(includesFileInfo.Name(), ".html"),
+			string(includeFileContent),
 		)
+
+		// each include is parsed on its own first so that errors, such as references to
+		// undefined funcs, are reported for every include along with its filename.
+		_, err = template.New(includesFileInfo.Name()).
+			Funcs(templateFuncs).
+			Funcs(defaultTemplateFuncs).
+			Parse(includeTemplateContent)
+		if err != nil {
+			includesErrs = append(includesErrs, fmt.Errorf("parsing include %v: %w", includesFileInfo.Name(), err))
+
+			continue
+		}
+
+		baseTemplate, err = baseTemplate.Parse(includeTemplateContent)
 		if err != nil {
 			return nil, err
 		}
 	}
 
+	if len(includesErrs) > 0 {
+		return nil, errors.Join(includesErrs...)
+	}
+
 	// creates a head template if one wasn't present in includes
 	if t := baseTemplate.Lookup("head"); t == nil {
 		baseTemplate = template.Must(baseTemplate.Parse(`{{ define "head" }}{{ end }}`))
@@ -217,6 +284,92 @@ func createBaseTemplateWithIncludes(
 	return baseTemplate, nil
 }
 
+// generateBuildTemplateFuncs returns the funcs available in every template that refer to
+// what's generated by a build, i.e. the posts lists and the GAT.
+func generateBuildTemplateFuncs(
+	postsLists *generatePostsListsOutput,
+	gat *assetsTreeNode,
+	responsiveImgSizes []int,
+	pc *assetsProcessingConfig,
+	style urlStyle,
+) template.FuncMap {
+	return template.FuncMap{
+		// the link is generated from the section of the post, so the post must exist,
+		// although not necessarily in l.
+		"postLinkBySlugAndLang": func(slug string, l *Lang) (string, error) {
+			p := postsLists.findPostBySlug(slug)
+			if p == nil {
+				return "", fmt.Errorf("%v post not found", slug)
+			}
+
+			return style.pageRelURL(path.Join(p.Section.URLPrefix, p.Slug), l), nil
+		},
+		"allPosts": func(l *Lang) []*Post {
+			return sortPostsByWeightAndDateDesc(postsLists.allPostsByLangTag[l.Tag])
+		},
+		"sectionPosts": func(l *Lang, name string) []*Post {
+			var posts []*Post
+
+			for _, p := range postsLists.visiblePostsByLangTag[l.Tag] {
+				if p.Section != nil && p.Section.Name == name {
+					posts = append(posts, p)
+				}
+			}
+
+			return posts
+		},
+		"getInvisiblePost": func(l *Lang, slug string) *Post {
+			if posts := postsLists.invisiblePostsByLangTag[l.Tag]; posts != nil {
+				for _, p := range posts {
+					if p.Slug == slug {
+						return p
+					}
+				}
+			}
+
+			return nil
+		},
+		"assetLink":     generateAssetsLinkFn(gat, nil, ""),
+		"srcSetValue":   generateSrcSetValueFn(gat, nil, "", responsiveImgSizes, pc),
+		"hasAsset":      generateHasAsset(gat, nil, ""),
+		"mediaLink":     generateMediaLinkFn(gat, nil, ""),
+		"assetLocation": generateAssetLocation(gat, nil),
+		"imageColor":    generateImageColorFn(gat, nil),
+		"assetOriginal": generateAssetOriginalFn(gat, nil, ""),
+		"inlineAsset":   generateInlineAssetFn(gat, nil),
+		"assetSize":     generateAssetSizeFn(gat, nil),
+		"inlineCSS":     generateInlineCSSFn(gat),
+		"preloadCSS":    generatePreloadCSSFn(gat),
+		"postAssetLink": func(slug string, assetPath AssetRelPath) (string, error) {
+			p := postsLists.findPostBySlug(slug)
+			if p == nil {
+				return "", fmt.Errorf("%v post not found", slug)
+			}
+
+			return generateAssetsLinkFn(gat, p.pat, p.Slug)(assetPath)
+		},
+		"postSrcSetValue": func(slug string, assetPath AssetRelPath) (string, error) {
+			p := postsLists.findPostBySlug(slug)
+			if p == nil {
+				return "", fmt.Errorf("%v post not found", slug)
+			}
+
+			return generateSrcSetValueFn(gat, p.pat, p.Slug, responsiveImgSizes, pc)(assetPath)
+		},
+	}
+}
+
+// createRequiredPageTemplate is the same as createPageTemplate, but returns a descriptive error
+// if the page's template doesn't exist.
+func createRequiredPageTemplate(pagesInPath string, baseTemplate *template.Template, pageName string) (*template.Template, error) {
+	t, err := createPageTemplate(pagesInPath, baseTemplate, pageName)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("required page template pages/%v.html not found", pageName)
+	}
+
+	return t, err
+}
+
 func createPageTemplate(pagesInPath string, baseTemplate *template.Template, pageName string) (*template.Template, error) {
 	pageContent, err := os.ReadFile(path.Join(
 		pagesInPath,
@@ -231,39 +384,210 @@ func createPageTemplate(pagesInPath string, baseTemplate *template.Template, pag
 	), nil
 }
 
-func executeMinifyAndWriteTemplate(t *template.Template, tData TemplateData, outFilePath string) error {
-	outFile, err := os.Create(outFilePath)
-	if err != nil {
-		return err
-	}
-	defer outFile.Close()
+// MinifyHTMLOptions are the options used when minifying the HTML of a page.
+type MinifyHTMLOptions struct {
+	KeepDocumentTags bool
+	KeepQuotes       bool
+	KeepEndTags      bool
+	KeepWhitespace   bool
+}
 
-	var buff bytes.Buffer
-	err = t.Execute(&buff, tData)
-	if err != nil {
-		return err
+// defaultMinifyHTMLOptions are the options used when none are provided.
+var defaultMinifyHTMLOptions = MinifyHTMLOptions{
+	KeepDocumentTags: true,
+	KeepQuotes:       true,
+	KeepEndTags:      true,
+	KeepWhitespace:   true,
+}
+
+func newHTMLMinifier(opts *MinifyHTMLOptions) *minify.M {
+	if opts == nil {
+		opts = &defaultMinifyHTMLOptions
 	}
 
 	m := minify.New()
 	m.Add("text/html", &html.Minifier{
-		KeepDocumentTags: true,
-		KeepQuotes:       true,
-		KeepEndTags:      true,
-		KeepWhitespace:   true,
+		KeepDocumentTags: opts.KeepDocumentTags,
+		KeepQuotes:       opts.KeepQuotes,
+		KeepEndTags:      opts.KeepEndTags,
+		KeepWhitespace:   opts.KeepWhitespace,
 	})
 
-	htmlMinified, err := m.Bytes("text/html", buff.Bytes())
-	if err != nil {
-		return err
+	return m
+}
+
+// executeMinifyAndWriteTemplate executes t and streams its minified output to outFilePath,
+// with perm as its permissions. If postProcess isn't nil, the minified output is passed to
+// it, along with the page and the lang of tData, and what it returns is written instead.
+func executeMinifyAndWriteTemplate(
+	t *template.Template,
+	tData TemplateData,
+	m *minify.M,
+	postProcess func(page string, lang *Lang, html []byte) ([]byte, error),
+	outFilePath string,
+	perm os.FileMode,
+) error {
+	if tData.OGImage == nil {
+		tData.OGImage = tData.Img
 	}
-	if _, err = outFile.Write(htmlMinified); err != nil {
+
+	return writeFileAtomic(outFilePath, perm, func(outFile io.Writer) error {
+		if postProcess == nil {
+			w := m.Writer("text/html", outFile)
+
+			if err := t.Execute(w, tData); err != nil {
+				return err
+			}
+
+			return w.Close()
+		}
+
+		var buff bytes.Buffer
+		w := m.Writer("text/html", &buff)
+
+		if err := t.Execute(w, tData); err != nil {
+			return err
+		}
+
+		if err := w.Close(); err != nil {
+			return err
+		}
+
+		processed, err := postProcess(tData.Page, tData.Lang, buff.Bytes())
+		if err != nil {
+			return fmt.Errorf("post-processing html: %w", err)
+		}
+
+		_, err = outFile.Write(processed)
+
 		return err
+	})
+}
+
+// langRelURL returns the relative URL of p in l. The URL is only prefixed with
+// the language tag if l isn't the default language.
+func langRelURL(p string, l *Lang) string {
+	if l.Default {
+		return path.Join("/", p)
+	}
+
+	return path.Join("/", l.Tag, p)
+}
+
+// urlStyle defines how the URLs and the files of pages are built.
+type urlStyle struct {
+	// uglyURLs is whether pages, except home pages, are <p>.html files rather than
+	// <p>/index.html ones, with their URLs ending with .html.
+	uglyURLs bool
+	// trailingSlash is whether the URLs of pages end with /. It has no effect on ugly URLs.
+	trailingSlash bool
+	// homeFile is the name of the file of home pages, which defaults to index.html. If it's
+	// another one, the URLs of home pages end with it.
+	homeFile string
+	// taggedDefaultHome is whether the home page of the default lang is placed at /<tag>,
+	// like the ones of other langs, rather than at /, which is taken by the root page.
+	taggedDefaultHome bool
+}
+
+// homeFilename returns the name of the file of home pages in style s.
+func (s urlStyle) homeFilename() string {
+	if s.homeFile == "" {
+		return defaultHomeFile
 	}
 
-	return nil
+	return s.homeFile
+}
+
+// pageKind is the kind of a page, which sets how its URL is built in a urlStyle.
+type pageKind int
+
+const (
+	// dirPageKind is the kind of the pages whose URLs are the ones of directories, e.g.
+	// /posts/foo, unless uglyURLs is set.
+	dirPageKind pageKind = iota
+	// homePageKind is the kind of home pages, whose URLs end with their files only if
+	// homeFile is set.
+	homePageKind
+	// filePageKind is the kind of the pages whose URLs are the ones of their files, e.g.
+	// /all.html, which are used as is.
+	filePageKind
+)
+
+// pageURL returns u, the URL of a page of kind, in style s.
+func (s urlStyle) pageURL(u string, kind pageKind) string {
+	switch {
+	case kind == filePageKind:
+		return u
+	case kind == homePageKind && s.homeFilename() != defaultHomeFile:
+		return path.Join(u, s.homeFile)
+	case kind == dirPageKind && s.uglyURLs:
+		return u + ".html"
+	default:
+		return urlWithTrailingSlash(u, s.trailingSlash)
+	}
 }
 
-func generateAlternateLinks(preLangSegments, postLangSegments []string, langs []*Lang) []*AlternateLink {
+// pageRelURL returns the relative URL of the page at p in l in style s. p is the path of a
+// home page if it's empty, or of a dirPageKind page otherwise.
+func (s urlStyle) pageRelURL(p string, l *Lang) string {
+	if strings.Trim(p, "/") != "" {
+		return s.pageURL(langRelURL(p, l), dirPageKind)
+	}
+
+	if l.Default && s.taggedDefaultHome {
+		return s.pageURL(path.Join("/", l.Tag), homePageKind)
+	}
+
+	return s.pageURL(langRelURL(p, l), homePageKind)
+}
+
+// homeFilePath returns the path of the file of the home page in l in style s, given
+// langOutPath, the path of the directory in which the pages in l are placed.
+func (s urlStyle) homeFilePath(langOutPath string, l *Lang) string {
+	if l.Default && s.taggedDefaultHome {
+		return path.Join(langOutPath, l.Tag, s.homeFilename())
+	}
+
+	return path.Join(langOutPath, s.homeFilename())
+}
+
+// pageFilePath returns the path of the file of the page at p in dirPath in style s.
+func (s urlStyle) pageFilePath(dirPath, p string) string {
+	if strings.Trim(p, "/") == "" {
+		return path.Join(dirPath, s.homeFilename())
+	}
+
+	if s.uglyURLs {
+		return path.Join(dirPath, p+".html")
+	}
+
+	return path.Join(dirPath, p, "index.html")
+}
+
+// urlWithTrailingSlash returns u ending with / if trailingSlash is true. u must be the URL
+// of a directory, e.g. /posts/v1.2, rather than of a file.
+func urlWithTrailingSlash(u string, trailingSlash bool) string {
+	if !trailingSlash || strings.HasSuffix(u, "/") {
+		return u
+	}
+
+	return u + "/"
+}
+
+// relToAbsLink returns the absolute version of link, which is relative to url.
+func relToAbsLink(url, link string) string {
+	if link == "/" {
+		return url
+	}
+
+	return url + link
+}
+
+// generateAlternateLinks returns the links of a page of kind in each one of langs, with the
+// default lang first, in style.
+func generateAlternateLinks(preLangSegments, postLangSegments []string, kind pageKind, langs []*Lang, style urlStyle) []*AlternateLink {
+	home := kind == homePageKind
+
 	links := make([]*AlternateLink, 0, len(langs))
 
 	for i, l := range langs {
@@ -275,12 +599,16 @@ func generateAlternateLinks(preLangSegments, postLangSegments []string, langs []
 			segments = append(segments, preLangSegments...)
 			segments = append(segments, postLangSegments...)
 
+			if home && style.taggedDefaultHome {
+				segments = append(segments, l.Tag)
+			}
+
 			// default lang is always the first
 			if i != 0 {
 				newLinks := make([]*AlternateLink, 0, len(langs))
 				newLinks = append(newLinks, &AlternateLink{
 					Lang: l,
-					URL:  path.Join(segments...),
+					URL:  style.pageURL(path.Join(segments...), kind),
 				})
 				links = append(newLinks, links...)
 
@@ -296,7 +624,7 @@ func generateAlternateLinks(preLangSegments, postLangSegments []string, langs []
 
 		links = append(links, &AlternateLink{
 			Lang: l,
-			URL:  path.Join(segments...),
+			URL:  style.pageURL(path.Join(segments...), kind),
 		})
 	}
 
@@ -305,9 +633,28 @@ func generateAlternateLinks(preLangSegments, postLangSegments []string, langs []
 
 /* dynamic template funcs */
 
+// generatePostAssetsFuncs returns the asset funcs bound to the PAT of p. They override the ones
+// bound only to the GAT when executing a template for p.
+func generatePostAssetsFuncs(gat *assetsTreeNode, p *Post, responsiveImgSizes []int, pc *assetsProcessingConfig) template.FuncMap {
+	return template.FuncMap{
+		"assetLink":     generateAssetsLinkFn(gat, p.pat, p.Slug),
+		"srcSetValue":   generateSrcSetValueFn(gat, p.pat, p.Slug, responsiveImgSizes, pc),
+		"hasAsset":      generateHasAsset(gat, p.pat, p.Slug),
+		"mediaLink":     generateMediaLinkFn(gat, p.pat, p.Slug),
+		"assetLocation": generateAssetLocation(gat, p.pat),
+		"imageColor":    generateImageColorFn(gat, p.pat),
+		"assetOriginal": generateAssetOriginalFn(gat, p.pat, p.Slug),
+		"inlineAsset":   generateInlineAssetFn(gat, p.pat),
+		"assetSize":     generateAssetSizeFn(gat, p.pat),
+	}
+}
+
 func generateAssetsLinkFn(gat, pat *assetsTreeNode, postSlug string) func(assetPath AssetRelPath) (string, error) {
 	return func(assetPath AssetRelPath) (string, error) {
 		if n, searchedInPAT := findByRelPathInGATOrPAT(gat, pat, assetPath); n != nil {
+			n.mu.Lock()
+			defer n.mu.Unlock()
+
 			if searchedInPAT {
 				return n.assetLink(postSlug, nil), nil
 			}
@@ -315,7 +662,192 @@ func generateAssetsLinkFn(gat, pat *assetsTreeNode, postSlug string) func(assetP
 			return n.assetLink("", nil), nil
 		}
 
-		return "", fmt.Errorf("%v not found in either GAT or PAT", assetPath)
+		return "", fmt.Errorf("%v not found in either GAT or PAT%v", assetPath, assetNotFoundHint(gat, pat, assetPath))
+	}
+}
+
+// generateAssetOriginalFn returns a func that returns the link of the original file of an
+// img, which is only placed among the files of its sizes if originalImages is set in the
+// config file.
+func generateAssetOriginalFn(gat, pat *assetsTreeNode, postSlug string) func(assetPath AssetRelPath) (string, error) {
+	return func(assetPath AssetRelPath) (string, error) {
+		n, searchedInPAT := findByRelPathInGATOrPAT(gat, pat, assetPath)
+		switch {
+		case n == nil:
+			return "", fmt.Errorf("%v not found in either GAT or PAT%v", assetPath, assetNotFoundHint(gat, pat, assetPath))
+		case n.t != IMGNODE:
+			return "", fmt.Errorf("%v is not an img", assetPath)
+		case !n.originalFile:
+			return "", fmt.Errorf("%v doesn't have an original file, since originalImages isn't set in config file", assetPath)
+		}
+
+		if searchedInPAT {
+			return n.originalAssetLink(postSlug), nil
+		}
+
+		return n.originalAssetLink(""), nil
+	}
+}
+
+func generateMediaLinkFn(gat, pat *assetsTreeNode, postSlug string) func(assetPath AssetRelPath) (string, error) {
+	assetLink := generateAssetsLinkFn(gat, pat, postSlug)
+
+	return func(assetPath AssetRelPath) (string, error) {
+		if mediaMIMEType(string(assetPath)) == "" {
+			return "", fmt.Errorf("%v is not a media asset", assetPath)
+		}
+
+		return assetLink(assetPath)
+	}
+}
+
+// generateImageColorFn returns a func that returns the average color of an img as a hex
+// string. An empty string is returned if the asset isn't an img, doesn't exist or if the
+// computation of img colors isn't enabled.
+func generateImageColorFn(gat, pat *assetsTreeNode) func(assetPath AssetRelPath) string {
+	return func(assetPath AssetRelPath) string {
+		n, _ := findByRelPathInGATOrPAT(gat, pat, assetPath)
+		if n == nil || n.t != IMGNODE {
+			return ""
+		}
+
+		n.mu.Lock()
+		defer n.mu.Unlock()
+
+		return n.avgColor
+	}
+}
+
+// generateAssetSizeFn returns a func that returns the size in bytes of the processed file
+// of an asset, i.e. the one linked by assetLink, which is the original size of imgs. An
+// error is returned if the asset doesn't exist.
+func generateAssetSizeFn(gat, pat *assetsTreeNode) func(assetPath AssetRelPath) (int64, error) {
+	return func(assetPath AssetRelPath) (int64, error) {
+		n, _ := findByRelPathInGATOrPAT(gat, pat, assetPath)
+		if n == nil {
+			return 0, fmt.Errorf("%v not found in either GAT or PAT%v", assetPath, assetNotFoundHint(gat, pat, assetPath))
+		}
+
+		var filePath string
+
+		switch n.t {
+		case IMGNODE:
+			n.mu.Lock()
+			filePath = n.generateSizeProcessedPath(false, n.findOriginalSize())
+			n.mu.Unlock()
+		case FILENODE:
+			filePath = n.processedPath
+		default:
+			return 0, fmt.Errorf("%v is not a file", assetPath)
+		}
+
+		fileInfo, err := os.Stat(filePath)
+		if err != nil {
+			return 0, fmt.Errorf("getting size of %v: %v", assetPath, err)
+		}
+
+		return fileInfo.Size(), nil
+	}
+}
+
+// generateInlineAssetFn returns a func that returns the content of a text-like asset, i.e.
+// one whose extension is in inlineAssetExts, so that it can be embedded in a page, e.g. an
+// svg sprite. The content of svg assets is returned as is, while the one of the others is
+// escaped.
+func generateInlineAssetFn(gat, pat *assetsTreeNode) func(assetPath AssetRelPath) (template.HTML, error) {
+	return func(assetPath AssetRelPath) (template.HTML, error) {
+		n, _ := findByRelPathInGATOrPAT(gat, pat, assetPath)
+		if n == nil {
+			return "", fmt.Errorf("%v not found in either GAT or PAT%v", assetPath, assetNotFoundHint(gat, pat, assetPath))
+		}
+
+		ext := strings.ToLower(path.Ext(n.name))
+		if n.t != FILENODE || !mapContains(inlineAssetExts, ext) {
+			return "", fmt.Errorf("%v is not a text-like asset that can be inlined", assetPath)
+		}
+
+		content, err := n.getContent()
+		if err != nil {
+			return "", fmt.Errorf("reading %v: %v", assetPath, err)
+		}
+
+		if ext == ".svg" {
+			return template.HTML(content), nil
+		}
+
+		return template.HTML(template.HTMLEscapeString(string(content))), nil
+	}
+}
+
+// generateInlineCSSFn returns a func that returns the minified content of a css asset in gat,
+// so that it can be placed in a style element, e.g. the critical css of a page. Since the
+// css files at the root of gat are bundled into /style.css, other ones must be in a
+// directory, e.g. /css/critical.css.
+func generateInlineCSSFn(gat *assetsTreeNode) func(assetPath AssetRelPath) (template.CSS, error) {
+	return func(assetPath AssetRelPath) (template.CSS, error) {
+		n, _ := findByRelPathInGATOrPAT(gat, nil, assetPath)
+		if n == nil {
+			return "", fmt.Errorf("%v not found in GAT", assetPath)
+		}
+
+		if n.t != FILENODE || !cssFilenameRegExp.MatchString(n.name) {
+			return "", fmt.Errorf("%v is not a css asset", assetPath)
+		}
+
+		content, err := n.getContent()
+		if err != nil {
+			return "", fmt.Errorf("reading %v: %v", assetPath, err)
+		}
+
+		minified, err := minifyAsset("css", content)
+		if err != nil {
+			return "", fmt.Errorf("minifying %v: %v", assetPath, err)
+		}
+
+		return template.CSS(minified), nil
+	}
+}
+
+// generatePreloadCSSFn returns a func that returns the markup that loads a css asset in gat
+// without blocking rendering, i.e. a preload link that turns into a stylesheet one once
+// it's loaded, along with a stylesheet link for when scripts are disabled.
+func generatePreloadCSSFn(gat *assetsTreeNode) func(assetPath AssetRelPath) (template.HTML, error) {
+	assetLink := generateAssetsLinkFn(gat, nil, "")
+
+	return func(assetPath AssetRelPath) (template.HTML, error) {
+		if !cssFilenameRegExp.MatchString(string(assetPath)) {
+			return "", fmt.Errorf("%v is not a css asset", assetPath)
+		}
+
+		link, err := assetLink(assetPath)
+		if err != nil {
+			return "", err
+		}
+
+		href := template.HTMLEscapeString(link)
+
+		return template.HTML(fmt.Sprintf(
+			`<link rel="preload" href="%v" as="style" onload="this.onload=null;this.rel='stylesheet'"><noscript><link rel="stylesheet" href="%v"></noscript>`,
+			href,
+			href,
+		)), nil
+	}
+}
+
+// generateAssetLocation returns a func that returns the tree in which an asset is, i.e.
+// "gat" or "pat", or an empty string if it's in neither of them.
+func generateAssetLocation(gat, pat *assetsTreeNode) func(assetPath AssetRelPath) string {
+	return func(assetPath AssetRelPath) string {
+		n, searchedInPAT := findByRelPathInGATOrPAT(gat, pat, assetPath)
+
+		switch {
+		case n == nil:
+			return ""
+		case searchedInPAT:
+			return "pat"
+		default:
+			return "gat"
+		}
 	}
 }
 
@@ -327,15 +859,21 @@ func generateHasAsset(gat, pat *assetsTreeNode, postSlug string) func(assetPath
 	}
 }
 
-func generateSrcSetValueFn(gat, pat *assetsTreeNode, postSlug string, widths []int) func(assetPath AssetRelPath) (string, error) {
+func generateSrcSetValueFn(gat, pat *assetsTreeNode, postSlug string, widths []int, pc *assetsProcessingConfig) func(assetPath AssetRelPath) (string, error) {
 	return func(assetPath AssetRelPath) (string, error) {
 		if n, searchedInPAT := findByRelPathInGATOrPAT(gat, pat, assetPath); n != nil {
-			n.addSizes(widths...)
-			err := n.processSizes()
+			n.mu.Lock()
+			n.addSizes(pc.responsiveWidths(widths)...)
+			n.mu.Unlock()
+
+			err := n.processSizes(pc)
 			if err != nil {
 				return "", fmt.Errorf("processing sizes: %w", err)
 			}
 
+			n.mu.Lock()
+			defer n.mu.Unlock()
+
 			if searchedInPAT {
 				return n.generateSrcSetValue(postSlug), nil
 			}
@@ -343,6 +881,6 @@ func generateSrcSetValueFn(gat, pat *assetsTreeNode, postSlug string, widths []i
 			return n.generateSrcSetValue(""), nil
 		}
 
-		return "", fmt.Errorf("%v not found in either GAT or PAT", assetPath)
+		return "", fmt.Errorf("%v not found in either GAT or PAT%v", assetPath, assetNotFoundHint(gat, pat, assetPath))
 	}
 }
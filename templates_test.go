@@ -1,9 +1,16 @@
 package egen
 
 import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"os"
+	"path"
 	"reflect"
 	"strconv"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestGenerateAlternateLinks(t *testing.T) {
@@ -29,6 +36,7 @@ func TestGenerateAlternateLinks(t *testing.T) {
 	tests := []struct {
 		langs                             []*Lang
 		preLangSegments, postLangSegments []string
+		trailingSlash                     bool
 		res                               []*AlternateLink
 	}{
 		{
@@ -38,6 +46,7 @@ func TestGenerateAlternateLinks(t *testing.T) {
 			},
 			nil,
 			nil,
+			false,
 			[]*AlternateLink{
 				{
 					Lang: enDefault,
@@ -56,6 +65,7 @@ func TestGenerateAlternateLinks(t *testing.T) {
 			},
 			[]string{"test"},
 			[]string{"foo"},
+			false,
 			[]*AlternateLink{
 				{
 					Lang: ptBRDefault,
@@ -67,11 +77,35 @@ func TestGenerateAlternateLinks(t *testing.T) {
 				},
 			},
 		},
+		{
+			[]*Lang{
+				ptBRNonDefault,
+				enDefault,
+			},
+			nil,
+			[]string{"foo"},
+			true,
+			[]*AlternateLink{
+				{
+					Lang: enDefault,
+					URL:  "/foo/",
+				},
+				{
+					Lang: ptBRNonDefault,
+					URL:  "/" + ptBRNonDefault.Tag + "/foo/",
+				},
+			},
+		},
 	}
 
 	for i, test := range tests {
 		t.Run(strconv.Itoa(i), func(t *testing.T) {
-			res := generateAlternateLinks(test.preLangSegments, test.postLangSegments, test.langs)
+			kind := dirPageKind
+			if len(test.preLangSegments) == 0 && len(test.postLangSegments) == 0 {
+				kind = homePageKind
+			}
+
+			res := generateAlternateLinks(test.preLangSegments, test.postLangSegments, kind, test.langs, urlStyle{trailingSlash: test.trailingSlash})
 
 			if !reflect.DeepEqual(res, test.res) {
 				t.Errorf("got %v, want %v", res, test.res)
@@ -79,3 +113,589 @@ func TestGenerateAlternateLinks(t *testing.T) {
 		})
 	}
 }
+
+func TestPostAssetLink(t *testing.T) {
+	pat, err := generateAssetsTree("testdata/tree/ok/1", nil)
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	if err := pat.process(t.TempDir(), false, nil); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	en := &Lang{Tag: "en", Default: true}
+	p := &Post{Slug: "foo", Lang: en, pat: pat}
+	postsLists := &generatePostsListsOutput{
+		allPostsByLangTag: map[string][]*Post{
+			en.Tag: {p},
+		},
+	}
+
+	baseTemplate, err := createBaseTemplateWithIncludes(nil, "", "", urlStyle{}, nil, nil, productionEnv)
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	baseTemplate.Funcs(generateBuildTemplateFuncs(postsLists, &assetsTreeNode{t: DIRNODE}, nil, nil, urlStyle{}))
+
+	tests := []struct {
+		tmpl string
+		res  string
+		err  bool
+	}{
+		{`{{ postAssetLink "foo" "foo.txt" }}`, pat.findByRelPath("foo.txt").assetLink("foo", nil), false},
+		{`{{ postAssetLink "bar" "foo.txt" }}`, "", true},
+		{`{{ postAssetLink "foo" "bar.txt" }}`, "", true},
+	}
+
+	for i, test := range tests {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			tmpl := template.Must(template.Must(baseTemplate.Clone()).New("test").Parse(test.tmpl))
+
+			var buff bytes.Buffer
+			err := tmpl.Execute(&buff, nil)
+			if test.err {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected err: %v", err)
+			}
+
+			if buff.String() != test.res {
+				t.Errorf("got %v, want %v", buff.String(), test.res)
+			}
+		})
+	}
+}
+
+func TestAllPosts(t *testing.T) {
+	en, ptBR := &Lang{Tag: "en", Default: true}, &Lang{Tag: "pt-BR"}
+	postsLists := &generatePostsListsOutput{
+		allPostsByLangTag: map[string][]*Post{
+			en.Tag: {
+				{Slug: "old", Date: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)},
+				{Slug: "invisible", Date: time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)},
+				{Slug: "new", Date: time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)},
+			},
+		},
+	}
+
+	baseTemplate, err := createBaseTemplateWithIncludes(nil, "", "", urlStyle{}, nil, nil, productionEnv)
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	baseTemplate.Funcs(generateBuildTemplateFuncs(postsLists, &assetsTreeNode{t: DIRNODE}, nil, nil, urlStyle{}))
+
+	tmpl := template.Must(template.Must(baseTemplate.Clone()).New("test").Parse(
+		`{{ range allPosts .en }}{{ .Slug }},{{ end }}|{{ range allPosts .ptBR }}{{ .Slug }},{{ end }}`,
+	))
+
+	var buff bytes.Buffer
+	if err := tmpl.Execute(&buff, map[string]*Lang{"en": en, "ptBR": ptBR}); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	if expected := "invisible,new,old,|"; buff.String() != expected {
+		t.Errorf("got %v, want %v", buff.String(), expected)
+	}
+}
+
+func TestMediaLink(t *testing.T) {
+	gat := &assetsTreeNode{t: DIRNODE}
+	clip := gat.addChild(FILENODE, "clip.mp4")
+	clip.processedRelPath = "clip-abc.mp4"
+	gat.addChild(FILENODE, "foo.txt")
+
+	mediaLink := generateMediaLinkFn(gat, nil, "")
+
+	link, err := mediaLink("/clip.mp4")
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	if expected := "/assets/clip-abc.mp4"; link != expected {
+		t.Errorf("got %v, want %v", link, expected)
+	}
+
+	for _, assetPath := range []AssetRelPath{"/foo.txt", "/bar.webm"} {
+		if _, err := mediaLink(assetPath); err == nil {
+			t.Errorf("expected an error for %v", assetPath)
+		}
+	}
+}
+
+func TestAssetLocation(t *testing.T) {
+	gat := &assetsTreeNode{t: DIRNODE}
+	gat.addChild(FILENODE, "foo.txt")
+
+	pat := &assetsTreeNode{t: DIRNODE}
+	pat.addChild(FILENODE, "bar.txt")
+
+	tests := []struct {
+		assetPath AssetRelPath
+		pat       *assetsTreeNode
+		expected  string
+	}{
+		{"/foo.txt", pat, "gat"},
+		{"bar.txt", pat, "pat"},
+		{"/bar.txt", pat, ""},
+		{"foo.txt", pat, ""},
+		{"bar.txt", nil, ""},
+	}
+
+	for _, test := range tests {
+		t.Run(string(test.assetPath), func(t *testing.T) {
+			got := generateAssetLocation(gat, test.pat)(test.assetPath)
+
+			if got != test.expected {
+				t.Errorf("got %q, want %q", got, test.expected)
+			}
+		})
+	}
+}
+
+func TestURLWithTrailingSlash(t *testing.T) {
+	tests := []struct {
+		u             string
+		trailingSlash bool
+		res           string
+	}{
+		{"/posts/foo", false, "/posts/foo"},
+		{"/posts/foo", true, "/posts/foo/"},
+		{"/posts/foo/", true, "/posts/foo/"},
+		{"/", true, "/"},
+		{"/pt-BR", true, "/pt-BR/"},
+		{"/posts/v1.2", true, "/posts/v1.2/"},
+	}
+
+	for _, test := range tests {
+		if res := urlWithTrailingSlash(test.u, test.trailingSlash); res != test.res {
+			t.Errorf("%v (trailingSlash=%v): got %v, want %v", test.u, test.trailingSlash, res, test.res)
+		}
+	}
+}
+
+func TestURLStyle(t *testing.T) {
+	en := &Lang{Tag: "en", Default: true}
+	ptBR := &Lang{Tag: "pt-BR"}
+
+	tests := []struct {
+		style         urlStyle
+		p             string
+		l             *Lang
+		url, filePath string
+	}{
+		{urlStyle{}, "", en, "/", "out/index.html"},
+		{urlStyle{}, "posts/foo", ptBR, "/pt-BR/posts/foo", "out/posts/foo/index.html"},
+		{urlStyle{trailingSlash: true}, "", ptBR, "/pt-BR/", "out/index.html"},
+		{urlStyle{trailingSlash: true}, "posts/foo", en, "/posts/foo/", "out/posts/foo/index.html"},
+		{urlStyle{uglyURLs: true}, "", ptBR, "/pt-BR", "out/index.html"},
+		{urlStyle{uglyURLs: true}, "posts/foo", en, "/posts/foo.html", "out/posts/foo.html"},
+		{urlStyle{uglyURLs: true, trailingSlash: true}, "posts/foo", ptBR, "/pt-BR/posts/foo.html", "out/posts/foo.html"},
+		{urlStyle{homeFile: "index.html"}, "", ptBR, "/pt-BR", "out/index.html"},
+		{urlStyle{homeFile: "home.html"}, "", en, "/home.html", "out/home.html"},
+		{urlStyle{homeFile: "home.html", trailingSlash: true}, "", ptBR, "/pt-BR/home.html", "out/home.html"},
+		{urlStyle{homeFile: "home.html", uglyURLs: true}, "posts/foo", en, "/posts/foo.html", "out/posts/foo.html"},
+		// slugs with dots are pages, not files.
+		{urlStyle{uglyURLs: true}, "posts/v1.2", en, "/posts/v1.2.html", "out/posts/v1.2.html"},
+		{urlStyle{trailingSlash: true}, "posts/node.js", ptBR, "/pt-BR/posts/node.js/", "out/posts/node.js/index.html"},
+	}
+
+	for _, test := range tests {
+		t.Run(fmt.Sprintf("%+v %v", test.style, test.p), func(t *testing.T) {
+			if url := test.style.pageRelURL(test.p, test.l); url != test.url {
+				t.Errorf("got %v url, want %v", url, test.url)
+			}
+
+			if filePath := test.style.pageFilePath("out", test.p); filePath != test.filePath {
+				t.Errorf("got %v file path, want %v", filePath, test.filePath)
+			}
+		})
+	}
+}
+
+func TestLangRelURL(t *testing.T) {
+	enDefault := &Lang{
+		Tag:     "en",
+		Default: true,
+	}
+	ptBRNonDefault := &Lang{
+		Tag: "pt-BR",
+	}
+
+	tests := []struct {
+		path        string
+		lang        *Lang
+		res, absRes string
+	}{
+		{"", enDefault, "/", "https://foo.bar"},
+		{"", ptBRNonDefault, "/pt-BR", "https://foo.bar/pt-BR"},
+		{"posts/foo", enDefault, "/posts/foo", "https://foo.bar/posts/foo"},
+		{"/posts/foo", ptBRNonDefault, "/pt-BR/posts/foo", "https://foo.bar/pt-BR/posts/foo"},
+	}
+
+	for i, test := range tests {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			res := langRelURL(test.path, test.lang)
+			if res != test.res {
+				t.Errorf("got %v, want %v", res, test.res)
+			}
+
+			absRes := relToAbsLink("https://foo.bar", res)
+			if absRes != test.absRes {
+				t.Errorf("got %v, want %v", absRes, test.absRes)
+			}
+		})
+	}
+}
+
+func TestNewHTMLMinifier(t *testing.T) {
+	input := "<p>\n  foo  <b>bar</b>\n</p>"
+
+	tests := []struct {
+		opts *MinifyHTMLOptions
+		res  string
+	}{
+		{nil, "<p>\nfoo <b>bar</b>\n</p>"},
+		{&MinifyHTMLOptions{}, "<p>foo <b>bar</b>"},
+	}
+
+	for i, test := range tests {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			res, err := newHTMLMinifier(test.opts).String("text/html", input)
+			if err != nil {
+				t.Fatalf("unexpected err: %v", err)
+			}
+
+			if res != test.res {
+				t.Errorf("got %q, want %q", res, test.res)
+			}
+		})
+	}
+}
+
+func TestExecuteMinifyAndWriteTemplate_err(t *testing.T) {
+	tmpl := template.Must(template.New("test").Parse(`<p>foo</p>{{ .Foo }}`))
+	dirPath := t.TempDir()
+	outFilePath := path.Join(dirPath, "index.html")
+
+	err := executeMinifyAndWriteTemplate(tmpl, TemplateData{}, newHTMLMinifier(nil), nil, outFilePath, 0644)
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+
+	entries, err := os.ReadDir(dirPath)
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	if len(entries) != 0 {
+		t.Errorf("got %v files, want none", len(entries))
+	}
+}
+
+func TestCreateBaseTemplateWithIncludes_err(t *testing.T) {
+	includesInPath := t.TempDir()
+
+	includes := map[string]string{
+		"nav.html":    `{{ assetLnk "/foo.png" }}`,
+		"footer.html": `{{ homLinkByLang .Lang }}`,
+		"ok.html":     `{{ homeLinkByLang .Lang }}`,
+	}
+
+	for name, content := range includes {
+		if err := os.WriteFile(path.Join(includesInPath, name), []byte(content), 0644); err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+	}
+
+	_, err := createBaseTemplateWithIncludes(nil, includesInPath, "", urlStyle{}, nil, nil, productionEnv)
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+
+	for _, s := range []string{"nav.html", "assetLnk", "footer.html", "homLinkByLang"} {
+		if !strings.Contains(err.Error(), s) {
+			t.Errorf("got %v, want it to contain %v", err, s)
+		}
+	}
+
+	if strings.Contains(err.Error(), "ok.html") {
+		t.Errorf("got %v, want it to not contain ok.html", err)
+	}
+}
+
+func TestNowAndCurrentYear(t *testing.T) {
+	now := func() time.Time {
+		return time.Date(2024, 5, 6, 7, 8, 9, 0, time.UTC)
+	}
+
+	baseTemplate, err := createBaseTemplateWithIncludes(nil, "", "", urlStyle{}, nil, now, productionEnv)
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	tmpl := template.Must(baseTemplate.New("test").Parse(`{{ currentYear }} {{ dateISO now }}`))
+
+	var buff bytes.Buffer
+	if err := tmpl.Execute(&buff, nil); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	expected := "2024 2024-05-06T07:08:09Z"
+	if buff.String() != expected {
+		t.Errorf("got %v, want %v", buff.String(), expected)
+	}
+}
+
+func TestGenerateAssetOriginalFn(t *testing.T) {
+	for _, originalImgs := range []bool{false, true} {
+		t.Run(strconv.FormatBool(originalImgs), func(t *testing.T) {
+			gat, err := generateAssetsTree("testdata/tree/ok/1", nil)
+			if err != nil {
+				t.Fatalf("unexpected err: %v", err)
+			}
+
+			if err := gat.process(t.TempDir(), false, &assetsProcessingConfig{originalImgs: originalImgs}); err != nil {
+				t.Fatalf("unexpected err: %v", err)
+			}
+
+			assetOriginal := generateAssetOriginalFn(gat, nil, "")
+
+			for _, p := range []AssetRelPath{"/foo.txt", "/imgs/blue.png"} {
+				if _, err := assetOriginal(p); err == nil {
+					t.Errorf("expected an error for %v", p)
+				}
+			}
+
+			link, err := assetOriginal("/imgs/red.png")
+			if !originalImgs {
+				if err == nil {
+					t.Error("expected an error")
+				}
+
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected err: %v", err)
+			}
+
+			if !strings.HasPrefix(link, "/assets/imgs/") || !strings.HasSuffix(link, "/red.png") {
+				t.Errorf("got %v, want the link of imgs/<md5>/red.png", link)
+			}
+		})
+	}
+}
+
+func TestGenerateInlineCSSFn(t *testing.T) {
+	dir := t.TempDir()
+
+	files := map[string]string{
+		"main.css":         "a {\n  color: #0000ff;\n}\n",
+		"css/critical.css": "body {\n  color: #ff0000;\n  margin: 0px;\n}\n\n/* header */\nheader { padding: 0.50em; }\n",
+		"css/note.txt":     "body { color: red; }",
+	}
+
+	for name, content := range files {
+		filePath := path.Join(dir, name)
+
+		if err := os.MkdirAll(path.Dir(filePath), os.ModeDir|os.ModePerm); err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+
+		if err := os.WriteFile(filePath, []byte(content), 0644); err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+	}
+
+	gat, err := generateAssetsTree(dir, nil)
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	if err := gat.processCSSFileNodes(); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	if err := gat.process(t.TempDir(), false, nil); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	inlineCSS := generateInlineCSSFn(gat)
+
+	tests := []struct {
+		assetPath AssetRelPath
+		expected  template.CSS
+		err       bool
+	}{
+		{"/css/critical.css", "body{color:red;margin:0}header{padding:.5em}", false},
+		// root css files are bundled into style.css.
+		{"/style.css", "a{color:#00f}", false},
+		{"/main.css", "", true},
+		{"/css/note.txt", "", true},
+		{"/css", "", true},
+	}
+
+	for _, test := range tests {
+		t.Run(string(test.assetPath), func(t *testing.T) {
+			res, err := inlineCSS(test.assetPath)
+			if test.err {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected err: %v", err)
+			}
+
+			if res != test.expected {
+				t.Errorf("got %q, want %q", res, test.expected)
+			}
+		})
+	}
+
+	preloadCSS := generatePreloadCSSFn(gat)
+
+	res, err := preloadCSS("/css/critical.css")
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	n, _ := findByRelPathInGATOrPAT(gat, nil, "/css/critical.css")
+	link := n.assetLink("", nil)
+	expected := template.HTML(fmt.Sprintf(
+		`<link rel="preload" href="%v" as="style" onload="this.onload=null;this.rel='stylesheet'"><noscript><link rel="stylesheet" href="%v"></noscript>`,
+		link,
+		link,
+	))
+
+	if res != expected {
+		t.Errorf("got %q, want %q", res, expected)
+	}
+
+	for _, assetPath := range []AssetRelPath{"/css/note.txt", "/missing.css"} {
+		if _, err := preloadCSS(assetPath); err == nil {
+			t.Errorf("expected an error for %v", assetPath)
+		}
+	}
+}
+
+func TestGenerateInlineAssetFn(t *testing.T) {
+	dir := t.TempDir()
+
+	files := map[string]string{
+		"icons.svg": `<svg xmlns="http://www.w3.org/2000/svg"><symbol id="rss"><path d="M0 0h1v1z"/></symbol></svg>`,
+		"note.txt":  `<b>"bold"</b> & co`,
+		"data.bin":  "\x00\x01",
+		"main.css":  "body { color: red; }",
+		"main.js":   "console.log(1 < 2);",
+	}
+
+	for name, content := range files {
+		if err := os.WriteFile(path.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+	}
+
+	gat, err := generateAssetsTree(dir, nil)
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	pat, err := generateAssetsTree("testdata/tree/ok/1", nil)
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	inlineAsset := generateInlineAssetFn(gat, pat)
+
+	tests := []struct {
+		assetPath AssetRelPath
+		expected  template.HTML
+		err       bool
+	}{
+		{"/icons.svg", template.HTML(files["icons.svg"]), false},
+		{"/note.txt", "&lt;b&gt;&#34;bold&#34;&lt;/b&gt; &amp; co", false},
+		{"foo.txt", "some", false},
+		{"/data.bin", "", true},
+		// css and js would be escaped as html, which breaks them in style and script elements.
+		{"/main.css", "", true},
+		{"/main.js", "", true},
+		{"imgs/red.png", "", true},
+		{"/missing.svg", "", true},
+	}
+
+	for _, test := range tests {
+		t.Run(string(test.assetPath), func(t *testing.T) {
+			res, err := inlineAsset(test.assetPath)
+			if test.err {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected err: %v", err)
+			}
+
+			if strings.TrimSpace(string(res)) != string(test.expected) {
+				t.Errorf("got %q, want %q", res, test.expected)
+			}
+		})
+	}
+}
+
+func TestGenerateAssetSizeFn(t *testing.T) {
+	gat, err := generateAssetsTree("testdata/tree/ok/1", nil)
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	if err := gat.process(t.TempDir(), false, nil); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	assetSize := generateAssetSizeFn(gat, nil)
+
+	tests := []struct {
+		assetPath AssetRelPath
+		expected  int64
+		err       bool
+	}{
+		{"/foo.txt", 4, false},
+		// the original size of an img is its file as is.
+		{"/imgs/red.png", 3235, false},
+		{"/imgs", 0, true},
+		{"/missing.txt", 0, true},
+		{"foo.txt", 0, true},
+	}
+
+	for _, test := range tests {
+		t.Run(string(test.assetPath), func(t *testing.T) {
+			size, err := assetSize(test.assetPath)
+			if test.err {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected err: %v", err)
+			}
+
+			if size != test.expected {
+				t.Errorf("got %v, want %v", size, test.expected)
+			}
+		})
+	}
+}
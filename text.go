@@ -0,0 +1,108 @@
+package egen
+
+import (
+	"fmt"
+	"html/template"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/net/html"
+)
+
+// plainifyBlockTags are the tags that separate the text around them, e.g. the one of two
+// adjacent paragraphs, unlike inline tags such as em.
+var plainifyBlockTags = map[string]struct{}{
+	"address": {}, "article": {}, "aside": {}, "blockquote": {}, "br": {}, "dd": {},
+	"div": {}, "dl": {}, "dt": {}, "figcaption": {}, "figure": {}, "footer": {}, "h1": {},
+	"h2": {}, "h3": {}, "h4": {}, "h5": {}, "h6": {}, "header": {}, "hr": {}, "li": {},
+	"main": {}, "nav": {}, "ol": {}, "p": {}, "pre": {}, "section": {}, "table": {},
+	"td": {}, "th": {}, "tr": {}, "ul": {},
+}
+
+// plainifySkippedTags are the tags whose content isn't text.
+var plainifySkippedTags = map[string]struct{}{
+	"script":   {},
+	"style":    {},
+	"template": {},
+}
+
+// plainify returns the text of the html s, i.e. s without its tags and comments and with
+// its entities unescaped, with its whitespace collapsed into single spaces.
+func plainify(s string) string {
+	var (
+		text    strings.Builder
+		skipped string
+	)
+
+	z := html.NewTokenizer(strings.NewReader(s))
+
+	for {
+		tt := z.Next()
+
+		switch tt {
+		case html.ErrorToken:
+			return strings.Join(strings.Fields(text.String()), " ")
+		case html.StartTagToken, html.EndTagToken, html.SelfClosingTagToken:
+			nameBytes, _ := z.TagName()
+			name := string(nameBytes)
+
+			if mapContains(plainifySkippedTags, name) {
+				if tt == html.StartTagToken {
+					skipped = name
+				} else if skipped == name {
+					skipped = ""
+				}
+			}
+
+			if mapContains(plainifyBlockTags, name) {
+				text.WriteByte(' ')
+			}
+		case html.TextToken:
+			// the text is unescaped by the tokenizer.
+			if skipped == "" {
+				text.Write(z.Text())
+			}
+		}
+	}
+}
+
+// truncate returns s cut at the last word boundary within its first n chars, followed by an
+// ellipsis. If the first word of s is longer than n, it's cut at n. If s has at most n chars
+// or n isn't positive, s is returned as is.
+func truncate(s string, n int) string {
+	if n <= 0 || utf8.RuneCountInString(s) <= n {
+		return s
+	}
+
+	// i is the byte index of the nth char, i.e. where the cut is made without a boundary.
+	i := 0
+	for range n {
+		_, size := utf8.DecodeRuneInString(s[i:])
+		i += size
+	}
+
+	cut := i
+
+	// the cut is only moved back if it's in the middle of a word.
+	next, _ := utf8.DecodeRuneInString(s[i:])
+	if !unicode.IsSpace(next) {
+		if boundary := strings.LastIndexFunc(s[:i], unicode.IsSpace); boundary != -1 {
+			cut = boundary
+		}
+	}
+
+	return strings.TrimRightFunc(s[:cut], unicode.IsSpace) + "…"
+}
+
+// templateText returns the text of v, a string or template.HTML passed to a template func.
+func templateText(v any) (string, error) {
+	switch v := v.(type) {
+	case string:
+		return v, nil
+	case template.HTML:
+		return string(v), nil
+	default:
+		return "", fmt.Errorf("expected a string or template.HTML, got %T", v)
+	}
+}
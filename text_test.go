@@ -0,0 +1,72 @@
+package egen
+
+import (
+	"html/template"
+	"testing"
+)
+
+func TestPlainify(t *testing.T) {
+	tests := []struct {
+		s, expected string
+	}{
+		{"", ""},
+		{"foo", "foo"},
+		{"<p>foo <em>bar</em></p>", "foo bar"},
+		{"<p>foo<em>bar</em></p><p>baz</p>", "foobar baz"},
+		{"<div><ul><li>a <strong>b <code>c</code></strong></li><li>d</li></ul></div>", "a b c d"},
+		{"<p>1 &lt; 2 &amp;&amp; caf&eacute;</p>", "1 < 2 && café"},
+		{"<p>foo</p><!-- a comment --><script>var a = '<p>b</p>';</script><style>p { color: red; }</style>bar", "foo bar"},
+		{"<p>foo\n\t  bar</p><br>baz", "foo bar baz"},
+		{`<img src="a.png" alt="not text"><a href="/b">link</a>`, "link"},
+		{"<p>unclosed <em>tags", "unclosed tags"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.s, func(t *testing.T) {
+			if got := plainify(test.s); got != test.expected {
+				t.Errorf("got %q, want %q", got, test.expected)
+			}
+		})
+	}
+}
+
+func TestTruncate(t *testing.T) {
+	tests := []struct {
+		s        string
+		n        int
+		expected string
+	}{
+		{"foo bar", 0, "foo bar"},
+		{"foo bar", 7, "foo bar"},
+		{"foo bar baz", 9, "foo bar…"},
+		{"foo bar baz", 8, "foo bar…"},
+		{"foo bar baz", 7, "foo bar…"},
+		{"foo bar baz", 5, "foo…"},
+		{"foobarbaz qux", 3, "foo…"},
+		// multibyte chars are counted as one char and never cut.
+		{"café olé ação", 8, "café olé…"},
+		{"café olé ação", 6, "café…"},
+		{"日本語のテキスト", 3, "日本語…"},
+		{"português do Brasil", 11, "português…"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.s, func(t *testing.T) {
+			if got := truncate(test.s, test.n); got != test.expected {
+				t.Errorf("got %q for %v, want %q", got, test.n, test.expected)
+			}
+		})
+	}
+}
+
+func TestTemplateText(t *testing.T) {
+	for _, v := range []any{"<p>foo</p>", template.HTML("<p>foo</p>")} {
+		if got, err := templateText(v); err != nil || got != "<p>foo</p>" {
+			t.Errorf("got %q, %v for %#v, want <p>foo</p>", got, err, v)
+		}
+	}
+
+	if _, err := templateText(1); err == nil {
+		t.Error("expected an error")
+	}
+}
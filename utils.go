@@ -1,7 +1,86 @@
 package egen
 
+import (
+	"io"
+	"io/fs"
+	"math/rand/v2"
+	"os"
+	"path"
+	"strconv"
+)
+
 func mapContains[K comparable, V any](m map[K]V, k K) bool {
 	_, ok := m[k]
 
 	return ok
 }
+
+// firstNonEmpty returns the first string in ss that isn't empty or an empty string if
+// there's none.
+func firstNonEmpty(ss ...string) string {
+	for _, s := range ss {
+		if s != "" {
+			return s
+		}
+	}
+
+	return ""
+}
+
+// outputPerms are the permissions of the directories and of the files created in OutPath.
+// Both are subject to the umask, as in os.MkdirAll and os.Create.
+type outputPerms struct {
+	dir, file os.FileMode
+}
+
+var defaultOutputPerms = outputPerms{dir: os.ModePerm, file: 0666}
+
+// writeFileAtomic creates a temporary file in the directory of filePath, writes to it through fn
+// and renames it to filePath if fn doesn't return an error. This way, filePath is never left
+// with partial content. The file is created with perm, which is subject to the umask.
+func writeFileAtomic(filePath string, perm os.FileMode, fn func(w io.Writer) error) error {
+	f, err := createTempFile(path.Dir(filePath), "."+path.Base(filePath)+"-", perm)
+	if err != nil {
+		return err
+	}
+
+	tmpFilePath := f.Name()
+	defer os.Remove(tmpFilePath)
+
+	if err := fn(f); err != nil {
+		f.Close()
+		return err
+	}
+
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmpFilePath, filePath)
+}
+
+// createTempFile is the same as os.CreateTemp, but the file, whose name is prefix followed by
+// a random number, is created with perm, which is subject to the umask, instead of with 0600.
+func createTempFile(dirPath, prefix string, perm os.FileMode) (*os.File, error) {
+	for i := 0; i < 10000; i++ {
+		filePath := path.Join(dirPath, prefix+strconv.FormatUint(uint64(rand.Uint32()), 10))
+
+		f, err := os.OpenFile(filePath, os.O_RDWR|os.O_CREATE|os.O_EXCL, perm)
+		if os.IsExist(err) {
+			continue
+		}
+
+		return f, err
+	}
+
+	return nil, &fs.PathError{Op: "createtemp", Path: path.Join(dirPath, prefix+"*"), Err: fs.ErrExist}
+}
+
+// writeFileAtomicBytes is the same as writeFileAtomic, but writes content to filePath.
+func writeFileAtomicBytes(filePath string, perm os.FileMode, content []byte) error {
+	return writeFileAtomic(filePath, perm, func(w io.Writer) error {
+		_, err := w.Write(content)
+
+		return err
+	})
+}
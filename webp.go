@@ -0,0 +1,467 @@
+package egen
+
+import (
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/draw"
+	"io"
+	"slices"
+	"sort"
+)
+
+// webpMaxDimension is the maximum width and height of a lossless webp img.
+const webpMaxDimension = 1 << 14
+
+// webpPredictorBits is the log-2 size of the tiles of the predictor transform. Since every
+// tile uses the same predictor, the largest size is used.
+const webpPredictorBits = 9
+
+// webpCodeLengthCodeOrder is the order in which the code lengths of the code that encodes
+// the code lengths of a prefix code are written.
+var webpCodeLengthCodeOrder = [19]int{17, 18, 0, 1, 2, 3, 4, 5, 16, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15}
+
+// webpAlphabetSizes are the sizes of the alphabets of the green, red, blue, alpha and
+// distance prefix codes. The green one also has the codes of the lengths of backward
+// references.
+var webpAlphabetSizes = [5]int{256 + 24, 256, 256, 256, 40}
+
+// encodeWebP writes img to w as a lossless webp, i.e. a VP8L bitstream in a RIFF container.
+// The subtract green and the predictor transforms are applied to the pixels, which are
+// then written as literals, so the output is usually smaller than a png, but larger than
+// the one of an optimizing encoder.
+func encodeWebP(w io.Writer, img image.Image) error {
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+
+	if width == 0 || height == 0 {
+		return errors.New("img is empty")
+	}
+
+	if width > webpMaxDimension || height > webpMaxDimension {
+		return errors.New("img is larger than 16384x16384")
+	}
+
+	nrgba := image.NewNRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(nrgba, nrgba.Bounds(), img, bounds.Min, draw.Src)
+
+	hasAlpha := false
+	for i := 3; i < len(nrgba.Pix); i += 4 {
+		if nrgba.Pix[i] != 0xff {
+			hasAlpha = true
+			break
+		}
+	}
+
+	bw := &webpBitWriter{}
+
+	bw.write(0x2f, 8)
+	bw.write(uint32(width-1), 14)
+	bw.write(uint32(height-1), 14)
+	bw.writeBool(hasAlpha)
+	bw.write(0, 3)
+
+	// the transforms are undone in the reverse order, so the predictor one is applied to
+	// the pixels with the green subtracted.
+	bw.writeBool(true)
+	bw.write(2, 2)
+	pix := webpSubtractGreen(nrgba.Pix)
+
+	bw.writeBool(true)
+	bw.write(0, 2)
+	bw.write(webpPredictorBits-2, 3)
+	tilesWidth := (width + 1<<webpPredictorBits - 1) >> webpPredictorBits
+	tilesHeight := (height + 1<<webpPredictorBits - 1) >> webpPredictorBits
+	predictors := make([]uint8, 4*tilesWidth*tilesHeight)
+	for i := 1; i < len(predictors); i += 4 {
+		// the green channel is the predictor of a tile, and 1 is the left pixel.
+		predictors[i] = 1
+	}
+	bw.writeEntropyCodedImg(predictors, false)
+	pix = webpPredictLeft(pix, width)
+
+	bw.writeBool(false)
+	bw.writeEntropyCodedImg(pix, true)
+
+	data := bw.bytes()
+
+	chunkSize := len(data)
+	if len(data)%2 != 0 {
+		data = append(data, 0)
+	}
+
+	header := make([]byte, 20)
+	copy(header[0:], "RIFF")
+	binary.LittleEndian.PutUint32(header[4:], uint32(12+len(data)))
+	copy(header[8:], "WEBPVP8L")
+	binary.LittleEndian.PutUint32(header[16:], uint32(chunkSize))
+
+	if _, err := w.Write(header); err != nil {
+		return err
+	}
+
+	_, err := w.Write(data)
+
+	return err
+}
+
+// webpSubtractGreen returns a copy of the rgba pixels in pix with the green of each pixel
+// subtracted from its red and its blue.
+func webpSubtractGreen(pix []uint8) []uint8 {
+	res := make([]uint8, len(pix))
+
+	for i := 0; i < len(pix); i += 4 {
+		res[i] = pix[i] - pix[i+1]
+		res[i+1] = pix[i+1]
+		res[i+2] = pix[i+2] - pix[i+1]
+		res[i+3] = pix[i+3]
+	}
+
+	return res
+}
+
+// webpPredictLeft returns the residuals of the rgba pixels in pix, which are width wide,
+// when each one is predicted by the pixel on its left. As in every webp, the first pixel
+// is predicted by an opaque black one and the ones in the first column by the ones above
+// them.
+func webpPredictLeft(pix []uint8, width int) []uint8 {
+	res := make([]uint8, len(pix))
+
+	for i := 0; i < len(pix); i += 4 {
+		var pred [4]uint8
+
+		switch {
+		case i == 0:
+			pred = [4]uint8{0, 0, 0, 0xff}
+		case i/4%width == 0:
+			copy(pred[:], pix[i-4*width:])
+		default:
+			copy(pred[:], pix[i-4:])
+		}
+
+		for c := 0; c < 4; c++ {
+			res[i+c] = pix[i+c] - pred[c]
+		}
+	}
+
+	return res
+}
+
+// webpBitWriter writes the bits of a VP8L bitstream, starting from the least significant
+// bit of each byte.
+type webpBitWriter struct {
+	buf   []byte
+	bits  uint64
+	nBits uint
+}
+
+func (bw *webpBitWriter) write(v uint32, n uint) {
+	bw.bits |= uint64(v) << bw.nBits
+	bw.nBits += n
+
+	for bw.nBits >= 8 {
+		bw.buf = append(bw.buf, byte(bw.bits))
+		bw.bits >>= 8
+		bw.nBits -= 8
+	}
+}
+
+func (bw *webpBitWriter) writeBool(v bool) {
+	if v {
+		bw.write(1, 1)
+	} else {
+		bw.write(0, 1)
+	}
+}
+
+// writeSymbol writes the code of symbol in c. The codes are written starting from their
+// most significant bit.
+func (bw *webpBitWriter) writeSymbol(c *webpPrefixCode, symbol int) {
+	code, length := c.codes[symbol], c.lengths[symbol]
+
+	var reversed uint32
+	for i := uint32(0); i < length; i++ {
+		reversed |= (code >> i & 1) << (length - 1 - i)
+	}
+
+	bw.write(reversed, uint(length))
+}
+
+func (bw *webpBitWriter) bytes() []byte {
+	if bw.nBits > 0 {
+		bw.buf = append(bw.buf, byte(bw.bits))
+		bw.bits, bw.nBits = 0, 0
+	}
+
+	return bw.buf
+}
+
+// writeEntropyCodedImg writes the rgba pixels in pix with a single group of prefix codes
+// and without a color cache. The main img, as opposed to the ones of the transforms, has
+// to say it has no meta prefix codes.
+func (bw *webpBitWriter) writeEntropyCodedImg(pix []uint8, main bool) {
+	bw.writeBool(false)
+	if main {
+		bw.writeBool(false)
+	}
+
+	// the channels of each pixel are written in the order of their codes.
+	channels := [4]int{1, 0, 2, 3}
+
+	var codes [5]*webpPrefixCode
+
+	for i, alphabetSize := range webpAlphabetSizes {
+		hist := make([]uint32, alphabetSize)
+
+		if i < len(channels) {
+			for p := channels[i]; p < len(pix); p += 4 {
+				hist[pix[p]]++
+			}
+		}
+
+		codes[i] = bw.writePrefixCode(hist)
+	}
+
+	for p := 0; p < len(pix); p += 4 {
+		for i, c := range channels {
+			bw.writeSymbol(codes[i], int(pix[p+c]))
+		}
+	}
+}
+
+// webpPrefixCode is a canonical prefix code, i.e. a huffman code whose codes are implied by
+// their lengths.
+type webpPrefixCode struct {
+	codes   []uint32
+	lengths []uint32
+}
+
+// writePrefixCode writes the prefix code of the symbols whose counts are in hist and
+// returns it.
+func (bw *webpBitWriter) writePrefixCode(hist []uint32) *webpPrefixCode {
+	var symbols []int
+	for s, count := range hist {
+		if count > 0 {
+			symbols = append(symbols, s)
+		}
+	}
+
+	// a code of a single symbol, which doesn't take any bits, is written as a simple code.
+	if len(symbols) <= 1 {
+		symbol := 0
+		if len(symbols) == 1 {
+			symbol = symbols[0]
+		}
+
+		bw.writeBool(true)
+		bw.write(0, 1)
+		if symbol < 2 {
+			bw.write(0, 1)
+			bw.write(uint32(symbol), 1)
+		} else {
+			bw.write(1, 1)
+			bw.write(uint32(symbol), 8)
+		}
+
+		return &webpPrefixCode{codes: make([]uint32, len(hist)), lengths: make([]uint32, len(hist))}
+	}
+
+	lengths := webpCodeLengths(hist, 15)
+
+	// the lengths are run-length encoded with the symbols of the code-length code: 0 to 15
+	// are lengths, 16 repeats the previous nonzero length 3 to 6 times and 17 and 18 repeat
+	// zero 3 to 10 and 11 to 138 times, respectively.
+	type clToken struct {
+		symbol    int
+		extra     uint32
+		extraBits uint
+	}
+
+	var tokens []clToken
+
+	for i := 0; i < len(lengths); {
+		length := lengths[i]
+
+		run := 1
+		for i+run < len(lengths) && lengths[i+run] == length {
+			run++
+		}
+		i += run
+
+		if length == 0 {
+			for run >= 11 {
+				n := min(run, 138)
+				tokens = append(tokens, clToken{18, uint32(n - 11), 7})
+				run -= n
+			}
+
+			if run >= 3 {
+				tokens = append(tokens, clToken{17, uint32(run - 3), 3})
+				run = 0
+			}
+		} else {
+			tokens = append(tokens, clToken{symbol: int(length)})
+			run--
+
+			for run >= 3 {
+				n := min(run, 6)
+				tokens = append(tokens, clToken{16, uint32(n - 3), 2})
+				run -= n
+			}
+		}
+
+		for ; run > 0; run-- {
+			tokens = append(tokens, clToken{symbol: int(length)})
+		}
+	}
+
+	clHist := make([]uint32, len(webpCodeLengthCodeOrder))
+	for _, token := range tokens {
+		clHist[token.symbol]++
+	}
+
+	clLengths := webpCodeLengths(clHist, 7)
+
+	nCLLengths := 4
+	for i, s := range webpCodeLengthCodeOrder {
+		if clLengths[s] != 0 {
+			nCLLengths = max(nCLLengths, i+1)
+		}
+	}
+
+	bw.writeBool(false)
+	bw.write(uint32(nCLLengths-4), 4)
+	for _, s := range webpCodeLengthCodeOrder[:nCLLengths] {
+		bw.write(clLengths[s], 3)
+	}
+
+	// the lengths of all of the symbols are written, instead of up to a max symbol.
+	bw.writeBool(false)
+
+	clCode := newWebPPrefixCode(clLengths)
+	for _, token := range tokens {
+		bw.writeSymbol(clCode, token.symbol)
+		bw.write(token.extra, token.extraBits)
+	}
+
+	return newWebPPrefixCode(lengths)
+}
+
+// newWebPPrefixCode returns the canonical prefix code with lengths. If there's a single
+// symbol, its code doesn't take any bits.
+func newWebPPrefixCode(lengths []uint32) *webpPrefixCode {
+	var (
+		nSymbols  int
+		maxLength uint32
+	)
+
+	for _, length := range lengths {
+		if length > 0 {
+			nSymbols++
+			maxLength = max(maxLength, length)
+		}
+	}
+
+	c := &webpPrefixCode{codes: make([]uint32, len(lengths)), lengths: make([]uint32, len(lengths))}
+	if nSymbols == 1 {
+		return c
+	}
+
+	copy(c.lengths, lengths)
+
+	countByLength := make([]uint32, maxLength+1)
+	for _, length := range lengths {
+		countByLength[length]++
+	}
+	countByLength[0] = 0
+
+	nextCodes := make([]uint32, maxLength+1)
+	var code uint32
+	for length := uint32(1); length <= maxLength; length++ {
+		code = (code + countByLength[length-1]) << 1
+		nextCodes[length] = code
+	}
+
+	for s, length := range lengths {
+		if length > 0 {
+			c.codes[s] = nextCodes[length]
+			nextCodes[length]++
+		}
+	}
+
+	return c
+}
+
+// webpCodeLengths returns the lengths of the huffman codes of the symbols whose counts are
+// in hist, none of which is greater than maxLength. Symbols whose count is zero have no
+// code. If there's a single symbol, its length is 1.
+func webpCodeLengths(hist []uint32, maxLength uint32) []uint32 {
+	counts := make([]uint32, len(hist))
+	copy(counts, hist)
+
+	for shift := 1; ; shift++ {
+		lengths := webpHuffmanCodeLengths(counts)
+
+		if !slices.ContainsFunc(lengths, func(length uint32) bool { return length > maxLength }) {
+			return lengths
+		}
+
+		// flattening the counts makes the tree more balanced, until they're all 1.
+		for s, count := range hist {
+			if count > 0 {
+				counts[s] = max(count>>shift, 1)
+			}
+		}
+	}
+}
+
+// webpHuffmanCodeLengths returns the lengths of the huffman codes of the symbols whose
+// counts are in counts, without limiting them.
+func webpHuffmanCodeLengths(counts []uint32) []uint32 {
+	type node struct {
+		weight uint64
+		parent int
+	}
+
+	var nodes []node
+	var active []int
+
+	leaves := make([]int, len(counts))
+	for s, count := range counts {
+		leaves[s] = -1
+
+		if count > 0 {
+			leaves[s] = len(nodes)
+			active = append(active, len(nodes))
+			nodes = append(nodes, node{weight: uint64(count), parent: -1})
+		}
+	}
+
+	for len(active) > 1 {
+		sort.SliceStable(active, func(i, j int) bool {
+			return nodes[active[i]].weight < nodes[active[j]].weight
+		})
+
+		a, b := active[0], active[1]
+		nodes = append(nodes, node{weight: nodes[a].weight + nodes[b].weight, parent: -1})
+		nodes[a].parent = len(nodes) - 1
+		nodes[b].parent = len(nodes) - 1
+
+		active = append(active[2:], len(nodes)-1)
+	}
+
+	lengths := make([]uint32, len(counts))
+	for s, leaf := range leaves {
+		if leaf == -1 {
+			continue
+		}
+
+		for n := leaf; nodes[n].parent != -1; n = nodes[n].parent {
+			lengths[s]++
+		}
+
+		lengths[s] = max(lengths[s], 1)
+	}
+
+	return lengths
+}
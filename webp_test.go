@@ -0,0 +1,139 @@
+package egen
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"math/rand"
+	"testing"
+
+	"golang.org/x/image/webp"
+)
+
+func TestEncodeWebP(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+
+	tests := []struct {
+		name string
+		img  func() image.Image
+	}{
+		{
+			"1x1",
+			func() image.Image {
+				img := image.NewNRGBA(image.Rect(0, 0, 1, 1))
+				img.Set(0, 0, color.NRGBA{R: 10, G: 20, B: 30, A: 255})
+
+				return img
+			},
+		},
+		{
+			"solid",
+			func() image.Image {
+				img := image.NewNRGBA(image.Rect(0, 0, 40, 20))
+				for x := 0; x < 40; x++ {
+					for y := 0; y < 20; y++ {
+						img.Set(x, y, color.NRGBA{R: 255, A: 255})
+					}
+				}
+
+				return img
+			},
+		},
+		{
+			"gradient",
+			func() image.Image {
+				img := image.NewRGBA(image.Rect(0, 0, 600, 50))
+				for x := 0; x < 600; x++ {
+					for y := 0; y < 50; y++ {
+						img.Set(x, y, color.RGBA{R: uint8(x), G: uint8(y * 5), B: uint8(x + y), A: 255})
+					}
+				}
+
+				return img
+			},
+		},
+		{
+			"noise with alpha",
+			func() image.Image {
+				img := image.NewNRGBA(image.Rect(0, 0, 70, 30))
+				rnd.Read(img.Pix)
+
+				return img
+			},
+		},
+		{
+			"offset bounds",
+			func() image.Image {
+				img := image.NewNRGBA(image.Rect(0, 0, 10, 10))
+				rnd.Read(img.Pix)
+
+				return img.SubImage(image.Rect(3, 2, 9, 7))
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			img := test.img()
+
+			var buff bytes.Buffer
+			if err := encodeWebP(&buff, img); err != nil {
+				t.Fatalf("unexpected err: %v", err)
+			}
+
+			decoded, err := webp.Decode(&buff)
+			if err != nil {
+				t.Fatalf("unexpected err: %v", err)
+			}
+
+			bounds := img.Bounds()
+			if decoded.Bounds().Dx() != bounds.Dx() || decoded.Bounds().Dy() != bounds.Dy() {
+				t.Fatalf("got %v bounds, want %vx%v", decoded.Bounds(), bounds.Dx(), bounds.Dy())
+			}
+
+			for y := 0; y < bounds.Dy(); y++ {
+				for x := 0; x < bounds.Dx(); x++ {
+					got := color.NRGBAModel.Convert(decoded.At(x, y))
+					expected := color.NRGBAModel.Convert(img.At(bounds.Min.X+x, bounds.Min.Y+y))
+
+					if got != expected {
+						t.Fatalf("got %v at %v,%v, want %v", got, x, y, expected)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestEncodeWebP_tooLarge(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, webpMaxDimension+1, 1))
+
+	if err := encodeWebP(&bytes.Buffer{}, img); err == nil {
+		t.Error("expected an error")
+	}
+}
+
+func TestWebPCodeLengths(t *testing.T) {
+	// fibonacci counts make the deepest huffman trees.
+	hist := make([]uint32, 30)
+	hist[0], hist[1] = 1, 1
+	for i := 2; i < len(hist); i++ {
+		hist[i] = hist[i-1] + hist[i-2]
+	}
+
+	lengths := webpCodeLengths(hist, 15)
+
+	var kraft float64
+	for _, length := range lengths {
+		if length == 0 || length > 15 {
+			t.Fatalf("got %v, want lengths from 1 to 15", lengths)
+		}
+
+		kraft += 1 / float64(uint32(1)<<length)
+	}
+
+	// the codes must make up a complete tree.
+	if kraft != 1 {
+		t.Errorf("got %v kraft sum for %v, want 1", kraft, lengths)
+	}
+}